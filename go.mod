@@ -4,5 +4,7 @@ go 1.21
 
 require (
 	github.com/gorilla/mux v1.8.1
+	golang.org/x/net v0.19.0
+	golang.org/x/text v0.14.0
 	gopkg.in/yaml.v3 v3.0.1
 )
@@ -3,6 +3,9 @@ package config
 import (
 	"fmt"
 	"os"
+	"time"
+
+	"mailboxzero/internal/similarity"
 
 	"gopkg.in/yaml.v3"
 )
@@ -16,11 +19,50 @@ type Config struct {
 		Endpoint string `yaml:"endpoint"`
 		APIToken string `yaml:"api_token"`
 	} `yaml:"jmap"`
+	// Retry controls how failed JMAP requests (rate limiting, server
+	// unavailable, network errors) are retried
+	Retry struct {
+		MaxAttempts int           `yaml:"max_attempts"`
+		BaseDelay   time.Duration `yaml:"base_delay"`
+		MaxDelay    time.Duration `yaml:"max_delay"`
+	} `yaml:"retry"`
+	Journal struct {
+		Path       string `yaml:"path"`
+		MaxEntries int    `yaml:"max_entries"`
+	} `yaml:"journal"`
+	// Similarity tunes fuzzy matching. Weights and BodyScoring can be
+	// overridden per request; MaxEmails is how many of the newest inbox
+	// emails are grouped and Workers how many CPUs score them, all of them
+	// if 0. FeedbackPath is where archive decisions and the weights learned
+	// from them are kept.
+	Similarity struct {
+		Weights      similarity.Weights     `yaml:"weights"`
+		BodyScoring  similarity.BodyScoring `yaml:"body_scoring"`
+		MaxEmails    int                    `yaml:"max_emails"`
+		Workers      int                    `yaml:"workers"`
+		FeedbackPath string                 `yaml:"feedback_path"`
+	} `yaml:"similarity"`
 	DryRun            bool `yaml:"dry_run"`
 	DefaultSimilarity int  `yaml:"default_similarity"`
 	MockMode          bool `yaml:"mock_mode"`
 }
 
+// DefaultSimilarityMaxEmails is how many inbox emails are grouped unless
+// similarity.max_emails says otherwise. Each comes with the start of its
+// body, so the listing stays within a few megabytes.
+const DefaultSimilarityMaxEmails = 2000
+
+const (
+	defaultJournalPath       = "archive-journal.json"
+	defaultJournalMaxEntries = 50
+
+	defaultFeedbackPath = "similarity-feedback.json"
+
+	defaultRetryMaxAttempts = 4
+	defaultRetryBaseDelay   = 500 * time.Millisecond
+	defaultRetryMaxDelay    = 30 * time.Second
+)
+
 func Load(configPath string) (*Config, error) {
 	data, err := os.ReadFile(configPath)
 	if err != nil {
@@ -32,6 +74,8 @@ func Load(configPath string) (*Config, error) {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
 
+	config.applyDefaults()
+
 	if err := config.validate(); err != nil {
 		return nil, fmt.Errorf("config validation failed: %w", err)
 	}
@@ -39,6 +83,33 @@ func Load(configPath string) (*Config, error) {
 	return &config, nil
 }
 
+func (c *Config) applyDefaults() {
+	if c.Journal.Path == "" {
+		c.Journal.Path = defaultJournalPath
+	}
+	if c.Journal.MaxEntries == 0 {
+		c.Journal.MaxEntries = defaultJournalMaxEntries
+	}
+	if c.Retry.MaxAttempts == 0 {
+		c.Retry.MaxAttempts = defaultRetryMaxAttempts
+	}
+	if c.Retry.BaseDelay == 0 {
+		c.Retry.BaseDelay = defaultRetryBaseDelay
+	}
+	if c.Retry.MaxDelay == 0 {
+		c.Retry.MaxDelay = defaultRetryMaxDelay
+	}
+	if c.Similarity.Weights == (similarity.Weights{}) {
+		c.Similarity.Weights = similarity.DefaultWeights
+	}
+	if c.Similarity.MaxEmails == 0 {
+		c.Similarity.MaxEmails = DefaultSimilarityMaxEmails
+	}
+	if c.Similarity.FeedbackPath == "" {
+		c.Similarity.FeedbackPath = defaultFeedbackPath
+	}
+}
+
 func (c *Config) validate() error {
 	if c.Server.Port <= 0 || c.Server.Port > 65535 {
 		return fmt.Errorf("invalid server port: %d", c.Server.Port)
@@ -59,6 +130,33 @@ func (c *Config) validate() error {
 		return fmt.Errorf("default similarity must be between 0 and 100")
 	}
 
+	if c.Journal.MaxEntries < 0 {
+		return fmt.Errorf("journal max entries must not be negative")
+	}
+
+	if c.Retry.MaxAttempts < 0 {
+		return fmt.Errorf("retry max attempts must not be negative")
+	}
+	if c.Retry.BaseDelay < 0 || c.Retry.MaxDelay < c.Retry.BaseDelay {
+		return fmt.Errorf("retry delays must satisfy 0 <= base_delay <= max_delay")
+	}
+
+	// Zero weights are replaced by the defaults
+	if c.Similarity.Weights != (similarity.Weights{}) {
+		if err := c.Similarity.Weights.Validate(); err != nil {
+			return fmt.Errorf("invalid similarity weights: %w", err)
+		}
+	}
+	if _, err := similarity.ParseBodyScoring(string(c.Similarity.BodyScoring)); err != nil {
+		return fmt.Errorf("invalid similarity body scoring: %w", err)
+	}
+	if c.Similarity.MaxEmails < 0 {
+		return fmt.Errorf("similarity max emails must not be negative")
+	}
+	if c.Similarity.Workers < 0 {
+		return fmt.Errorf("similarity workers must not be negative")
+	}
+
 	return nil
 }
 
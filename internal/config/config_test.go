@@ -1,9 +1,11 @@
 package config
 
 import (
+	"mailboxzero/internal/similarity"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestLoad(t *testing.T) {
@@ -330,6 +332,281 @@ func TestGetServerAddr(t *testing.T) {
 	}
 }
 
+func TestLoad_JournalDefaults(t *testing.T) {
+	tests := []struct {
+		name           string
+		configYAML     string
+		wantPath       string
+		wantMaxEntries int
+		wantErr        bool
+	}{
+		{
+			name: "defaults when journal is omitted",
+			configYAML: `
+server:
+  port: 8080
+mock_mode: true
+`,
+			wantPath:       "archive-journal.json",
+			wantMaxEntries: 50,
+		},
+		{
+			name: "explicit journal settings",
+			configYAML: `
+server:
+  port: 8080
+mock_mode: true
+journal:
+  path: /tmp/undo.json
+  max_entries: 5
+`,
+			wantPath:       "/tmp/undo.json",
+			wantMaxEntries: 5,
+		},
+		{
+			name: "negative max entries",
+			configYAML: `
+server:
+  port: 8080
+mock_mode: true
+journal:
+  max_entries: -1
+`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(configPath, []byte(tt.configYAML), 0644); err != nil {
+				t.Fatalf("Failed to write test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Load() expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() unexpected error = %v", err)
+			}
+
+			if cfg.Journal.Path != tt.wantPath {
+				t.Errorf("Journal.Path = %q, want %q", cfg.Journal.Path, tt.wantPath)
+			}
+			if cfg.Journal.MaxEntries != tt.wantMaxEntries {
+				t.Errorf("Journal.MaxEntries = %d, want %d", cfg.Journal.MaxEntries, tt.wantMaxEntries)
+			}
+		})
+	}
+}
+
+func TestLoad_RetrySettings(t *testing.T) {
+	tests := []struct {
+		name            string
+		retryYAML       string
+		wantMaxAttempts int
+		wantBaseDelay   time.Duration
+		wantMaxDelay    time.Duration
+		wantErr         bool
+	}{
+		{
+			name:            "defaults when retry is omitted",
+			wantMaxAttempts: 4,
+			wantBaseDelay:   500 * time.Millisecond,
+			wantMaxDelay:    30 * time.Second,
+		},
+		{
+			name: "explicit retry settings",
+			retryYAML: `
+retry:
+  max_attempts: 1
+  base_delay: 2s
+  max_delay: 1m
+`,
+			wantMaxAttempts: 1,
+			wantBaseDelay:   2 * time.Second,
+			wantMaxDelay:    time.Minute,
+		},
+		{
+			name: "negative attempts",
+			retryYAML: `
+retry:
+  max_attempts: -1
+`,
+			wantErr: true,
+		},
+		{
+			name: "base delay above max delay",
+			retryYAML: `
+retry:
+  base_delay: 1m
+  max_delay: 1s
+`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configYAML := "server:\n  port: 8080\nmock_mode: true\n" + tt.retryYAML
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(configPath, []byte(configYAML), 0644); err != nil {
+				t.Fatalf("Failed to write test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Load() expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() unexpected error = %v", err)
+			}
+
+			retry := cfg.Retry
+			if retry.MaxAttempts != tt.wantMaxAttempts || retry.BaseDelay != tt.wantBaseDelay || retry.MaxDelay != tt.wantMaxDelay {
+				t.Errorf("Retry = %+v, want %d attempts, %v base, %v max",
+					retry, tt.wantMaxAttempts, tt.wantBaseDelay, tt.wantMaxDelay)
+			}
+		})
+	}
+}
+
+func TestLoad_SimilarityWeights(t *testing.T) {
+	tests := []struct {
+		name        string
+		weightsYAML string
+		want        similarity.Weights
+		wantErr     bool
+	}{
+		{
+			name: "defaults when similarity is omitted",
+			want: similarity.DefaultWeights,
+		},
+		{
+			name: "explicit weights",
+			weightsYAML: `
+similarity:
+  weights:
+    subject: 0.7
+    sender: 0.3
+`,
+			want: similarity.Weights{Subject: 0.7, Sender: 0.3},
+		},
+		{
+			name: "negative weight",
+			weightsYAML: `
+similarity:
+  weights:
+    subject: 1
+    body: -0.5
+`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configYAML := "server:\n  port: 8080\nmock_mode: true\n" + tt.weightsYAML
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(configPath, []byte(configYAML), 0644); err != nil {
+				t.Fatalf("Failed to write test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Load() expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() unexpected error = %v", err)
+			}
+
+			if cfg.Similarity.Weights != tt.want {
+				t.Errorf("Similarity.Weights = %+v, want %+v", cfg.Similarity.Weights, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad_SimilarityLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		want    int
+		wantErr bool
+	}{
+		{name: "default", want: DefaultSimilarityMaxEmails},
+		{name: "explicit", yaml: "similarity:\n  max_emails: 20000\n", want: 20000},
+		{name: "negative", yaml: "similarity:\n  max_emails: -1\n", wantErr: true},
+		{name: "negative workers", yaml: "similarity:\n  workers: -2\n", wantErr: true},
+		{name: "tfidf body scoring", yaml: "similarity:\n  body_scoring: tfidf\n", want: DefaultSimilarityMaxEmails},
+		{name: "unknown body scoring", yaml: "similarity:\n  body_scoring: bm25\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configYAML := "server:\n  port: 8080\nmock_mode: true\n" + tt.yaml
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(configPath, []byte(configYAML), 0644); err != nil {
+				t.Fatalf("Failed to write test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Load() expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() unexpected error = %v", err)
+			}
+
+			if cfg.Similarity.MaxEmails != tt.want {
+				t.Errorf("Similarity.MaxEmails = %d, want %d", cfg.Similarity.MaxEmails, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad_SimilarityFeedbackPath(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want string
+	}{
+		{name: "default", want: "similarity-feedback.json"},
+		{name: "explicit", yaml: "similarity:\n  feedback_path: /var/lib/mailboxzero/feedback.json\n", want: "/var/lib/mailboxzero/feedback.json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configYAML := "server:\n  port: 8080\nmock_mode: true\n" + tt.yaml
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(configPath, []byte(configYAML), 0644); err != nil {
+				t.Fatalf("Failed to write test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if err != nil {
+				t.Fatalf("Load() unexpected error = %v", err)
+			}
+			if cfg.Similarity.FeedbackPath != tt.want {
+				t.Errorf("Similarity.FeedbackPath = %q, want %q", cfg.Similarity.FeedbackPath, tt.want)
+			}
+		})
+	}
+}
+
 // Helper function to check if a string contains a substring
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(substr) == 0 ||
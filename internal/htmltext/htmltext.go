@@ -0,0 +1,183 @@
+// Package htmltext turns email bodies into the plain text a reader sees, for
+// comparing and previewing them
+package htmltext
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+// skippedElements are dropped with everything inside them
+var skippedElements = map[string]bool{
+	"head": true, "title": true, "script": true, "style": true,
+	"noscript": true, "template": true, "svg": true,
+}
+
+// paragraphElements start and end a paragraph
+var paragraphElements = map[string]bool{
+	"p": true, "div": true, "table": true, "ul": true, "ol": true,
+	"blockquote": true, "pre": true, "hr": true, "section": true, "article": true,
+	"header": true, "footer": true, "h1": true, "h2": true, "h3": true,
+	"h4": true, "h5": true, "h6": true,
+}
+
+// lineElements start a line
+var lineElements = map[string]bool{
+	"br": true, "li": true, "tr": true, "dt": true, "dd": true,
+}
+
+// ToText returns the text of an HTML body as a reader would see it. Scripts,
+// styles, comments and hidden elements are dropped, entities decoded and
+// block elements put on lines of their own. Links are reduced to their text
+// and images to their alt text, except tracking pixels, which are dropped.
+// The body is parsed as a browser would, so elements whose end tags are
+// omitted end where a browser ends them.
+func ToText(body string) string {
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		// Only reading the body can fail, and a string never does
+		return Clean(body)
+	}
+
+	var text strings.Builder
+	writeText(&text, doc)
+	return Clean(text.String())
+}
+
+// writeText writes the visible text of n and its children
+func writeText(text *strings.Builder, n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		text.WriteString(n.Data)
+		return
+	case html.CommentNode, html.DoctypeNode:
+		return
+	case html.ElementNode:
+		if skippedElements[n.Data] || hidden(n) {
+			return
+		}
+		switch {
+		case n.Data == "img":
+			if !trackingPixel(n) {
+				text.WriteString(" " + attr(n, "alt") + " ")
+			}
+			return
+		case paragraphElements[n.Data]:
+			text.WriteString("\n\n")
+		case lineElements[n.Data]:
+			text.WriteByte('\n')
+		case n.Data == "td" || n.Data == "th":
+			text.WriteByte(' ')
+		}
+	}
+
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		writeText(text, child)
+	}
+	if n.Type == html.ElementNode && paragraphElements[n.Data] {
+		text.WriteString("\n\n")
+	}
+}
+
+// attr returns the value of the attribute of n with the given name, or ""
+func attr(n *html.Node, name string) string {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// hidden reports whether the element is not displayed
+func hidden(n *html.Node) bool {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == "hidden" {
+			return true
+		}
+	}
+	style := strings.ReplaceAll(strings.ToLower(attr(n, "style")), " ", "")
+	return strings.Contains(style, "display:none") || strings.Contains(style, "visibility:hidden")
+}
+
+// trackingPixel reports whether an image is too small to see, as images that
+// only record that the email was opened are
+func trackingPixel(n *html.Node) bool {
+	for _, name := range []string{"width", "height"} {
+		value := strings.TrimSuffix(strings.TrimSpace(attr(n, name)), "px")
+		if v, err := strconv.Atoi(value); err == nil && v <= 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// links match URLs with the brackets they are often wrapped in
+var links = regexp.MustCompile(`(?i)[<\[(]?\b(?:https?://|www\.)[^\s<>\[\]()]+[>\])]?`)
+
+// StripLinks removes the URLs from text, which are mostly tracking links
+// that differ in every email, and cleans up what is left. It is meant for
+// text that is compared, not for text that is shown.
+func StripLinks(text string) string {
+	return Clean(links.ReplaceAllString(text, ""))
+}
+
+// HasLinks reports whether text may hold URLs for StripLinks to remove. It
+// is much cheaper than stripping them.
+func HasLinks(text string) bool {
+	if strings.Contains(text, "://") {
+		return true
+	}
+	for i := 0; i+4 <= len(text); i++ {
+		if text[i]|0x20 == 'w' && strings.EqualFold(text[i:i+4], "www.") {
+			return true
+		}
+	}
+	return false
+}
+
+// Clean removes the noise plain text bodies share with converted HTML ones:
+// invisible characters and runs of spaces are collapsed, lines trimmed and
+// blank lines between paragraphs kept to one.
+func Clean(text string) string {
+	var lines []string
+	blank := true
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.Join(strings.FieldsFunc(line, isSpace), " ")
+		if line == "" {
+			if !blank {
+				lines = append(lines, "")
+			}
+			blank = true
+			continue
+		}
+		lines = append(lines, line)
+		blank = false
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// isSpace reports spaces and the zero-width characters newsletters pad their
+// preheaders with
+func isSpace(r rune) bool {
+	switch r {
+	case '\u200b', '\u200c', '\u200d', '\u034f', '\u2060', '\ufeff', '\u00ad':
+		return true
+	}
+	return unicode.IsSpace(r)
+}
+
+// IsHTML reports whether a body of unknown type looks like HTML
+func IsHTML(body string) bool {
+	lower := strings.ToLower(body)
+	for _, marker := range []string{"<html", "<body", "<div", "<p>", "<p ", "<br", "<table", "<span", "<a "} {
+		if strings.Contains(lower, marker) {
+			return true
+		}
+	}
+	return false
+}
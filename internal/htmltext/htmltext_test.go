@@ -0,0 +1,163 @@
+package htmltext
+
+import "testing"
+
+func TestToText(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{
+			name: "plain paragraphs",
+			html: "<html><body><p>Hello <b>there</b>,</p><p>Your order has shipped.</p></body></html>",
+			want: "Hello there,\n\nYour order has shipped.",
+		},
+		{
+			name: "head, scripts and styles",
+			html: `<html><head><title>Newsletter</title><style>p { color: red; }</style></head>` +
+				`<body><script type="text/javascript">if (a < b) { track("</p>"); }</script><p>News</p></body></html>`,
+			want: "News",
+		},
+		{
+			name: "comments and doctype",
+			html: "<!DOCTYPE html><!-- <p>old</p> --><p>New</p><!--[if mso]><p>Outlook</p><![endif]-->",
+			want: "New",
+		},
+		{
+			name: "entities",
+			html: "<p>Tom &amp; Jerry&nbsp;&mdash; 50&#37; off &lt;today&gt;</p>",
+			want: "Tom & Jerry — 50% off <today>",
+		},
+		{
+			name: "line breaks and lists",
+			html: "Line one<br>Line two<br/><ul><li>First</li><li>Second</li></ul>",
+			want: "Line one\nLine two\n\nFirst\nSecond",
+		},
+		{
+			name: "table cells",
+			html: "<table><tr><td>Total</td><td>$12.99</td></tr></table>",
+			want: "Total $12.99",
+		},
+		{
+			name: "links keep their text",
+			html: `<p>Read <a href="https://click.example/track?id=1">the full story</a> online</p>`,
+			want: "Read the full story online",
+		},
+		{
+			name: "bare urls are shown",
+			html: "<p>Visit https://example.com/offer?utm_source=mail now</p>",
+			want: "Visit https://example.com/offer?utm_source=mail now",
+		},
+		{
+			name: "tracking pixel",
+			html: `<p>Hi</p><img src="https://t.example/open.gif" width="1" height="1" alt="pixel"><img src="logo.png" alt="Shop logo">`,
+			want: "Hi\n\nShop logo",
+		},
+		{
+			name: "hidden preheader",
+			html: `<div style="display: none; max-height: 0">Preheader &zwnj;&zwnj;</div><div>Body <div hidden>nested <div>deep</div></div>text</div>`,
+			want: "Body text",
+		},
+		{
+			name: "hidden paragraph without end tag",
+			html: `<p style="display:none">Preheader<p>Your order has shipped.<p>Thanks!`,
+			want: "Your order has shipped.\n\nThanks!",
+		},
+		{
+			name: "hidden element closed by its parent",
+			html: `<div><span hidden>Preheader</div><div>Shown</div>`,
+			want: "Shown",
+		},
+		{
+			name: "zero width padding",
+			html: "<p>Sale\u200c\u200c\u200c starts\ufeff now</p>",
+			want: "Sale starts now",
+		},
+		{
+			name: "lone angle bracket",
+			html: "<p>1 < 2 and 3 <3 you</p>",
+			want: "1 < 2 and 3 <3 you",
+		},
+		{
+			name: "unterminated tag",
+			html: `<p>Text<a href="x`,
+			want: "Text",
+		},
+		{
+			name: "uppercase tags",
+			html: "<P>One</P><SCRIPT>x()</SCRIPT><DIV>Two</DIV>",
+			want: "One\n\nTwo",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ToText(tt.html); got != tt.want {
+				t.Errorf("ToText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClean(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "spaces", text: "  a   b \t c  ", want: "a b c"},
+		{name: "blank lines", text: "a\n\n\n\nb\n \nc", want: "a\n\nb\n\nc"},
+		{name: "urls are kept", text: "Unsubscribe:  <https://list.example/u?id=1>", want: "Unsubscribe: <https://list.example/u?id=1>"},
+		{name: "empty", text: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Clean(tt.text); got != tt.want {
+				t.Errorf("Clean(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripLinks(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "bracketed", text: "Unsubscribe: <https://list.example/u?id=1>\nwww.example.com", want: "Unsubscribe:"},
+		{name: "inline", text: "Visit https://example.com/offer?utm_source=mail or [https://t.example/x] now", want: "Visit or now"},
+		{name: "no links", text: "Your order  has shipped", want: "Your order has shipped"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StripLinks(tt.text); got != tt.want {
+				t.Errorf("StripLinks(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+			if got, want := HasLinks(tt.text), tt.name != "no links"; got != want {
+				t.Errorf("HasLinks(%q) = %v, want %v", tt.text, got, want)
+			}
+		})
+	}
+}
+
+func TestIsHTML(t *testing.T) {
+	tests := []struct {
+		body string
+		want bool
+	}{
+		{"<html><body>Hi</body></html>", true},
+		{"<DIV>Hi</DIV>", true},
+		{"Hi,\nsee you at 5 <- or later", false},
+		{"a < b > c", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsHTML(tt.body); got != tt.want {
+			t.Errorf("IsHTML(%q) = %v, want %v", tt.body, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package jmap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// CoreLimits are the request limits a server advertises in the
+// urn:ietf:params:jmap:core capability (RFC 8620 section 2).
+type CoreLimits struct {
+	MaxSizeRequest    int `json:"maxSizeRequest"`
+	MaxCallsInRequest int `json:"maxCallsInRequest"`
+	MaxObjectsInGet   int `json:"maxObjectsInGet"`
+	MaxObjectsInSet   int `json:"maxObjectsInSet"`
+}
+
+// DefaultCoreLimits are used for limits the server does not advertise. They
+// are the minimums RFC 8620 recommends servers support.
+var DefaultCoreLimits = CoreLimits{
+	MaxSizeRequest:    10000000,
+	MaxCallsInRequest: 16,
+	MaxObjectsInGet:   500,
+	MaxObjectsInSet:   500,
+}
+
+// parseCoreLimits reads the core capability of a session, falling back to
+// DefaultCoreLimits for missing or invalid values.
+func parseCoreLimits(capabilities map[string]interface{}) CoreLimits {
+	limits := DefaultCoreLimits
+
+	core, ok := capabilities["urn:ietf:params:jmap:core"].(map[string]interface{})
+	if !ok {
+		return limits
+	}
+
+	set := func(target *int, key string) {
+		if value := getInt(core, key); value > 0 {
+			*target = value
+		}
+	}
+	set(&limits.MaxSizeRequest, "maxSizeRequest")
+	set(&limits.MaxCallsInRequest, "maxCallsInRequest")
+	set(&limits.MaxObjectsInGet, "maxObjectsInGet")
+	set(&limits.MaxObjectsInSet, "maxObjectsInSet")
+
+	return limits
+}
+
+// Limits returns the request limits of the current session
+func (c *Client) Limits() CoreLimits {
+	c.sessionMu.RLock()
+	defer c.sessionMu.RUnlock()
+	return c.limits
+}
+
+// chunkIDs splits ids into consecutive slices of at most size IDs
+func chunkIDs(ids []string, size int) [][]string {
+	if size <= 0 {
+		size = len(ids)
+	}
+
+	var chunks [][]string
+	for start := 0; start < len(ids); start += size {
+		end := start + size
+		if end > len(ids) {
+			end = len(ids)
+		}
+		chunks = append(chunks, ids[start:end])
+	}
+	return chunks
+}
+
+// requestOverhead approximates the bytes a request adds around its method
+// calls (the "using" list and the surrounding object).
+const requestOverhead = 128
+
+// packBatches groups batches of method calls into requests. Calls of one
+// batch always share a request so they can reference each other; a request
+// holds as many batches as fit within maxCalls and maxSize. A batch that is
+// too big on its own is sent alone and left for the server to reject.
+func packBatches(batches [][]MethodCall, maxCalls, maxSize int) ([][]int, error) {
+	var requests [][]int
+	var current []int
+	calls, size := 0, requestOverhead
+
+	for i, batch := range batches {
+		data, err := json.Marshal(batch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %w", err)
+		}
+		batchSize := len(data)
+
+		if len(current) > 0 && (calls+len(batch) > maxCalls || size+batchSize > maxSize) {
+			requests = append(requests, current)
+			current, calls, size = nil, 0, requestOverhead
+		}
+
+		current = append(current, i)
+		calls += len(batch)
+		size += batchSize
+	}
+
+	if len(current) > 0 {
+		requests = append(requests, current)
+	}
+	return requests, nil
+}
+
+// sendBatches sends batches of method calls in as few requests as the session
+// limits allow and calls handle with the response of each batch, or with the
+// error of the request it was part of. Call IDs must be unique across all
+// batches. Sending stops at the first error handle returns.
+func (c *Client) sendBatches(ctx context.Context, batches [][]MethodCall, handle func(batch int, resp *Response, err error) error) error {
+	limits := c.Limits()
+	requests, err := packBatches(batches, limits.MaxCallsInRequest, limits.MaxSizeRequest)
+	if err != nil {
+		return err
+	}
+
+	for _, request := range requests {
+		var methodCalls []MethodCall
+		for _, i := range request {
+			methodCalls = append(methodCalls, batches[i]...)
+		}
+
+		resp, err := c.makeRequest(ctx, methodCalls)
+		for _, i := range request {
+			if err := handle(i, resp, err); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// getEmails fetches the given emails with the properties of request, split
+// into as many Email/get calls as maxObjectsInGet requires. It also returns
+// the Email state reported by the server.
+func (c *Client) getEmails(ctx context.Context, request EmailGetRequest, ids []string) ([]Email, string, error) {
+	chunks := chunkIDs(ids, c.Limits().MaxObjectsInGet)
+
+	batches := make([][]MethodCall, len(chunks))
+	for i, chunk := range chunks {
+		getRequest := request
+		getRequest.IDs = chunk
+		batches[i] = []MethodCall{{"Email/get", getRequest, fmt.Sprintf("get-%d", i)}}
+	}
+
+	var emails []Email
+	var state string
+	err := c.sendBatches(ctx, batches, func(i int, resp *Response, err error) error {
+		if err != nil {
+			return fmt.Errorf("failed to get emails: %w", err)
+		}
+		var result EmailGetResponse
+		if err := resp.methodResult(fmt.Sprintf("get-%d", i), "Email/get", &result); err != nil {
+			return fmt.Errorf("failed to get emails: %w", err)
+		}
+		if state == "" {
+			state = result.State
+		}
+		emails = append(emails, result.List...)
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return emails, state, nil
+}
+
+// queryEmails runs an Email/query and fetches the matching emails in query
+// order. When the page fits in one Email/get it is fetched in the same
+// request through a result reference; bigger pages are fetched afterwards
+// in batches. It returns the Email/query result, the emails and the Email
+// state.
+func (c *Client) queryEmails(ctx context.Context, query EmailQueryRequest) (*EmailQueryResponse, []Email, string, error) {
+	if query.Limit > 0 && query.Limit <= c.Limits().MaxObjectsInGet {
+		getRequest := emailGetRequest(query.AccountID)
+		getRequest.IDsRef = &ResultReference{ResultOf: "0", Name: "Email/query", Path: "/ids"}
+
+		resp, err := c.makeRequest(ctx, []MethodCall{
+			{"Email/query", query, "0"},
+			{"Email/get", getRequest, "1"},
+		})
+		if err != nil {
+			return nil, nil, "", fmt.Errorf("failed to get emails: %w", err)
+		}
+
+		var queryResult EmailQueryResponse
+		if err := resp.methodResult("0", "Email/query", &queryResult); err != nil {
+			return nil, nil, "", fmt.Errorf("failed to query emails: %w", err)
+		}
+		var getResult EmailGetResponse
+		if err := resp.methodResult("1", "Email/get", &getResult); err != nil {
+			return nil, nil, "", fmt.Errorf("failed to get emails: %w", err)
+		}
+
+		return &queryResult, getResult.List, getResult.State, nil
+	}
+
+	resp, err := c.makeRequest(ctx, []MethodCall{
+		{"Email/query", query, "0"},
+	})
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to query emails: %w", err)
+	}
+
+	var queryResult EmailQueryResponse
+	if err := resp.methodResult("0", "Email/query", &queryResult); err != nil {
+		return nil, nil, "", fmt.Errorf("failed to query emails: %w", err)
+	}
+
+	fetched, state, err := c.getEmails(ctx, emailGetRequest(query.AccountID), queryResult.IDs)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	byID := make(map[string]Email, len(fetched))
+	for _, email := range fetched {
+		byID[email.ID] = email
+	}
+	emails := make([]Email, 0, len(queryResult.IDs))
+	for _, id := range queryResult.IDs {
+		if email, ok := byID[id]; ok {
+			emails = append(emails, email)
+		}
+	}
+
+	return &queryResult, emails, state, nil
+}
+
+// batchFailures reports every ID of a batch as failed because the whole
+// request or method call failed.
+func batchFailures(ids []string, err error) []MoveFailure {
+	setErr := SetError{Type: "requestFailed", Description: err.Error()}
+	var methodErr *MethodError
+	if errors.As(err, &methodErr) {
+		setErr = SetError{Type: methodErr.Type, Description: methodErr.Description}
+	}
+
+	failures := make([]MoveFailure, 0, len(ids))
+	for _, id := range ids {
+		failures = append(failures, MoveFailure{ID: id, SetError: setErr})
+	}
+	return failures
+}
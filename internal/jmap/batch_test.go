@@ -0,0 +1,240 @@
+package jmap
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestParseCoreLimits(t *testing.T) {
+	limits := parseCoreLimits(map[string]interface{}{
+		"urn:ietf:params:jmap:core": map[string]interface{}{
+			"maxSizeRequest":    float64(2000000),
+			"maxCallsInRequest": float64(4),
+			"maxObjectsInGet":   float64(0),
+			"maxObjectsInSet":   float64(100),
+		},
+	})
+
+	want := CoreLimits{
+		MaxSizeRequest:    2000000,
+		MaxCallsInRequest: 4,
+		MaxObjectsInGet:   DefaultCoreLimits.MaxObjectsInGet,
+		MaxObjectsInSet:   100,
+	}
+	if limits != want {
+		t.Errorf("parseCoreLimits() = %+v, want %+v", limits, want)
+	}
+
+	if got := parseCoreLimits(nil); got != DefaultCoreLimits {
+		t.Errorf("parseCoreLimits(nil) = %+v, want defaults", got)
+	}
+}
+
+func TestChunkIDs(t *testing.T) {
+	tests := []struct {
+		name string
+		ids  []string
+		size int
+		want [][]string
+	}{
+		{"even split", []string{"a", "b", "c", "d"}, 2, [][]string{{"a", "b"}, {"c", "d"}}},
+		{"remainder", []string{"a", "b", "c"}, 2, [][]string{{"a", "b"}, {"c"}}},
+		{"fits in one", []string{"a", "b"}, 5, [][]string{{"a", "b"}}},
+		{"no limit", []string{"a", "b"}, 0, [][]string{{"a", "b"}}},
+		{"empty", nil, 2, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := chunkIDs(tt.ids, tt.size); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("chunkIDs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPackBatches(t *testing.T) {
+	batch := func(n int) []MethodCall {
+		calls := make([]MethodCall, n)
+		for i := range calls {
+			calls[i] = MethodCall{"Email/set", map[string]interface{}{}, "x"}
+		}
+		return calls
+	}
+
+	tests := []struct {
+		name     string
+		batches  [][]MethodCall
+		maxCalls int
+		maxSize  int
+		want     [][]int
+	}{
+		{
+			name:     "all fit",
+			batches:  [][]MethodCall{batch(2), batch(2)},
+			maxCalls: 16,
+			maxSize:  10000,
+			want:     [][]int{{0, 1}},
+		},
+		{
+			name:     "call limit keeps batches whole",
+			batches:  [][]MethodCall{batch(2), batch(2), batch(2)},
+			maxCalls: 5,
+			maxSize:  10000,
+			want:     [][]int{{0, 1}, {2}},
+		},
+		{
+			name:     "size limit",
+			batches:  [][]MethodCall{batch(1), batch(1), batch(1)},
+			maxCalls: 16,
+			maxSize:  requestOverhead + 60,
+			want:     [][]int{{0, 1}, {2}},
+		},
+		{
+			name:     "oversized batch is sent alone",
+			batches:  [][]MethodCall{batch(1), batch(4), batch(1)},
+			maxCalls: 2,
+			maxSize:  10000,
+			want:     [][]int{{0}, {1}, {2}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := packBatches(tt.batches, tt.maxCalls, tt.maxSize)
+			if err != nil {
+				t.Fatalf("packBatches() unexpected error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("packBatches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_ArchiveEmails_Batched(t *testing.T) {
+	fake := newFakeJMAPServer(t, map[string]fakeMethod{
+		"Mailbox/get": func(args map[string]interface{}) (string, map[string]interface{}) {
+			return "Mailbox/get", map[string]interface{}{
+				"list": []interface{}{
+					fakeMailbox("inbox", "Inbox", "inbox"),
+					fakeMailbox("archive", "Archive", "archive"),
+				},
+			}
+		},
+		"Email/get": func(args map[string]interface{}) (string, map[string]interface{}) {
+			if n := len(idsArg(args)); n > 3 {
+				t.Errorf("Email/get with %d ids exceeds maxObjectsInGet", n)
+			}
+			var list []interface{}
+			for _, id := range idsArg(args) {
+				list = append(list, map[string]interface{}{"id": id, "mailboxIds": map[string]interface{}{"inbox": true}})
+			}
+			return "Email/get", map[string]interface{}{"list": list}
+		},
+		"Email/set": func(args map[string]interface{}) (string, map[string]interface{}) {
+			update := args["update"].(map[string]interface{})
+			if len(update) > 4 {
+				t.Errorf("Email/set with %d updates exceeds maxObjectsInSet", len(update))
+			}
+			if _, ok := update["e4"]; ok {
+				return "error", map[string]interface{}{"type": "serverUnavailable"}
+			}
+			updated := make(map[string]interface{})
+			for id := range update {
+				updated[id] = nil
+			}
+			return "Email/set", map[string]interface{}{"updated": updated}
+		},
+	})
+	fake.core["maxObjectsInGet"] = 3
+	fake.core["maxObjectsInSet"] = 4
+	fake.core["maxCallsInRequest"] = 4
+	client := newFakeClient(t, fake)
+
+	var ids []string
+	for i := 1; i <= 8; i++ {
+		ids = append(ids, fmt.Sprintf("e%d", i))
+	}
+
+	result, err := client.ArchiveEmails(context.Background(), ids, false)
+	if err != nil {
+		t.Fatalf("ArchiveEmails() unexpected error = %v", err)
+	}
+
+	// Batches of three: e1-e3 succeed, e4-e6 fail as a whole, e7-e8 succeed
+	wantMoved := []string{"e1", "e2", "e3", "e7", "e8"}
+	if !reflect.DeepEqual(result.Moved, wantMoved) {
+		t.Errorf("ArchiveEmails() Moved = %v, want %v", result.Moved, wantMoved)
+	}
+	if len(result.Failed) != 3 || result.Failed[0].ID != "e4" || result.Failed[0].Type != "serverUnavailable" {
+		t.Errorf("ArchiveEmails() Failed = %+v, want e4-e6 serverUnavailable", result.Failed)
+	}
+
+	for i, size := range fake.requestSizes {
+		if size > 4 {
+			t.Errorf("request %d has %d method calls, exceeds maxCallsInRequest", i, size)
+		}
+	}
+	if got := len(fake.callsTo("Email/set")); got != 3 {
+		t.Errorf("ArchiveEmails() made %d Email/set calls, want 3", got)
+	}
+
+	history := client.ArchiveHistory(1)
+	if len(history) != 1 || len(history[0].EmailIDs) != len(wantMoved) {
+		t.Errorf("ArchiveHistory() = %+v, want one entry with the moved emails", history)
+	}
+}
+
+func TestClient_GetInboxEmails_Batched(t *testing.T) {
+	var ids []interface{}
+	for i := 1; i <= 7; i++ {
+		ids = append(ids, fmt.Sprintf("e%d", i))
+	}
+
+	fake := newFakeJMAPServer(t, map[string]fakeMethod{
+		"Mailbox/get": func(args map[string]interface{}) (string, map[string]interface{}) {
+			return "Mailbox/get", map[string]interface{}{
+				"list": []interface{}{fakeMailbox("inbox", "Inbox", "inbox")},
+			}
+		},
+		"Email/query": func(args map[string]interface{}) (string, map[string]interface{}) {
+			return "Email/query", map[string]interface{}{"ids": ids, "queryState": "q-1"}
+		},
+		"Email/get": func(args map[string]interface{}) (string, map[string]interface{}) {
+			requested := idsArg(args)
+			if len(requested) > 3 {
+				t.Errorf("Email/get with %d ids exceeds maxObjectsInGet", len(requested))
+			}
+			// Return each chunk in reverse to check the query order is kept
+			var list []interface{}
+			for i := len(requested) - 1; i >= 0; i-- {
+				list = append(list, map[string]interface{}{"id": requested[i], "subject": "s"})
+			}
+			return "Email/get", map[string]interface{}{"list": list, "state": "s-1"}
+		},
+	})
+	fake.core["maxObjectsInGet"] = 3
+	fake.core["maxCallsInRequest"] = 2
+	client := newFakeClient(t, fake)
+
+	emails, err := client.GetInboxEmails(context.Background(), 7)
+	if err != nil {
+		t.Fatalf("GetInboxEmails() unexpected error = %v", err)
+	}
+
+	var got []string
+	for _, email := range emails {
+		got = append(got, email.ID)
+	}
+	want := []string{"e1", "e2", "e3", "e4", "e5", "e6", "e7"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetInboxEmails() = %v, want %v", got, want)
+	}
+
+	if got := len(fake.callsTo("Email/get")); got != 3 {
+		t.Errorf("GetInboxEmails() made %d Email/get calls, want 3", got)
+	}
+}
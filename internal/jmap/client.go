@@ -2,30 +2,52 @@ package jmap
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
+	"log"
 	"net/http"
+	"sync"
 	"time"
 )
 
-// JMAPClient defines the interface for JMAP operations
+// JMAPClient defines the interface for JMAP operations. Methods that talk to
+// the server give up when ctx is cancelled.
 type JMAPClient interface {
-	Authenticate() error
+	Authenticate(ctx context.Context) error
 	GetPrimaryAccount() string
-	GetMailboxes() ([]Mailbox, error)
-	GetInboxEmails(limit int) ([]Email, error)
-	GetInboxEmailsPaginated(limit, offset int) ([]Email, error)
-	GetInboxEmailsWithCount(limit int) (*InboxInfo, error)
-	GetInboxEmailsWithCountPaginated(limit, offset int) (*InboxInfo, error)
-	ArchiveEmails(emailIDs []string, dryRun bool) error
+	GetMailboxes(ctx context.Context) ([]Mailbox, error)
+	GetInboxEmails(ctx context.Context, limit int) ([]Email, error)
+	GetInboxEmailsPaginated(ctx context.Context, limit, offset int) ([]Email, error)
+	GetInboxEmailsWithCount(ctx context.Context, limit int) (*InboxInfo, error)
+	GetInboxEmailsWithCountPaginated(ctx context.Context, limit, offset int) (*InboxInfo, error)
+	GetEmails(ctx context.Context, ids []string) ([]Email, error)
+	GetListedEmails(ctx context.Context, ids []string) ([]Email, error)
+	ArchiveEmails(ctx context.Context, emailIDs []string, dryRun bool) (*MoveResult, error)
+	MoveEmails(ctx context.Context, emailIDs []string, targetMailboxID string, dryRun bool) (*MoveResult, error)
+	UndoArchive(ctx context.Context, entryID string, dryRun bool) (*UndoResult, error)
+	ArchiveHistory(limit int) []JournalEntry
 }
 
 type Client struct {
 	endpoint   string
 	apiToken   string
 	httpClient *http.Client
-	session    *Session
+	journal    *Journal
+
+	// refreshMu serializes session fetches; sessionMu guards the session
+	// and its limits, which are replaced whenever the session is refreshed.
+	refreshMu        sync.Mutex
+	sessionMu        sync.RWMutex
+	session          *Session
+	limits           CoreLimits
+	sessionFetchedAt time.Time
+	sessionRefreshes int
+	sessionErr       string
+	sessionErrAt     time.Time
+
+	retryPolicy RetryPolicy
+	sleep       func(ctx context.Context, d time.Duration) error
 }
 
 type Session struct {
@@ -47,66 +69,112 @@ type Account struct {
 	AccountCapabilities map[string]interface{} `json:"accountCapabilities"`
 }
 
+// Request is the body of an API request (RFC 8620 section 3.3)
 type Request struct {
-	Using  []string `json:"using"`
-	Method string   `json:"methodCalls"`
-	CallID string   `json:"callId,omitempty"`
+	Using       []string     `json:"using"`
+	MethodCalls []MethodCall `json:"methodCalls"`
 }
 
+// MethodCall is a [name, arguments, callId] triple. The arguments are one
+// of the typed request structs, e.g. EmailGetRequest.
 type MethodCall []interface{}
 
 type Response struct {
-	MethodResponses [][]interface{} `json:"methodResponses"`
-	SessionState    string          `json:"sessionState"`
+	MethodResponses []Invocation `json:"methodResponses"`
+	SessionState    string       `json:"sessionState"`
 }
 
-func NewClient(endpoint, apiToken string) *Client {
-	return &Client{
-		endpoint: endpoint,
-		apiToken: apiToken,
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
-	}
+// MethodError is a method-level error returned by the server in place of a
+// normal method response (RFC 8620 section 3.6.2).
+type MethodError struct {
+	Type        string `json:"type"`
+	Description string `json:"description"`
 }
 
-func (c *Client) Authenticate() error {
-	req, err := http.NewRequest("GET", c.endpoint, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create session request: %w", err)
+func (e *MethodError) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("jmap method error: %s - %s", e.Type, e.Description)
 	}
+	return fmt.Sprintf("jmap method error: %s", e.Type)
+}
 
-	req.Header.Set("Authorization", "Bearer "+c.apiToken)
-	req.Header.Set("Accept", "application/json")
+// methodResult decodes the response to the call with the given ID, which
+// must be a response to method name, into v. An "error" response is returned
+// as a *MethodError.
+func (r *Response) methodResult(callID, name string, v interface{}) error {
+	// A call can have several responses, e.g. the implicit Email/set after
+	// an EmailSubmission/set, so other names are only an error on their own
+	unexpected := ""
+	for _, response := range r.MethodResponses {
+		if response.CallID != callID {
+			continue
+		}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to get session: %w", err)
+		switch response.Name {
+		case "error":
+			methodErr := &MethodError{}
+			if err := json.Unmarshal(response.Args, methodErr); err != nil {
+				return fmt.Errorf("failed to decode %s error: %w", name, err)
+			}
+			return methodErr
+		case name:
+			if err := json.Unmarshal(response.Args, v); err != nil {
+				return fmt.Errorf("failed to decode %s response: %w", name, err)
+			}
+			return nil
+		default:
+			if unexpected == "" {
+				unexpected = response.Name
+			}
+		}
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("authentication failed: %d - %s", resp.StatusCode, string(body))
+	if unexpected != "" {
+		return fmt.Errorf("unexpected %s response to %s call %s", unexpected, name, callID)
 	}
+	return fmt.Errorf("no response for call %s", callID)
+}
 
-	var session Session
-	if err := json.NewDecoder(resp.Body).Decode(&session); err != nil {
-		return fmt.Errorf("failed to decode session: %w", err)
+func NewClient(endpoint, apiToken string) *Client {
+	return &Client{
+		endpoint: endpoint,
+		apiToken: apiToken,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		limits:      DefaultCoreLimits,
+		journal:     NewMemoryJournal(DefaultJournalSize),
+		retryPolicy: DefaultRetryPolicy,
+		sleep:       sleepContext,
 	}
+}
+
+// SetJournal replaces the journal archive operations are recorded in
+func (c *Client) SetJournal(journal *Journal) {
+	c.journal = journal
+}
 
-	c.session = &session
-	return nil
+// Authenticate fetches the JMAP session. Later requests refresh it on their
+// own when the server reports a new session state or rejects the token.
+func (c *Client) Authenticate(ctx context.Context) error {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+	return c.loadSession(ctx)
 }
 
-func (c *Client) makeRequest(methodCalls []MethodCall) (*Response, error) {
-	if c.session == nil {
+// makeRequest sends method calls to the API endpoint. Rate limiting,
+// unavailability and network errors are retried according to the retry
+// policy; other failures are returned as a *RequestError. When the session
+// turns out to be stale it is refreshed and the request is sent once more.
+func (c *Client) makeRequest(ctx context.Context, methodCalls []MethodCall) (*Response, error) {
+	session := c.currentSession()
+	if session == nil {
 		return nil, fmt.Errorf("client not authenticated")
 	}
 
-	reqBody := map[string]interface{}{
-		"using":       []string{"urn:ietf:params:jmap:core", "urn:ietf:params:jmap:mail"},
-		"methodCalls": methodCalls,
+	reqBody := Request{
+		Using:       capabilitiesFor(methodCalls),
+		MethodCalls: methodCalls,
 	}
 
 	jsonData, err := json.Marshal(reqBody)
@@ -114,37 +182,71 @@ func (c *Client) makeRequest(methodCalls []MethodCall) (*Response, error) {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", c.session.APIUrl, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Authorization", "Bearer "+c.apiToken)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json")
+	response, err := c.send(ctx, session, jsonData)
+	if isStaleSession(err) {
+		log.Printf("JMAP session looks stale (%v)", err)
+		if err := c.refreshSession(ctx, session); err != nil {
+			return nil, fmt.Errorf("failed to refresh session: %w", err)
+		}
 
-	resp, err := c.httpClient.Do(req)
+		session = c.currentSession()
+		response, err = c.send(ctx, session, jsonData)
+		if isStaleSession(err) {
+			c.setSessionError(err)
+		}
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to make request: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
+	c.clearSessionError()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("request failed: %d - %s", resp.StatusCode, string(body))
+	if response.SessionState != "" && response.SessionState != session.State {
+		if err := c.refreshSession(ctx, session); err != nil {
+			log.Printf("Failed to refresh JMAP session: %v", err)
+		}
 	}
 
+	return response, nil
+}
+
+// send posts a request body to the API URL of session
+func (c *Client) send(ctx context.Context, session *Session, body []byte) (*Response, error) {
 	var response Response
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	err := c.withRetry(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, "POST", session.APIUrl, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+c.apiToken)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to make request: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return newRequestError(resp)
+		}
+
+		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return &response, nil
 }
 
 func (c *Client) GetPrimaryAccount() string {
-	if c.session != nil && c.session.PrimaryAccounts != nil {
-		if accountID, ok := c.session.PrimaryAccounts["urn:ietf:params:jmap:mail"]; ok {
+	if session := c.currentSession(); session != nil && session.PrimaryAccounts != nil {
+		if accountID, ok := session.PrimaryAccounts["urn:ietf:params:jmap:mail"]; ok {
 			return accountID
 		}
 	}
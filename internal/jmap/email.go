@@ -1,7 +1,12 @@
 package jmap
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"mailboxzero/internal/htmltext"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -26,10 +31,167 @@ type Email struct {
 	SentAt        time.Time            `json:"sentAt"`
 	HasAttachment bool                 `json:"hasAttachment"`
 	Preview       string               `json:"preview"`
-	BodyValues    map[string]BodyValue `json:"bodyValues"`
+	BodyValues    map[string]BodyValue `json:"bodyValues,omitempty"`
 	TextBody      []BodyPart           `json:"textBody"`
 	HTMLBody      []BodyPart           `json:"htmlBody"`
 	Attachments   []Attachment         `json:"attachments"`
+
+	// Mailing list headers, fetched as header: properties (RFC 8621
+	// section 4.1.3). ListUnsubscribe holds the URLs of List-Unsubscribe
+	// (RFC 2369); ListUnsubscribePost is "List-Unsubscribe=One-Click" when
+	// the sender supports one-click unsubscribe (RFC 8058).
+	ListID              string   `json:"listId,omitempty"`
+	ListUnsubscribe     []string `json:"listUnsubscribe,omitempty"`
+	ListUnsubscribePost string   `json:"listUnsubscribePost,omitempty"`
+	Precedence          string   `json:"precedence,omitempty"`
+
+	// BodyText is the plain text of the body, derived from the body values
+	// when the email is decoded rather than fetched
+	BodyText string `json:"bodyText,omitempty"`
+}
+
+// Header properties requested with Email/get for the mailing list fields
+const (
+	headerListID              = "header:List-Id:asText"
+	headerListUnsubscribe     = "header:List-Unsubscribe:asURLs"
+	headerListUnsubscribePost = "header:List-Unsubscribe-Post"
+	headerPrecedence          = "header:Precedence"
+)
+
+// UnmarshalJSON decodes an Email/get list entry. A date the server sends in
+// an unexpected format is left zero rather than failing the whole response.
+func (e *Email) UnmarshalJSON(data []byte) error {
+	type plain Email
+	aux := struct {
+		*plain
+		ReceivedAt          string   `json:"receivedAt"`
+		SentAt              string   `json:"sentAt"`
+		ListID              *string  `json:"header:List-Id:asText"`
+		ListUnsubscribe     []string `json:"header:List-Unsubscribe:asURLs"`
+		ListUnsubscribePost *string  `json:"header:List-Unsubscribe-Post"`
+		Precedence          *string  `json:"header:Precedence"`
+	}{plain: (*plain)(e)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	e.ReceivedAt = parseDate(aux.ReceivedAt)
+	e.SentAt = parseDate(aux.SentAt)
+
+	// Values already decoded from the API field names are kept when the
+	// header properties are absent, so Email round-trips through its own JSON
+	if aux.ListID != nil {
+		e.ListID = strings.TrimSpace(*aux.ListID)
+	}
+	if aux.ListUnsubscribe != nil {
+		e.ListUnsubscribe = aux.ListUnsubscribe
+	}
+	if aux.ListUnsubscribePost != nil {
+		e.ListUnsubscribePost = strings.TrimSpace(*aux.ListUnsubscribePost)
+	}
+	if aux.Precedence != nil {
+		e.Precedence = strings.TrimSpace(*aux.Precedence)
+	}
+	if e.BodyText == "" {
+		e.BodyText = e.bodyText()
+	}
+	return nil
+}
+
+// PlainText returns the plain text of the body, or "" if no body values were
+// fetched
+func (e Email) PlainText() string {
+	if e.BodyText != "" {
+		return e.BodyText
+	}
+	return e.bodyText()
+}
+
+// bodyText converts the body values to plain text. Text parts are preferred
+// to HTML ones, which are converted; parts are taken in textBody or htmlBody
+// order, or by part ID if neither lists them, so the text does not depend on
+// map order.
+func (e Email) bodyText() string {
+	if len(e.BodyValues) == 0 {
+		return ""
+	}
+
+	for _, parts := range [][]BodyPart{e.TextBody, e.HTMLBody} {
+		var texts []string
+		for _, part := range parts {
+			value, ok := e.BodyValues[part.PartID]
+			if !ok {
+				continue
+			}
+			if text := partText(value.Value, strings.EqualFold(part.Type, "text/html")); text != "" {
+				texts = append(texts, text)
+			}
+		}
+		if len(texts) > 0 {
+			return strings.Join(texts, "\n\n")
+		}
+	}
+
+	ids := make([]string, 0, len(e.BodyValues))
+	for id := range e.BodyValues {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var texts []string
+	for _, id := range ids {
+		value := e.BodyValues[id].Value
+		if text := partText(value, htmltext.IsHTML(value)); text != "" {
+			texts = append(texts, text)
+		}
+	}
+	return strings.Join(texts, "\n\n")
+}
+
+func partText(value string, isHTML bool) string {
+	if isHTML {
+		return htmltext.ToText(value)
+	}
+	return htmltext.Clean(value)
+}
+
+// ListIdentifier returns the identifier of the mailing list the email was
+// sent through: the part of List-Id between angle brackets, lower-cased
+// ("news.example.com" for "Example News <news.example.com>"). It is empty
+// for email that did not come through a list.
+func (e Email) ListIdentifier() string {
+	id := e.ListID
+	if start := strings.LastIndex(id, "<"); start >= 0 {
+		id = id[start+1:]
+		if end := strings.Index(id, ">"); end >= 0 {
+			id = id[:end]
+		}
+	}
+	return strings.ToLower(strings.TrimSpace(id))
+}
+
+// IsBulk reports whether the email is newsletter or other bulk traffic: it
+// came through a mailing list, offers an unsubscribe link, or is marked with
+// a bulk, list or junk precedence.
+func (e Email) IsBulk() bool {
+	if e.ListID != "" || len(e.ListUnsubscribe) > 0 {
+		return true
+	}
+	switch strings.ToLower(e.Precedence) {
+	case "bulk", "list", "junk":
+		return true
+	}
+	return false
+}
+
+// parseDate parses a JMAP Date or UTCDate, returning zero if it is invalid
+func parseDate(value string) time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
 }
 
 type EmailAddress struct {
@@ -37,6 +199,12 @@ type EmailAddress struct {
 	Email string `json:"email"`
 }
 
+// EmailHeader is a raw header field of a message or body part
+type EmailHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
 type BodyValue struct {
 	Value             string `json:"value"`
 	IsEncodingProblem bool   `json:"isEncodingProblem"`
@@ -44,30 +212,30 @@ type BodyValue struct {
 }
 
 type BodyPart struct {
-	PartID      string            `json:"partId"`
-	BlobID      string            `json:"blobId"`
-	Size        int               `json:"size"`
-	Headers     map[string]string `json:"headers"`
-	Name        string            `json:"name"`
-	Type        string            `json:"type"`
-	Charset     string            `json:"charset"`
-	Disposition string            `json:"disposition"`
-	CID         string            `json:"cid"`
-	Language    []string          `json:"language"`
-	Location    string            `json:"location"`
-	SubParts    []BodyPart        `json:"subParts"`
+	PartID      string        `json:"partId"`
+	BlobID      string        `json:"blobId"`
+	Size        int           `json:"size"`
+	Headers     []EmailHeader `json:"headers"`
+	Name        string        `json:"name"`
+	Type        string        `json:"type"`
+	Charset     string        `json:"charset"`
+	Disposition string        `json:"disposition"`
+	CID         string        `json:"cid"`
+	Language    []string      `json:"language"`
+	Location    string        `json:"location"`
+	SubParts    []BodyPart    `json:"subParts"`
 }
 
 type Attachment struct {
-	PartID      string            `json:"partId"`
-	BlobID      string            `json:"blobId"`
-	Size        int               `json:"size"`
-	Name        string            `json:"name"`
-	Type        string            `json:"type"`
-	Charset     string            `json:"charset"`
-	Disposition string            `json:"disposition"`
-	CID         string            `json:"cid"`
-	Headers     map[string]string `json:"headers"`
+	PartID      string        `json:"partId"`
+	BlobID      string        `json:"blobId"`
+	Size        int           `json:"size"`
+	Name        string        `json:"name"`
+	Type        string        `json:"type"`
+	Charset     string        `json:"charset"`
+	Disposition string        `json:"disposition"`
+	CID         string        `json:"cid"`
+	Headers     []EmailHeader `json:"headers"`
 }
 
 type Mailbox struct {
@@ -96,69 +264,46 @@ type Rights struct {
 	MaySubmit      bool `json:"maySubmit"`
 }
 
-func (c *Client) GetMailboxes() ([]Mailbox, error) {
+func (c *Client) GetMailboxes(ctx context.Context) ([]Mailbox, error) {
+	mailboxes, _, err := c.getMailboxes(ctx)
+	return mailboxes, err
+}
+
+// getMailboxes fetches all mailboxes along with the Mailbox state string.
+func (c *Client) getMailboxes(ctx context.Context) ([]Mailbox, string, error) {
 	accountID := c.GetPrimaryAccount()
 	if accountID == "" {
-		return nil, fmt.Errorf("no primary account found")
+		return nil, "", fmt.Errorf("no primary account found")
 	}
 
 	methodCalls := []MethodCall{
-		{"Mailbox/get", map[string]interface{}{
-			"accountId": accountID,
-		}, "0"},
+		{"Mailbox/get", MailboxGetRequest{AccountID: accountID}, "0"},
 	}
 
-	resp, err := c.makeRequest(methodCalls)
+	resp, err := c.makeRequest(ctx, methodCalls)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get mailboxes: %w", err)
-	}
-
-	if len(resp.MethodResponses) == 0 {
-		return nil, fmt.Errorf("no response received")
-	}
-
-	response := resp.MethodResponses[0]
-	if len(response) < 2 {
-		return nil, fmt.Errorf("invalid response format")
-	}
-
-	responseData, ok := response[1].(map[string]interface{})
-	if !ok {
-		return nil, fmt.Errorf("invalid response data format")
-	}
-
-	mailboxesData, ok := responseData["list"].([]interface{})
-	if !ok {
-		return nil, fmt.Errorf("invalid mailboxes data format")
+		return nil, "", fmt.Errorf("failed to get mailboxes: %w", err)
 	}
 
-	var mailboxes []Mailbox
-	for _, item := range mailboxesData {
-		mailboxData, _ := item.(map[string]interface{})
-		mailbox := Mailbox{
-			ID:           getString(mailboxData, "id"),
-			Name:         getString(mailboxData, "name"),
-			Role:         getString(mailboxData, "role"),
-			TotalEmails:  getInt(mailboxData, "totalEmails"),
-			UnreadEmails: getInt(mailboxData, "unreadEmails"),
-		}
-		mailboxes = append(mailboxes, mailbox)
+	var result MailboxGetResponse
+	if err := resp.methodResult("0", "Mailbox/get", &result); err != nil {
+		return nil, "", fmt.Errorf("failed to get mailboxes: %w", err)
 	}
 
-	return mailboxes, nil
+	return result.List, result.State, nil
 }
 
-func (c *Client) GetInboxEmails(limit int) ([]Email, error) {
-	return c.GetInboxEmailsPaginated(limit, 0)
+func (c *Client) GetInboxEmails(ctx context.Context, limit int) ([]Email, error) {
+	return c.GetInboxEmailsPaginated(ctx, limit, 0)
 }
 
-func (c *Client) GetInboxEmailsPaginated(limit, offset int) ([]Email, error) {
+func (c *Client) GetInboxEmailsPaginated(ctx context.Context, limit, offset int) ([]Email, error) {
 	accountID := c.GetPrimaryAccount()
 	if accountID == "" {
 		return nil, fmt.Errorf("no primary account found")
 	}
 
-	mailboxes, err := c.GetMailboxes()
+	mailboxes, err := c.GetMailboxes(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get mailboxes: %w", err)
 	}
@@ -175,68 +320,124 @@ func (c *Client) GetInboxEmailsPaginated(limit, offset int) ([]Email, error) {
 		return nil, fmt.Errorf("inbox not found")
 	}
 
-	queryParams := map[string]interface{}{
-		"accountId": accountID,
-		"filter": map[string]interface{}{
-			"inMailbox": inboxID,
-		},
-		"sort": []map[string]interface{}{
-			{"property": "receivedAt", "isAscending": false},
-		},
-		"limit": limit,
-	}
+	query := inboxQuery(accountID, inboxID)
+	query.Limit = limit
+	query.Position = offset
 
-	if offset > 0 {
-		queryParams["position"] = offset
+	_, emails, _, err := c.queryEmails(ctx, query)
+	if err != nil {
+		return nil, err
 	}
 
-	methodCalls := []MethodCall{
-		{"Email/query", queryParams, "0"},
-		{"Email/get", map[string]interface{}{
-			"accountId": accountID,
-			"#ids":      map[string]interface{}{"resultOf": "0", "name": "Email/query", "path": "/ids"},
-			"properties": []string{
-				"id", "subject", "from", "to", "receivedAt", "preview", "hasAttachment", "mailboxIds", "keywords",
-				"bodyValues", "textBody", "htmlBody",
-			},
-			"bodyProperties":      []string{"value", "isEncodingProblem", "isTruncated"},
-			"fetchTextBodyValues": true,
-			"fetchHTMLBodyValues": true,
-			"maxBodyValueBytes":   50000,
-		}, "1"},
-	}
-
-	resp, err := c.makeRequest(methodCalls)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get emails: %w", err)
+	return emails, nil
+}
+
+// inboxQuery returns the Email/query filter and sort used for the inbox
+// listing. Email/queryChanges must be called with exactly the same filter and
+// sort.
+func inboxQuery(accountID, inboxID string) EmailQueryRequest {
+	return EmailQueryRequest{
+		AccountID: accountID,
+		Filter:    &EmailFilter{InMailbox: inboxID},
+		Sort:      []Comparator{{Property: "receivedAt", IsAscending: false}},
 	}
+}
+
+// emailProperties are the Email properties fetched for the inbox listing:
+// what the UI and the API's listings show (recipients, attachment and
+// keyword flags included) and what similarity, grouping and unsubscribing
+// read.
+var emailProperties = []string{
+	"id", "threadId", "mailboxIds", "keywords", "receivedAt", "from", "to",
+	"subject", "preview", "hasAttachment", "bodyValues", "textBody", "htmlBody",
+	headerListID, headerListUnsubscribe, headerListUnsubscribePost, headerPrecedence,
+}
+
+// bodyProperties are the EmailBodyPart properties fetched for textBody and
+// htmlBody in the listing, enough to pick and convert the body values
+var bodyProperties = []string{"partId", "type"}
+
+// emailDetailProperties are the Email properties fetched by GetEmails:
+// everything Email holds.
+var emailDetailProperties = []string{
+	"id", "blobId", "threadId", "mailboxIds", "keywords", "size", "receivedAt",
+	"messageId", "inReplyTo", "references", "sender", "from", "to", "cc", "bcc", "replyTo",
+	"subject", "sentAt", "hasAttachment", "preview",
+	"bodyValues", "textBody", "htmlBody", "attachments",
+	headerListID, headerListUnsubscribe, headerListUnsubscribePost, headerPrecedence,
+}
+
+// bodyDetailProperties are the EmailBodyPart properties fetched by GetEmails
+// for textBody, htmlBody and attachments
+var bodyDetailProperties = []string{
+	"partId", "blobId", "size", "headers", "name", "type", "charset", "disposition", "cid", "language", "location",
+}
 
-	if len(resp.MethodResponses) < 2 {
-		return nil, fmt.Errorf("insufficient responses received")
+// listBodyValueBytes is how much of each body value is fetched for the inbox
+// listing. Similarity only compares the start of bodies, and thousands of
+// emails are listed at once.
+const listBodyValueBytes = 2048
+
+// emailGetRequest returns the Email/get arguments for fetching inbox emails,
+// without the ids to fetch.
+func emailGetRequest(accountID string) EmailGetRequest {
+	return EmailGetRequest{
+		AccountID:           accountID,
+		Properties:          emailProperties,
+		BodyProperties:      bodyProperties,
+		FetchTextBodyValues: true,
+		FetchHTMLBodyValues: true,
+		MaxBodyValueBytes:   listBodyValueBytes,
 	}
+}
 
-	emailGetResponse := resp.MethodResponses[1]
-	if len(emailGetResponse) < 2 {
-		return nil, fmt.Errorf("invalid email get response format")
+// emailDetailRequest returns the Email/get arguments for fetching emails with
+// all their details, without the ids to fetch.
+func emailDetailRequest(accountID string) EmailGetRequest {
+	return EmailGetRequest{
+		AccountID:           accountID,
+		Properties:          emailDetailProperties,
+		BodyProperties:      bodyDetailProperties,
+		FetchTextBodyValues: true,
+		FetchHTMLBodyValues: true,
+		MaxBodyValueBytes:   50000,
 	}
+}
 
-	responseData, ok := emailGetResponse[1].(map[string]interface{})
-	if !ok {
-		return nil, fmt.Errorf("invalid response data format")
+// GetEmails fetches emails by ID with all their details, wherever they are.
+// IDs the server does not know are left out.
+func (c *Client) GetEmails(ctx context.Context, ids []string) ([]Email, error) {
+	accountID := c.GetPrimaryAccount()
+	if accountID == "" {
+		return nil, fmt.Errorf("no primary account found")
+	}
+	if len(ids) == 0 {
+		return []Email{}, nil
 	}
 
-	emailsData, ok := responseData["list"].([]interface{})
-	if !ok {
-		return nil, fmt.Errorf("invalid emails data format")
+	emails, _, err := c.getEmails(ctx, emailDetailRequest(accountID), ids)
+	if err != nil {
+		return nil, err
 	}
+	return emails, nil
+}
 
-	var emails []Email
-	for _, item := range emailsData {
-		emailData, _ := item.(map[string]interface{})
-		email := parseEmail(emailData)
-		emails = append(emails, email)
+// GetListedEmails fetches emails by ID as the inbox listing has them, with
+// the listed properties and the start of their bodies, wherever they are.
+// IDs the server does not know are left out.
+func (c *Client) GetListedEmails(ctx context.Context, ids []string) ([]Email, error) {
+	accountID := c.GetPrimaryAccount()
+	if accountID == "" {
+		return nil, fmt.Errorf("no primary account found")
+	}
+	if len(ids) == 0 {
+		return []Email{}, nil
 	}
 
+	emails, _, err := c.getEmails(ctx, emailGetRequest(accountID), ids)
+	if err != nil {
+		return nil, err
+	}
 	return emails, nil
 }
 
@@ -245,17 +446,17 @@ type InboxInfo struct {
 	TotalCount int     `json:"totalCount"`
 }
 
-func (c *Client) GetInboxEmailsWithCount(limit int) (*InboxInfo, error) {
-	return c.GetInboxEmailsWithCountPaginated(limit, 0)
+func (c *Client) GetInboxEmailsWithCount(ctx context.Context, limit int) (*InboxInfo, error) {
+	return c.GetInboxEmailsWithCountPaginated(ctx, limit, 0)
 }
 
-func (c *Client) GetInboxEmailsWithCountPaginated(limit, offset int) (*InboxInfo, error) {
+func (c *Client) GetInboxEmailsWithCountPaginated(ctx context.Context, limit, offset int) (*InboxInfo, error) {
 	accountID := c.GetPrimaryAccount()
 	if accountID == "" {
 		return nil, fmt.Errorf("no primary account found")
 	}
 
-	mailboxes, err := c.GetMailboxes()
+	mailboxes, err := c.GetMailboxes(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get mailboxes: %w", err)
 	}
@@ -274,7 +475,7 @@ func (c *Client) GetInboxEmailsWithCountPaginated(limit, offset int) (*InboxInfo
 		return nil, fmt.Errorf("inbox not found")
 	}
 
-	emails, err := c.GetInboxEmailsPaginated(limit, offset)
+	emails, err := c.GetInboxEmailsPaginated(ctx, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get inbox emails: %w", err)
 	}
@@ -285,126 +486,328 @@ func (c *Client) GetInboxEmailsWithCountPaginated(limit, offset int) (*InboxInfo
 	}, nil
 }
 
-func (c *Client) ArchiveEmails(emailIDs []string, dryRun bool) error {
+// SetError is a per-object error from a /set method (RFC 8620 section 5.3),
+// e.g. notFound, forbidden or tooLarge.
+type SetError struct {
+	Type        string `json:"type"`
+	Description string `json:"description,omitempty"`
+}
+
+// MoveFailure is an email the server refused to move
+type MoveFailure struct {
+	ID string `json:"id"`
+	SetError
+}
+
+// MoveResult reports which emails were moved and which were not
+type MoveResult struct {
+	Moved     []string      `json:"moved"`
+	Failed    []MoveFailure `json:"failed"`
+	JournalID string        `json:"journalId,omitempty"`
+}
+
+func (c *Client) ArchiveEmails(ctx context.Context, emailIDs []string, dryRun bool) (*MoveResult, error) {
 	if dryRun {
 		fmt.Printf("[DRY RUN] Would archive %d emails: %v\n", len(emailIDs), emailIDs)
-		return nil
-	}
-
-	accountID := c.GetPrimaryAccount()
-	if accountID == "" {
-		return fmt.Errorf("no primary account found")
+		return &MoveResult{Moved: emailIDs, Failed: []MoveFailure{}}, nil
 	}
 
-	mailboxes, err := c.GetMailboxes()
+	mailboxes, err := c.GetMailboxes(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get mailboxes: %w", err)
+		return nil, fmt.Errorf("failed to get mailboxes: %w", err)
 	}
 
-	var inboxID, archiveID string
+	var archiveID string
 	for _, mb := range mailboxes {
-		if mb.Role == "inbox" {
-			inboxID = mb.ID
-		}
 		if mb.Role == "archive" {
 			archiveID = mb.ID
+			break
 		}
 	}
 
-	if inboxID == "" {
-		return fmt.Errorf("inbox not found")
-	}
 	if archiveID == "" {
-		return fmt.Errorf("archive folder not found")
+		return nil, fmt.Errorf("archive folder not found")
 	}
 
-	updates := make(map[string]interface{})
-	for _, emailID := range emailIDs {
-		updates[emailID] = map[string]interface{}{
-			"mailboxIds": map[string]bool{
-				archiveID: true,
-			},
-		}
+	inboxID, err := checkMove(mailboxes, archiveID)
+	if err != nil {
+		return nil, err
 	}
 
-	methodCalls := []MethodCall{
-		{"Email/set", map[string]interface{}{
-			"accountId": accountID,
-			"update":    updates,
-		}, "0"},
+	return c.moveEmails(ctx, emailIDs, inboxID, archiveID)
+}
+
+// MoveEmails moves inbox emails to the given mailbox. The move is refused
+// with ErrMailboxNotWritable when the user may not remove emails from the
+// inbox or add them to the target.
+func (c *Client) MoveEmails(ctx context.Context, emailIDs []string, targetMailboxID string, dryRun bool) (*MoveResult, error) {
+	mailboxes, err := c.GetMailboxes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mailboxes: %w", err)
 	}
 
-	_, err = c.makeRequest(methodCalls)
+	inboxID, err := checkMove(mailboxes, targetMailboxID)
 	if err != nil {
-		return fmt.Errorf("failed to archive emails: %w", err)
+		return nil, err
 	}
 
-	return nil
+	if dryRun {
+		fmt.Printf("[DRY RUN] Would move %d emails to %s: %v\n", len(emailIDs), targetMailboxID, emailIDs)
+		return &MoveResult{Moved: emailIDs, Failed: []MoveFailure{}}, nil
+	}
+
+	return c.moveEmails(ctx, emailIDs, inboxID, targetMailboxID)
 }
 
-func parseEmail(data map[string]interface{}) Email {
-	email := Email{
-		ID:      getString(data, "id"),
-		Subject: getString(data, "subject"),
-		Preview: getString(data, "preview"),
+// moveEmails moves the given emails from the inbox to the target and journals
+// their previous mailboxes. Callers check the move with checkMove.
+func (c *Client) moveEmails(ctx context.Context, emailIDs []string, inboxID, targetMailboxID string) (*MoveResult, error) {
+	accountID := c.GetPrimaryAccount()
+	if accountID == "" {
+		return nil, fmt.Errorf("no primary account found")
+	}
+
+	patch := movePatch(inboxID, targetMailboxID)
+	result, original, err := c.updateEmails(ctx, accountID, emailIDs, func(string) PatchObject {
+		return patch
+	}, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to move emails: %w", err)
 	}
 
-	if receivedAtStr := getString(data, "receivedAt"); receivedAtStr != "" {
-		if t, err := time.Parse(time.RFC3339, receivedAtStr); err == nil {
-			email.ReceivedAt = t
+	c.recordMove(result, inboxID, targetMailboxID, original)
+
+	return result, nil
+}
+
+// updateEmails applies an Email/set patch to each email, split into batches
+// that respect maxObjectsInSet and maxCallsInRequest. With fetchMailboxes
+// each batch first reads the emails' current mailboxIds in the same request,
+// so the change can be undone. A batch whose request or method call fails is
+// reported as failed for all of its emails; an error is only returned when
+// nothing could be updated at all.
+func (c *Client) updateEmails(ctx context.Context, accountID string, emailIDs []string, patch func(id string) PatchObject, fetchMailboxes bool) (*MoveResult, map[string]map[string]bool, error) {
+	limits := c.Limits()
+	size := limits.MaxObjectsInSet
+	if fetchMailboxes && limits.MaxObjectsInGet < size {
+		size = limits.MaxObjectsInGet
+	}
+	chunks := chunkIDs(emailIDs, size)
+
+	batches := make([][]MethodCall, len(chunks))
+	for i, chunk := range chunks {
+		updates := make(map[string]PatchObject, len(chunk))
+		for _, id := range chunk {
+			updates[id] = patch(id)
 		}
-	}
 
-	if fromData, ok := data["from"].([]interface{}); ok && len(fromData) > 0 {
-		if fromMap, ok := fromData[0].(map[string]interface{}); ok {
-			email.From = []EmailAddress{{
-				Name:  getString(fromMap, "name"),
-				Email: getString(fromMap, "email"),
-			}}
+		if fetchMailboxes {
+			batches[i] = append(batches[i], MethodCall{"Email/get", EmailGetRequest{
+				AccountID:  accountID,
+				IDs:        chunk,
+				Properties: []string{"id", "mailboxIds"},
+			}, fmt.Sprintf("get-%d", i)})
 		}
+		batches[i] = append(batches[i], MethodCall{"Email/set", EmailSetRequest{
+			AccountID: accountID,
+			Update:    updates,
+		}, fmt.Sprintf("set-%d", i)})
 	}
 
-	// Parse textBody structure first
-	if textBodyData, ok := data["textBody"].([]interface{}); ok {
-		for _, part := range textBodyData {
-			if partMap, ok := part.(map[string]interface{}); ok {
-				email.TextBody = append(email.TextBody, BodyPart{
-					PartID: getString(partMap, "partId"),
-					Type:   getString(partMap, "type"),
-				})
+	result := &MoveResult{
+		Moved:  []string{},
+		Failed: []MoveFailure{},
+	}
+	original := make(map[string]map[string]bool)
+	var firstErr error
+
+	err := c.sendBatches(ctx, batches, func(i int, resp *Response, err error) error {
+		var setResult EmailSetResponse
+		if err == nil {
+			err = resp.methodResult(fmt.Sprintf("set-%d", i), "Email/set", &setResult)
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
 			}
+			result.Failed = append(result.Failed, batchFailures(chunks[i], err)...)
+			return nil
 		}
-	}
 
-	// Parse htmlBody structure
-	if htmlBodyData, ok := data["htmlBody"].([]interface{}); ok {
-		for _, part := range htmlBodyData {
-			if partMap, ok := part.(map[string]interface{}); ok {
-				email.HTMLBody = append(email.HTMLBody, BodyPart{
-					PartID: getString(partMap, "partId"),
-					Type:   getString(partMap, "type"),
-				})
+		part := parseMoveResult(chunks[i], setResult)
+		result.Moved = append(result.Moved, part.Moved...)
+		result.Failed = append(result.Failed, part.Failed...)
+
+		if fetchMailboxes {
+			var getResult EmailGetResponse
+			if err := resp.methodResult(fmt.Sprintf("get-%d", i), "Email/get", &getResult); err == nil {
+				for _, email := range getResult.List {
+					original[email.ID] = email.MailboxIDs
+				}
 			}
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// Parse bodyValues
-	if bodyValues, ok := data["bodyValues"].(map[string]interface{}); ok {
-		email.BodyValues = make(map[string]BodyValue)
-		for key, value := range bodyValues {
-			if bodyMap, ok := value.(map[string]interface{}); ok {
-				email.BodyValues[key] = BodyValue{
-					Value:             getString(bodyMap, "value"),
-					IsEncodingProblem: getBool(bodyMap, "isEncodingProblem"),
-					IsTruncated:       getBool(bodyMap, "isTruncated"),
-				}
+	if len(result.Moved) == 0 && firstErr != nil {
+		return nil, nil, firstErr
+	}
+	return result, original, nil
+}
+
+// movePatch returns an Email/set update that takes an email out of one
+// mailbox and into another using patch syntax (RFC 8620 section 5.3), so any
+// other mailboxes (labels) the email is in are kept.
+func movePatch(fromMailboxID, toMailboxID string) PatchObject {
+	return PatchObject{
+		"mailboxIds/" + fromMailboxID: nil,
+		"mailboxIds/" + toMailboxID:   true,
+	}
+}
+
+// undoPatch returns an Email/set update that reverses a journaled move: the
+// email is put back in every mailbox it was in and taken out of the target.
+// Mailboxes added since the move are left alone. Emails journaled without
+// their mailboxes are put back in the inbox, as recordMove assumes, so the
+// update never leaves them in no mailbox at all. Entries journaled without a
+// target fall back to replacing mailboxIds entirely.
+func undoPatch(original map[string]bool, target, inboxID string) PatchObject {
+	if len(original) == 0 {
+		original = map[string]bool{inboxID: true}
+	}
+	if target == "" {
+		return PatchObject{"mailboxIds": original}
+	}
+
+	patch := make(PatchObject, len(original)+1)
+	for id := range original {
+		patch["mailboxIds/"+id] = true
+	}
+	if !original[target] {
+		patch["mailboxIds/"+target] = nil
+	}
+	return patch
+}
+
+// recordMove journals the moved emails with the mailboxes they were in.
+// Emails whose mailboxes could not be read are assumed to have been in the
+// inbox only.
+func (c *Client) recordMove(result *MoveResult, inboxID, target string, original map[string]map[string]bool) {
+	if len(result.Moved) == 0 {
+		return
+	}
+
+	mailboxIDs := make(map[string]map[string]bool, len(result.Moved))
+	for _, id := range result.Moved {
+		mailboxIDs[id] = original[id]
+		if len(mailboxIDs[id]) == 0 {
+			mailboxIDs[id] = map[string]bool{inboxID: true}
+		}
+	}
+
+	entry, err := c.journal.Record(result.Moved, target, mailboxIDs)
+	if err != nil {
+		// The move already happened; losing the undo record is not fatal
+		fmt.Printf("Failed to record move in journal: %v\n", err)
+		return
+	}
+	result.JournalID = entry.ID
+}
+
+// ArchiveHistory returns the most recent archive operations, newest first
+func (c *Client) ArchiveHistory(limit int) []JournalEntry {
+	return c.journal.Recent(limit)
+}
+
+// UndoArchive moves the emails of a journaled archive operation back to the
+// mailboxes they were in. An empty entryID undoes the most recent operation.
+func (c *Client) UndoArchive(ctx context.Context, entryID string, dryRun bool) (*UndoResult, error) {
+	entry, err := c.journal.Pending(entryID)
+	if err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		fmt.Printf("[DRY RUN] Would restore %d emails from %s\n", len(entry.EmailIDs), entry.ID)
+		return &UndoResult{EntryID: entry.ID, Restored: entry.EmailIDs, Failed: []MoveFailure{}}, nil
+	}
+
+	accountID := c.GetPrimaryAccount()
+	if accountID == "" {
+		return nil, fmt.Errorf("no primary account found")
+	}
+
+	// The inbox is only looked up for emails journaled without mailboxes
+	var inboxID string
+	if entry.missingMailboxes() {
+		mailboxes, err := c.GetMailboxes(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get mailboxes: %w", err)
+		}
+		for _, mb := range mailboxes {
+			if mb.Role == "inbox" {
+				inboxID = mb.ID
+				break
 			}
 		}
+		if inboxID == "" {
+			return nil, fmt.Errorf("inbox not found")
+		}
+	}
+
+	moved, _, err := c.updateEmails(ctx, accountID, entry.EmailIDs, func(id string) PatchObject {
+		return undoPatch(entry.MailboxIDs[id], entry.Target, inboxID)
+	}, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to undo archive: %w", err)
+	}
+
+	result := &UndoResult{
+		EntryID:  entry.ID,
+		Restored: moved.Moved,
+		Failed:   moved.Failed,
+	}
+
+	if err := c.journal.completeUndo(entry, result); err != nil {
+		fmt.Printf("Failed to update journal: %v\n", err)
+	}
+
+	return result, nil
+}
+
+// parseMoveResult sorts the requested IDs into moved and failed using
+// the updated and notUpdated maps of an Email/set response. IDs the server
+// did not mention at all are reported as failed.
+func parseMoveResult(emailIDs []string, setResult EmailSetResponse) *MoveResult {
+	result := &MoveResult{
+		Moved:  []string{},
+		Failed: []MoveFailure{},
+	}
+
+	for _, id := range emailIDs {
+		if _, ok := setResult.Updated[id]; ok {
+			result.Moved = append(result.Moved, id)
+			continue
+		}
+
+		failure := MoveFailure{ID: id}
+		if setErr, ok := setResult.NotUpdated[id]; ok {
+			failure.SetError = setErr
+		} else {
+			failure.Type = "unknown"
+			failure.Description = "server did not report a result for this email"
+		}
+		result.Failed = append(result.Failed, failure)
 	}
 
-	return email
+	return result
 }
 
+// getString, getInt and getBool read loosely typed JSON such as session
+// capabilities.
 func getString(data map[string]interface{}, key string) string {
 	if value, ok := data[key].(string); ok {
 		return value
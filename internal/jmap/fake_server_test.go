@@ -0,0 +1,222 @@
+package jmap
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeMethod handles one method call and returns the response name and
+// arguments, e.g. ("Email/get", {...}) or ("error", {"type": "..."}).
+type fakeMethod func(args map[string]interface{}) (string, map[string]interface{})
+
+// fakeJMAPServer is a minimal local JMAP server for exercising Client against
+// real HTTP round trips. Result references ("#ids") are resolved before the
+// handler sees the arguments.
+type fakeJMAPServer struct {
+	*httptest.Server
+
+	// core is advertised as the urn:ietf:params:jmap:core capability
+	core map[string]interface{}
+
+	mu           sync.Mutex
+	methods      map[string]fakeMethod
+	calls        []fakeCall
+	requests     int
+	requestSizes []int // method calls per request
+
+	sessionState   string
+	apiPath        string
+	sessionFetches int
+	rejectAPI      int  // upcoming API requests to answer with 401
+	rejectSession  bool // answer session requests with 401
+}
+
+type fakeCall struct {
+	Name string
+	Args map[string]interface{}
+}
+
+func newFakeJMAPServer(t *testing.T, methods map[string]fakeMethod) *fakeJMAPServer {
+	t.Helper()
+
+	f := &fakeJMAPServer{
+		methods:      methods,
+		core:         map[string]interface{}{},
+		sessionState: "session-1",
+		apiPath:      "/api",
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/session", f.handleSession)
+	mux.HandleFunc("/", f.handleAPI)
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+
+	return f
+}
+
+// newFakeClient returns a Client authenticated against the fake server
+func newFakeClient(t *testing.T, f *fakeJMAPServer) *Client {
+	t.Helper()
+
+	client := NewClient(f.URL+"/session", "test-token")
+	if err := client.Authenticate(context.Background()); err != nil {
+		t.Fatalf("Authenticate() against fake server failed: %v", err)
+	}
+	return client
+}
+
+// rotateSession moves the API to a new URL under a new session state, like a
+// server that changed the session
+func (f *fakeJMAPServer) rotateSession(state, apiPath string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sessionState = state
+	f.apiPath = apiPath
+}
+
+func (f *fakeJMAPServer) handleSession(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sessionFetches++
+
+	if f.rejectSession {
+		http.Error(w, "token expired", http.StatusUnauthorized)
+		return
+	}
+
+	session := map[string]interface{}{
+		"username": "test@example.com",
+		"apiUrl":   f.URL + f.apiPath,
+		"state":    f.sessionState,
+		"capabilities": map[string]interface{}{
+			"urn:ietf:params:jmap:core": f.core,
+			"urn:ietf:params:jmap:mail": map[string]interface{}{},
+		},
+		"accounts": map[string]interface{}{
+			"acc-1": map[string]interface{}{"name": "test@example.com", "isPersonal": true},
+		},
+		"primaryAccounts": map[string]interface{}{
+			"urn:ietf:params:jmap:mail": "acc-1",
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
+
+func (f *fakeJMAPServer) handleAPI(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		MethodCalls [][]json.RawMessage `json:"methodCalls"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.URL.Path != f.apiPath {
+		http.NotFound(w, r)
+		return
+	}
+	if f.rejectAPI > 0 {
+		f.rejectAPI--
+		http.Error(w, "token expired", http.StatusUnauthorized)
+		return
+	}
+	f.requests++
+	f.requestSizes = append(f.requestSizes, len(req.MethodCalls))
+
+	var responses [][]interface{}
+	results := make(map[string]map[string]interface{})
+
+	for _, call := range req.MethodCalls {
+		var name, callID string
+		var args map[string]interface{}
+		json.Unmarshal(call[0], &name)
+		json.Unmarshal(call[1], &args)
+		json.Unmarshal(call[2], &callID)
+
+		resolveReferences(args, results)
+		f.calls = append(f.calls, fakeCall{Name: name, Args: args})
+
+		handler, ok := f.methods[name]
+		if !ok {
+			responses = append(responses, []interface{}{"error", map[string]interface{}{"type": "unknownMethod"}, callID})
+			continue
+		}
+
+		respName, respArgs := handler(args)
+		results[callID] = respArgs
+		responses = append(responses, []interface{}{respName, respArgs, callID})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"methodResponses": responses,
+		"sessionState":    f.sessionState,
+	})
+}
+
+// callsTo returns the arguments of every call made to the given method
+func (f *fakeJMAPServer) callsTo(name string) []map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var args []map[string]interface{}
+	for _, call := range f.calls {
+		if call.Name == name {
+			args = append(args, call.Args)
+		}
+	}
+	return args
+}
+
+func resolveReferences(args map[string]interface{}, results map[string]map[string]interface{}) {
+	for key, value := range args {
+		if !strings.HasPrefix(key, "#") {
+			continue
+		}
+		ref, _ := value.(map[string]interface{})
+		result := results[getString(ref, "resultOf")]
+		path := strings.TrimPrefix(getString(ref, "path"), "/")
+		delete(args, key)
+		args[strings.TrimPrefix(key, "#")] = result[path]
+	}
+}
+
+// idsArg returns the "ids" argument of a call as a string slice
+func idsArg(args map[string]interface{}) []string {
+	return getStringSlice(args, "ids")
+}
+
+// getStringSlice reads a JSON array of strings from decoded arguments
+func getStringSlice(data map[string]interface{}, key string) []string {
+	list, _ := data[key].([]interface{})
+
+	var values []string
+	for _, item := range list {
+		if value, ok := item.(string); ok {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// fakeMailbox returns a Mailbox/get list entry the test user owns
+func fakeMailbox(id, name, role string) map[string]interface{} {
+	return map[string]interface{}{
+		"id":   id,
+		"name": name,
+		"role": role,
+		"myRights": map[string]interface{}{
+			"mayReadItems": true, "mayAddItems": true, "mayRemoveItems": true,
+		},
+	}
+}
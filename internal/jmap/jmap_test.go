@@ -1,6 +1,11 @@
 package jmap
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -134,7 +139,22 @@ func TestGetBool(t *testing.T) {
 	}
 }
 
-func TestParseEmail(t *testing.T) {
+// decodeEmail decodes data the way an Email/get list entry is decoded
+func decodeEmail(t *testing.T, data map[string]interface{}) Email {
+	t.Helper()
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		t.Fatalf("failed to marshal email data: %v", err)
+	}
+	var email Email
+	if err := json.Unmarshal(raw, &email); err != nil {
+		t.Fatalf("failed to decode email: %v", err)
+	}
+	return email
+}
+
+func TestDecodeEmail(t *testing.T) {
 	tests := []struct {
 		name string
 		data map[string]interface{}
@@ -211,23 +231,23 @@ func TestParseEmail(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := parseEmail(tt.data)
+			got := decodeEmail(t, tt.data)
 
 			if got.ID != tt.want.ID {
-				t.Errorf("parseEmail().ID = %v, want %v", got.ID, tt.want.ID)
+				t.Errorf("decodeEmail().ID = %v, want %v", got.ID, tt.want.ID)
 			}
 			if got.Subject != tt.want.Subject {
-				t.Errorf("parseEmail().Subject = %v, want %v", got.Subject, tt.want.Subject)
+				t.Errorf("decodeEmail().Subject = %v, want %v", got.Subject, tt.want.Subject)
 			}
 			if got.Preview != tt.want.Preview {
-				t.Errorf("parseEmail().Preview = %v, want %v", got.Preview, tt.want.Preview)
+				t.Errorf("decodeEmail().Preview = %v, want %v", got.Preview, tt.want.Preview)
 			}
 			if len(tt.want.From) > 0 {
 				if len(got.From) != len(tt.want.From) {
-					t.Errorf("parseEmail().From length = %v, want %v", len(got.From), len(tt.want.From))
+					t.Errorf("decodeEmail().From length = %v, want %v", len(got.From), len(tt.want.From))
 				} else {
 					if got.From[0].Email != tt.want.From[0].Email {
-						t.Errorf("parseEmail().From[0].Email = %v, want %v", got.From[0].Email, tt.want.From[0].Email)
+						t.Errorf("decodeEmail().From[0].Email = %v, want %v", got.From[0].Email, tt.want.From[0].Email)
 					}
 				}
 			}
@@ -348,7 +368,7 @@ func TestClient_MakeRequest_Unauthenticated(t *testing.T) {
 		{"Email/get", map[string]interface{}{"accountId": "test"}, "0"},
 	}
 
-	_, err := client.makeRequest(methodCalls)
+	_, err := client.makeRequest(context.Background(), methodCalls)
 	if err == nil {
 		t.Error("makeRequest() should fail when client not authenticated")
 	}
@@ -360,7 +380,7 @@ func TestClient_MakeRequest_Unauthenticated(t *testing.T) {
 func TestClient_GetInboxEmails(t *testing.T) {
 	// Test with mock client
 	mockClient := NewMockClient()
-	emails, err := mockClient.GetInboxEmails(10)
+	emails, err := mockClient.GetInboxEmails(context.Background(), 10)
 
 	if err != nil {
 		t.Errorf("GetInboxEmails() unexpected error = %v", err)
@@ -374,7 +394,7 @@ func TestClient_GetInboxEmails(t *testing.T) {
 func TestClient_GetInboxEmailsWithCount(t *testing.T) {
 	// Test with mock client
 	mockClient := NewMockClient()
-	info, err := mockClient.GetInboxEmailsWithCount(5)
+	info, err := mockClient.GetInboxEmailsWithCount(context.Background(), 5)
 
 	if err != nil {
 		t.Errorf("GetInboxEmailsWithCount() unexpected error = %v", err)
@@ -398,13 +418,13 @@ func TestClient_ArchiveEmails_DryRun(t *testing.T) {
 	mockClient := NewMockClient()
 
 	// Test dry run
-	err := mockClient.ArchiveEmails([]string{"email-0-0"}, true)
+	_, err := mockClient.ArchiveEmails(context.Background(), []string{"email-0-0"}, true)
 	if err != nil {
 		t.Errorf("ArchiveEmails() dry run unexpected error = %v", err)
 	}
 
 	// Verify email wasn't actually archived
-	emails, _ := mockClient.GetInboxEmails(100)
+	emails, _ := mockClient.GetInboxEmails(context.Background(), 100)
 	found := false
 	for _, email := range emails {
 		if email.ID == "email-0-0" {
@@ -421,24 +441,24 @@ func TestClient_ArchiveEmails_Real(t *testing.T) {
 	mockClient := NewMockClient()
 
 	// Get initial count
-	initialInfo, _ := mockClient.GetInboxEmailsWithCount(100)
+	initialInfo, _ := mockClient.GetInboxEmailsWithCount(context.Background(), 100)
 	initialCount := initialInfo.TotalCount
 
 	// Archive an email
-	err := mockClient.ArchiveEmails([]string{"email-0-0"}, false)
+	_, err := mockClient.ArchiveEmails(context.Background(), []string{"email-0-0"}, false)
 	if err != nil {
 		t.Errorf("ArchiveEmails() unexpected error = %v", err)
 	}
 
 	// Verify email was archived
-	afterInfo, _ := mockClient.GetInboxEmailsWithCount(100)
+	afterInfo, _ := mockClient.GetInboxEmailsWithCount(context.Background(), 100)
 	if afterInfo.TotalCount != initialCount-1 {
 		t.Errorf("ArchiveEmails() inbox count = %d, want %d",
 			afterInfo.TotalCount, initialCount-1)
 	}
 }
 
-func TestParseEmail_ComplexStructures(t *testing.T) {
+func TestDecodeEmail_ComplexStructures(t *testing.T) {
 	data := map[string]interface{}{
 		"id":      "complex-email",
 		"subject": "Test Subject",
@@ -472,73 +492,421 @@ func TestParseEmail_ComplexStructures(t *testing.T) {
 		},
 	}
 
-	email := parseEmail(data)
+	email := decodeEmail(t, data)
 
 	if email.ID != "complex-email" {
-		t.Errorf("parseEmail().ID = %v, want 'complex-email'", email.ID)
+		t.Errorf("decodeEmail().ID = %v, want 'complex-email'", email.ID)
 	}
 
 	if len(email.TextBody) != 2 {
-		t.Errorf("parseEmail() TextBody length = %d, want 2", len(email.TextBody))
+		t.Errorf("decodeEmail() TextBody length = %d, want 2", len(email.TextBody))
 	}
 
 	if len(email.HTMLBody) != 1 {
-		t.Errorf("parseEmail() HTMLBody length = %d, want 1", len(email.HTMLBody))
+		t.Errorf("decodeEmail() HTMLBody length = %d, want 1", len(email.HTMLBody))
 	}
 
 	if len(email.BodyValues) != 2 {
-		t.Errorf("parseEmail() BodyValues length = %d, want 2", len(email.BodyValues))
+		t.Errorf("decodeEmail() BodyValues length = %d, want 2", len(email.BodyValues))
 	}
 
 	// Check specific body value
 	if bodyVal, ok := email.BodyValues["text-part-2"]; ok {
 		if bodyVal.Value != "Second text part" {
-			t.Errorf("parseEmail() BodyValue.Value = %v, want 'Second text part'", bodyVal.Value)
+			t.Errorf("decodeEmail() BodyValue.Value = %v, want 'Second text part'", bodyVal.Value)
 		}
 		if !bodyVal.IsEncodingProblem {
-			t.Error("parseEmail() BodyValue.IsEncodingProblem should be true")
+			t.Error("decodeEmail() BodyValue.IsEncodingProblem should be true")
 		}
 		if !bodyVal.IsTruncated {
-			t.Error("parseEmail() BodyValue.IsTruncated should be true")
+			t.Error("decodeEmail() BodyValue.IsTruncated should be true")
 		}
 	} else {
-		t.Error("parseEmail() should have body value for 'text-part-2'")
+		t.Error("decodeEmail() should have body value for 'text-part-2'")
 	}
 }
 
-func TestParseEmail_MissingFields(t *testing.T) {
+func TestDecodeEmail_MissingFields(t *testing.T) {
 	// Test with minimal data
 	data := map[string]interface{}{
 		"id": "minimal-email",
 	}
 
-	email := parseEmail(data)
+	email := decodeEmail(t, data)
 
 	if email.ID != "minimal-email" {
-		t.Errorf("parseEmail().ID = %v, want 'minimal-email'", email.ID)
+		t.Errorf("decodeEmail().ID = %v, want 'minimal-email'", email.ID)
 	}
 	if email.Subject != "" {
-		t.Errorf("parseEmail().Subject = %v, want empty string", email.Subject)
+		t.Errorf("decodeEmail().Subject = %v, want empty string", email.Subject)
 	}
 	if len(email.From) != 0 {
-		t.Errorf("parseEmail().From length = %d, want 0", len(email.From))
+		t.Errorf("decodeEmail().From length = %d, want 0", len(email.From))
 	}
 	if email.ReceivedAt.IsZero() {
 		// This is expected for missing receivedAt
 	}
 }
 
-func TestParseEmail_InvalidReceivedAt(t *testing.T) {
+func TestDecodeEmail_InvalidReceivedAt(t *testing.T) {
 	data := map[string]interface{}{
 		"id":         "test-id",
 		"receivedAt": "invalid-date-format",
 	}
 
-	email := parseEmail(data)
+	email := decodeEmail(t, data)
 
 	// Should handle invalid date gracefully
 	if !email.ReceivedAt.IsZero() {
-		t.Error("parseEmail() should have zero time for invalid receivedAt")
+		t.Error("decodeEmail() should have zero time for invalid receivedAt")
+	}
+}
+
+func TestClient_GetInboxEmails_AllFields(t *testing.T) {
+	fake := newFakeJMAPServer(t, map[string]fakeMethod{
+		"Mailbox/get": func(args map[string]interface{}) (string, map[string]interface{}) {
+			return "Mailbox/get", map[string]interface{}{
+				"list": []interface{}{fakeMailbox("inbox", "Inbox", "inbox")},
+			}
+		},
+		"Email/query": func(args map[string]interface{}) (string, map[string]interface{}) {
+			return "Email/query", map[string]interface{}{"ids": []interface{}{"e1"}, "queryState": "q-1", "total": 1}
+		},
+		"Email/get": func(args map[string]interface{}) (string, map[string]interface{}) {
+			return "Email/get", map[string]interface{}{"state": "s-1", "list": []interface{}{
+				map[string]interface{}{
+					"id":         "e1",
+					"blobId":     "b1",
+					"threadId":   "t1",
+					"mailboxIds": map[string]interface{}{"inbox": true},
+					"keywords":   map[string]interface{}{"$seen": true},
+					"size":       2048,
+					"receivedAt": "2024-03-01T10:00:00Z",
+					"sentAt":     "2024-03-01T11:59:00+02:00",
+					"messageId":  []interface{}{"m1@example.com"},
+					"from":       []interface{}{map[string]interface{}{"name": "Alice", "email": "alice@example.com"}},
+					"to":         []interface{}{map[string]interface{}{"name": "Bob", "email": "bob@example.com"}},
+					"cc":         []interface{}{map[string]interface{}{"email": "carol@example.com"}},
+					"replyTo":    []interface{}{map[string]interface{}{"email": "noreply@example.com"}},
+					"subject":    "Quarterly report",
+					"textBody": []interface{}{map[string]interface{}{
+						"partId":  "1",
+						"type":    "text/plain",
+						"size":    100,
+						"headers": []interface{}{map[string]interface{}{"name": "Content-Type", "value": "text/plain"}},
+					}},
+					"attachments":   []interface{}{map[string]interface{}{"partId": "2", "name": "report.pdf", "size": 1900}},
+					"hasAttachment": true,
+				},
+			}}
+		},
+	})
+	client := newFakeClient(t, fake)
+
+	emails, err := client.GetInboxEmails(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("GetInboxEmails() unexpected error = %v", err)
+	}
+	if len(emails) != 1 {
+		t.Fatalf("GetInboxEmails() returned %d emails, want 1", len(emails))
+	}
+
+	email := emails[0]
+	if email.ThreadID != "t1" || email.BlobID != "b1" || email.Size != 2048 {
+		t.Errorf("email ids/size = %q %q %d, want t1 b1 2048", email.ThreadID, email.BlobID, email.Size)
+	}
+	if len(email.To) != 1 || email.To[0].Email != "bob@example.com" || len(email.Cc) != 1 || len(email.ReplyTo) != 1 {
+		t.Errorf("email recipients = to %v cc %v replyTo %v", email.To, email.Cc, email.ReplyTo)
+	}
+	if !email.Keywords["$seen"] || !email.MailboxIDs["inbox"] {
+		t.Errorf("email keywords %v, mailboxIds %v", email.Keywords, email.MailboxIDs)
+	}
+	if !email.SentAt.Equal(time.Date(2024, 3, 1, 9, 59, 0, 0, time.UTC)) {
+		t.Errorf("email sentAt = %v", email.SentAt)
+	}
+	if len(email.TextBody) != 1 || email.TextBody[0].Size != 100 || len(email.TextBody[0].Headers) != 1 {
+		t.Errorf("email textBody = %+v", email.TextBody)
+	}
+	if len(email.Attachments) != 1 || email.Attachments[0].Name != "report.pdf" || !email.HasAttachment {
+		t.Errorf("email attachments = %+v, hasAttachment %v", email.Attachments, email.HasAttachment)
+	}
+
+	gets := fake.callsTo("Email/get")
+	if got := getInt(gets[0], "maxBodyValueBytes"); got != listBodyValueBytes {
+		t.Errorf("Email/get maxBodyValueBytes = %d, want %d", got, listBodyValueBytes)
+	}
+	properties := getStringSlice(gets[0], "properties")
+	for _, want := range []string{"threadId", "keywords", "from", "to", "subject", "preview", "hasAttachment", "textBody", "header:List-Id:asText", "header:List-Unsubscribe:asURLs"} {
+		if !containsString(properties, want) {
+			t.Errorf("Email/get properties %v do not include %s", properties, want)
+		}
+	}
+	// Details nothing in the listing reads are left to GetEmails
+	for _, unwanted := range []string{"cc", "attachments"} {
+		if containsString(properties, unwanted) {
+			t.Errorf("Email/get properties %v include %s", properties, unwanted)
+		}
+	}
+	if bodyProperties := getStringSlice(gets[0], "bodyProperties"); containsString(bodyProperties, "headers") {
+		t.Errorf("Email/get bodyProperties %v include headers", bodyProperties)
+	}
+}
+
+func TestClient_GetEmails(t *testing.T) {
+	fake := newFakeJMAPServer(t, map[string]fakeMethod{
+		"Email/get": func(args map[string]interface{}) (string, map[string]interface{}) {
+			var list []interface{}
+			for _, id := range idsArg(args) {
+				if id != "missing" {
+					list = append(list, map[string]interface{}{"id": id, "subject": "Report " + id})
+				}
+			}
+			return "Email/get", map[string]interface{}{"state": "s-1", "list": list, "notFound": []interface{}{"missing"}}
+		},
+	})
+	client := newFakeClient(t, fake)
+
+	emails, err := client.GetEmails(context.Background(), []string{"e1", "missing"})
+	if err != nil {
+		t.Fatalf("GetEmails() unexpected error = %v", err)
+	}
+	if len(emails) != 1 || emails[0].ID != "e1" {
+		t.Errorf("GetEmails() = %+v, want only e1", emails)
+	}
+
+	gets := fake.callsTo("Email/get")
+	properties := getStringSlice(gets[0], "properties")
+	for _, want := range []string{"to", "cc", "attachments", "sentAt"} {
+		if !containsString(properties, want) {
+			t.Errorf("Email/get properties %v do not include %s", properties, want)
+		}
+	}
+	if bodyProperties := getStringSlice(gets[0], "bodyProperties"); !containsString(bodyProperties, "headers") {
+		t.Errorf("Email/get bodyProperties %v do not include headers", bodyProperties)
+	}
+}
+
+func TestClient_GetListedEmails(t *testing.T) {
+	fake := newFakeJMAPServer(t, map[string]fakeMethod{
+		"Email/get": func(args map[string]interface{}) (string, map[string]interface{}) {
+			var list []interface{}
+			for _, id := range idsArg(args) {
+				list = append(list, map[string]interface{}{"id": id, "subject": "Report " + id})
+			}
+			return "Email/get", map[string]interface{}{"state": "s-1", "list": list}
+		},
+	})
+	client := newFakeClient(t, fake)
+
+	emails, err := client.GetListedEmails(context.Background(), []string{"e1", "e2"})
+	if err != nil {
+		t.Fatalf("GetListedEmails() unexpected error = %v", err)
+	}
+	if got := len(emails); got != 2 {
+		t.Errorf("GetListedEmails() returned %d emails, want 2", got)
+	}
+
+	// The emails are fetched as the inbox listing fetches them
+	get := fake.callsTo("Email/get")[0]
+	if got := getStringSlice(get, "properties"); !reflect.DeepEqual(got, emailProperties) {
+		t.Errorf("Email/get properties = %v, want the listed %v", got, emailProperties)
+	}
+	if got := getInt(get, "maxBodyValueBytes"); got != listBodyValueBytes {
+		t.Errorf("Email/get maxBodyValueBytes = %d, want %d", got, listBodyValueBytes)
+	}
+}
+
+func containsString(values []string, want string) bool {
+	for _, v := range values {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
+
+func TestClient_GetMailboxes_MethodError(t *testing.T) {
+	fake := newFakeJMAPServer(t, map[string]fakeMethod{
+		"Mailbox/get": func(args map[string]interface{}) (string, map[string]interface{}) {
+			return "error", map[string]interface{}{"type": "accountNotFound"}
+		},
+	})
+	client := newFakeClient(t, fake)
+
+	_, err := client.GetMailboxes(context.Background())
+	var methodErr *MethodError
+	if !errors.As(err, &methodErr) || methodErr.Type != "accountNotFound" {
+		t.Errorf("GetMailboxes() error = %v, want *MethodError accountNotFound", err)
+	}
+}
+
+func TestDecodeEmail_ListHeaders(t *testing.T) {
+	email := decodeEmail(t, map[string]interface{}{
+		"id":                             "list-email",
+		"header:List-Id:asText":          "Example News <News.Example.com>",
+		"header:List-Unsubscribe:asURLs": []interface{}{"https://example.com/u/1", "mailto:u@example.com"},
+		"header:List-Unsubscribe-Post":   " List-Unsubscribe=One-Click",
+		"header:Precedence":              " bulk",
+	})
+
+	if email.ListID != "Example News <News.Example.com>" {
+		t.Errorf("ListID = %q", email.ListID)
+	}
+	if len(email.ListUnsubscribe) != 2 || email.ListUnsubscribe[1] != "mailto:u@example.com" {
+		t.Errorf("ListUnsubscribe = %v", email.ListUnsubscribe)
+	}
+	if email.ListUnsubscribePost != "List-Unsubscribe=One-Click" || email.Precedence != "bulk" {
+		t.Errorf("ListUnsubscribePost = %q, Precedence = %q", email.ListUnsubscribePost, email.Precedence)
+	}
+
+	// The API representation decodes back to the same fields
+	raw, _ := json.Marshal(email)
+	var again Email
+	if err := json.Unmarshal(raw, &again); err != nil || !reflect.DeepEqual(again.ListUnsubscribe, email.ListUnsubscribe) || again.ListID != email.ListID {
+		t.Errorf("Email JSON round trip lost list headers: %+v, %v", again, err)
+	}
+}
+
+func TestEmail_PlainText(t *testing.T) {
+	values := map[string]BodyValue{
+		"1": {Value: "Plain  text\n\n\n\nbody"},
+		"2": {Value: "<p>HTML &amp; body</p><img src=\"https://t.example/o.gif\" width=\"1\" height=\"1\">"},
+		"3": {Value: "Second part"},
+	}
+
+	tests := []struct {
+		name  string
+		email Email
+		want  string
+	}{
+		{
+			name: "text parts in order",
+			email: Email{
+				BodyValues: values,
+				TextBody:   []BodyPart{{PartID: "3", Type: "text/plain"}, {PartID: "1", Type: "text/plain"}},
+				HTMLBody:   []BodyPart{{PartID: "2", Type: "text/html"}},
+			},
+			want: "Second part\n\nPlain text\n\nbody",
+		},
+		{
+			name: "html part",
+			email: Email{
+				BodyValues: values,
+				HTMLBody:   []BodyPart{{PartID: "2", Type: "text/html"}},
+			},
+			want: "HTML & body",
+		},
+		{
+			name: "html listed as text body",
+			email: Email{
+				BodyValues: values,
+				TextBody:   []BodyPart{{PartID: "2", Type: "text/html"}},
+			},
+			want: "HTML & body",
+		},
+		{
+			name:  "unlisted parts by part id",
+			email: Email{BodyValues: values},
+			want:  "Plain text\n\nbody\n\nHTML & body\n\nSecond part",
+		},
+		{
+			name:  "already derived",
+			email: Email{BodyText: "Derived", BodyValues: values},
+			want:  "Derived",
+		},
+		{
+			name:  "no body values",
+			email: Email{Preview: "Preview only"},
+			want:  "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.email.PlainText(); got != tt.want {
+				t.Errorf("PlainText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeEmail_BodyText(t *testing.T) {
+	email := decodeEmail(t, map[string]interface{}{
+		"id":         "html-email",
+		"bodyValues": map[string]interface{}{"h": map[string]interface{}{"value": "<div>Hello<script>x()</script></div>"}},
+		"htmlBody":   []interface{}{map[string]interface{}{"partId": "h", "type": "text/html"}},
+	})
+	if email.BodyText != "Hello" {
+		t.Errorf("BodyText = %q, want %q", email.BodyText, "Hello")
+	}
+
+	// The text shown keeps the links of plain text bodies
+	plain := decodeEmail(t, map[string]interface{}{
+		"id":         "plain-email",
+		"bodyValues": map[string]interface{}{"t": map[string]interface{}{"value": "Reset it at https://example.com/reset"}},
+		"textBody":   []interface{}{map[string]interface{}{"partId": "t", "type": "text/plain"}},
+	})
+	if want := "Reset it at https://example.com/reset"; plain.BodyText != want {
+		t.Errorf("BodyText = %q, want %q", plain.BodyText, want)
+	}
+
+	// The API representation keeps the body text without the body values
+	raw, _ := json.Marshal(Email{ID: "cached", BodyText: "Hello"})
+	var again Email
+	if err := json.Unmarshal(raw, &again); err != nil || again.BodyText != "Hello" {
+		t.Errorf("Email JSON round trip lost body text: %+v, %v", again, err)
+	}
+
+	// Body text that was sent along is not derived again
+	derived := decodeEmail(t, map[string]interface{}{
+		"id":         "derived",
+		"bodyText":   "Already converted",
+		"bodyValues": map[string]interface{}{"h": map[string]interface{}{"value": "<p>Hello</p>"}},
+		"htmlBody":   []interface{}{map[string]interface{}{"partId": "h", "type": "text/html"}},
+	})
+	if derived.BodyText != "Already converted" {
+		t.Errorf("BodyText = %q, want the one sent along", derived.BodyText)
+	}
+}
+
+func TestEmail_ListIdentifier(t *testing.T) {
+	tests := []struct {
+		listID string
+		want   string
+	}{
+		{"Example News <News.Example.com>", "news.example.com"},
+		{"<list.example.org>", "list.example.org"},
+		{"plain.example.net", "plain.example.net"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := (Email{ListID: tt.listID}).ListIdentifier(); got != tt.want {
+			t.Errorf("ListIdentifier(%q) = %q, want %q", tt.listID, got, tt.want)
+		}
+	}
+}
+
+func TestEmail_IsBulk(t *testing.T) {
+	tests := []struct {
+		name  string
+		email Email
+		want  bool
+	}{
+		{"list id", Email{ListID: "<news.example.com>"}, true},
+		{"unsubscribe link", Email{ListUnsubscribe: []string{"https://example.com/u"}}, true},
+		{"bulk precedence", Email{Precedence: "Bulk"}, true},
+		{"list precedence", Email{Precedence: "list"}, true},
+		{"first-class precedence", Email{Precedence: "first-class"}, false},
+		{"personal email", Email{Subject: "Lunch?"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.email.IsBulk(); got != tt.want {
+				t.Errorf("IsBulk() = %v, want %v", got, tt.want)
+			}
+		})
 	}
 }
 
@@ -558,3 +926,372 @@ func TestInboxInfo(t *testing.T) {
 		t.Errorf("InboxInfo.TotalCount = %d, want 10", info.TotalCount)
 	}
 }
+
+func TestParseArchiveResult(t *testing.T) {
+	setResult := map[string]interface{}{
+		"updated": map[string]interface{}{
+			"a": nil,
+			"c": map[string]interface{}{},
+		},
+		"notUpdated": map[string]interface{}{
+			"b": map[string]interface{}{"type": "notFound"},
+			"d": map[string]interface{}{"type": "forbidden", "description": "read-only mailbox"},
+		},
+	}
+
+	raw, _ := json.Marshal(setResult)
+	var setResponse EmailSetResponse
+	if err := json.Unmarshal(raw, &setResponse); err != nil {
+		t.Fatalf("failed to decode Email/set response: %v", err)
+	}
+
+	result := parseMoveResult([]string{"a", "b", "c", "d", "e"}, setResponse)
+
+	if len(result.Moved) != 2 || result.Moved[0] != "a" || result.Moved[1] != "c" {
+		t.Errorf("parseMoveResult() Moved = %v, want [a c]", result.Moved)
+	}
+
+	want := []MoveFailure{
+		{ID: "b", SetError: SetError{Type: "notFound"}},
+		{ID: "d", SetError: SetError{Type: "forbidden", Description: "read-only mailbox"}},
+		{ID: "e", SetError: SetError{Type: "unknown", Description: "server did not report a result for this email"}},
+	}
+	if len(result.Failed) != len(want) {
+		t.Fatalf("parseMoveResult() Failed = %v, want %v", result.Failed, want)
+	}
+	for i := range want {
+		if result.Failed[i] != want[i] {
+			t.Errorf("parseMoveResult() Failed[%d] = %+v, want %+v", i, result.Failed[i], want[i])
+		}
+	}
+}
+
+func TestClient_ArchiveEmails_PartialFailure(t *testing.T) {
+	fake := newFakeJMAPServer(t, map[string]fakeMethod{
+		"Mailbox/get": func(args map[string]interface{}) (string, map[string]interface{}) {
+			return "Mailbox/get", map[string]interface{}{
+				"state": "mb-1",
+				"list": []interface{}{
+					fakeMailbox("inbox", "Inbox", "inbox"),
+					fakeMailbox("archive", "Archive", "archive"),
+				},
+			}
+		},
+		"Email/get": func(args map[string]interface{}) (string, map[string]interface{}) {
+			return "Email/get", map[string]interface{}{"list": []interface{}{}}
+		},
+		"Email/set": func(args map[string]interface{}) (string, map[string]interface{}) {
+			return "Email/set", map[string]interface{}{
+				"updated": map[string]interface{}{"e1": nil},
+				"notUpdated": map[string]interface{}{
+					"e2": map[string]interface{}{"type": "tooLarge", "description": "too many mailboxes"},
+				},
+			}
+		},
+	})
+	client := newFakeClient(t, fake)
+
+	result, err := client.ArchiveEmails(context.Background(), []string{"e1", "e2"}, false)
+	if err != nil {
+		t.Fatalf("ArchiveEmails() unexpected error = %v", err)
+	}
+
+	if len(result.Moved) != 1 || result.Moved[0] != "e1" {
+		t.Errorf("ArchiveEmails() Moved = %v, want [e1]", result.Moved)
+	}
+	if len(result.Failed) != 1 || result.Failed[0].ID != "e2" || result.Failed[0].Type != "tooLarge" {
+		t.Errorf("ArchiveEmails() Failed = %+v, want e2 tooLarge", result.Failed)
+	}
+}
+
+func TestClient_ArchiveEmails_MethodError(t *testing.T) {
+	fake := newFakeJMAPServer(t, map[string]fakeMethod{
+		"Mailbox/get": func(args map[string]interface{}) (string, map[string]interface{}) {
+			return "Mailbox/get", map[string]interface{}{
+				"list": []interface{}{
+					fakeMailbox("inbox", "Inbox", "inbox"),
+					fakeMailbox("archive", "Archive", "archive"),
+				},
+			}
+		},
+		"Email/get": func(args map[string]interface{}) (string, map[string]interface{}) {
+			return "Email/get", map[string]interface{}{"list": []interface{}{}}
+		},
+		"Email/set": func(args map[string]interface{}) (string, map[string]interface{}) {
+			return "error", map[string]interface{}{"type": "stateMismatch"}
+		},
+	})
+	client := newFakeClient(t, fake)
+
+	if _, err := client.ArchiveEmails(context.Background(), []string{"e1"}, false); err == nil {
+		t.Error("ArchiveEmails() should fail when Email/set returns an error")
+	}
+}
+
+func TestClient_ArchiveAndUndo(t *testing.T) {
+	var sets []map[string]interface{}
+	fake := newFakeJMAPServer(t, map[string]fakeMethod{
+		"Mailbox/get": func(args map[string]interface{}) (string, map[string]interface{}) {
+			return "Mailbox/get", map[string]interface{}{
+				"list": []interface{}{
+					fakeMailbox("inbox", "Inbox", "inbox"),
+					fakeMailbox("archive", "Archive", "archive"),
+				},
+			}
+		},
+		"Email/get": func(args map[string]interface{}) (string, map[string]interface{}) {
+			return "Email/get", map[string]interface{}{"list": []interface{}{
+				map[string]interface{}{"id": "e1", "mailboxIds": map[string]interface{}{"inbox": true, "receipts": true}},
+				map[string]interface{}{"id": "e2", "mailboxIds": map[string]interface{}{"inbox": true}},
+			}}
+		},
+		"Email/set": func(args map[string]interface{}) (string, map[string]interface{}) {
+			sets = append(sets, args)
+			updated := make(map[string]interface{})
+			for id := range args["update"].(map[string]interface{}) {
+				updated[id] = nil
+			}
+			return "Email/set", map[string]interface{}{"updated": updated}
+		},
+	})
+	client := newFakeClient(t, fake)
+
+	archived, err := client.ArchiveEmails(context.Background(), []string{"e1", "e2"}, false)
+	if err != nil {
+		t.Fatalf("ArchiveEmails() unexpected error = %v", err)
+	}
+	if archived.JournalID == "" {
+		t.Error("ArchiveEmails() did not record a journal entry")
+	}
+
+	history := client.ArchiveHistory(10)
+	if len(history) != 1 || history[0].ID != archived.JournalID {
+		t.Fatalf("ArchiveHistory() = %+v, want the archive entry", history)
+	}
+
+	undone, err := client.UndoArchive(context.Background(), "", false)
+	if err != nil {
+		t.Fatalf("UndoArchive() unexpected error = %v", err)
+	}
+	if undone.EntryID != archived.JournalID || len(undone.Restored) != 2 || len(undone.Failed) != 0 {
+		t.Errorf("UndoArchive() = %+v", undone)
+	}
+
+	update := sets[len(sets)-1]["update"].(map[string]interface{})
+	wantUndo := map[string]interface{}{
+		"mailboxIds/inbox":    true,
+		"mailboxIds/receipts": true,
+		"mailboxIds/archive":  nil,
+	}
+	if e1 := update["e1"]; !reflect.DeepEqual(e1, wantUndo) {
+		t.Errorf("UndoArchive() patched e1 with %v, want %v", e1, wantUndo)
+	}
+
+	if _, err := client.UndoArchive(context.Background(), "", false); err != ErrNothingToUndo {
+		t.Errorf("UndoArchive() twice error = %v, want ErrNothingToUndo", err)
+	}
+}
+
+func TestClient_MoveEmails(t *testing.T) {
+	readOnly := fakeMailbox("shared", "Shared", "")
+	readOnly["myRights"] = map[string]interface{}{"mayReadItems": true}
+
+	fake := newFakeJMAPServer(t, map[string]fakeMethod{
+		"Mailbox/get": func(args map[string]interface{}) (string, map[string]interface{}) {
+			return "Mailbox/get", map[string]interface{}{
+				"list": []interface{}{
+					fakeMailbox("inbox", "Inbox", "inbox"),
+					fakeMailbox("news", "Newsletters", ""),
+					readOnly,
+				},
+			}
+		},
+		"Email/get": func(args map[string]interface{}) (string, map[string]interface{}) {
+			return "Email/get", map[string]interface{}{"list": []interface{}{
+				map[string]interface{}{"id": "e1", "mailboxIds": map[string]interface{}{"inbox": true}},
+			}}
+		},
+		"Email/set": func(args map[string]interface{}) (string, map[string]interface{}) {
+			return "Email/set", map[string]interface{}{"updated": map[string]interface{}{"e1": nil}}
+		},
+	})
+	client := newFakeClient(t, fake)
+
+	result, err := client.MoveEmails(context.Background(), []string{"e1"}, "news", false)
+	if err != nil {
+		t.Fatalf("MoveEmails() unexpected error = %v", err)
+	}
+	if len(result.Moved) != 1 || result.JournalID == "" {
+		t.Errorf("MoveEmails() = %+v, want e1 moved and journaled", result)
+	}
+
+	sets := fake.callsTo("Email/set")
+	wantPatch := map[string]interface{}{"mailboxIds/inbox": nil, "mailboxIds/news": true}
+	if update := sets[0]["update"].(map[string]interface{})["e1"]; !reflect.DeepEqual(update, wantPatch) {
+		t.Errorf("MoveEmails() patched e1 with %v, want %v", update, wantPatch)
+	}
+
+	if _, err := client.MoveEmails(context.Background(), []string{"e1"}, "shared", false); !errors.Is(err, ErrMailboxNotWritable) {
+		t.Errorf("MoveEmails() to read-only mailbox error = %v, want ErrMailboxNotWritable", err)
+	}
+	if _, err := client.MoveEmails(context.Background(), []string{"e1"}, "missing", true); !errors.Is(err, ErrMailboxNotFound) {
+		t.Errorf("MoveEmails() to unknown mailbox error = %v, want ErrMailboxNotFound", err)
+	}
+	if got := len(fake.callsTo("Email/set")); got != 1 {
+		t.Errorf("refused moves made %d extra Email/set calls", got-1)
+	}
+}
+
+func TestClient_ArchiveEmails_PreservesLabels(t *testing.T) {
+	// The fake server keeps real mailbox memberships and applies the patches
+	// it receives, so a whole-map replacement would visibly drop labels
+	memberships := map[string]map[string]bool{
+		"e1": {"inbox": true, "work": true},
+		"e2": {"inbox": true},
+	}
+
+	fake := newFakeJMAPServer(t, map[string]fakeMethod{
+		"Mailbox/get": func(args map[string]interface{}) (string, map[string]interface{}) {
+			return "Mailbox/get", map[string]interface{}{
+				"list": []interface{}{
+					fakeMailbox("inbox", "Inbox", "inbox"),
+					fakeMailbox("archive", "Archive", "archive"),
+					fakeMailbox("work", "Work", ""),
+				},
+			}
+		},
+		"Email/get": func(args map[string]interface{}) (string, map[string]interface{}) {
+			var list []interface{}
+			for _, id := range idsArg(args) {
+				mailboxIDs := make(map[string]interface{})
+				for mb := range memberships[id] {
+					mailboxIDs[mb] = true
+				}
+				list = append(list, map[string]interface{}{"id": id, "mailboxIds": mailboxIDs})
+			}
+			return "Email/get", map[string]interface{}{"list": list}
+		},
+		"Email/set": func(args map[string]interface{}) (string, map[string]interface{}) {
+			updated := make(map[string]interface{})
+			for id, patch := range args["update"].(map[string]interface{}) {
+				for path, value := range patch.(map[string]interface{}) {
+					mailboxID := strings.TrimPrefix(path, "mailboxIds/")
+					if mailboxID == path {
+						t.Errorf("Email/set update for %s uses %q, want mailboxIds/<id> patches", id, path)
+						continue
+					}
+					if value == nil {
+						delete(memberships[id], mailboxID)
+					} else {
+						memberships[id][mailboxID] = true
+					}
+				}
+				updated[id] = nil
+			}
+			return "Email/set", map[string]interface{}{"updated": updated}
+		},
+	})
+	client := newFakeClient(t, fake)
+
+	if _, err := client.ArchiveEmails(context.Background(), []string{"e1", "e2"}, false); err != nil {
+		t.Fatalf("ArchiveEmails() unexpected error = %v", err)
+	}
+
+	wantArchived := map[string]map[string]bool{
+		"e1": {"archive": true, "work": true},
+		"e2": {"archive": true},
+	}
+	if !reflect.DeepEqual(memberships, wantArchived) {
+		t.Errorf("mailboxes after archive = %v, want %v", memberships, wantArchived)
+	}
+
+	// A label added after the archive must survive the undo
+	memberships["e2"]["later"] = true
+
+	if _, err := client.UndoArchive(context.Background(), "", false); err != nil {
+		t.Fatalf("UndoArchive() unexpected error = %v", err)
+	}
+
+	wantRestored := map[string]map[string]bool{
+		"e1": {"inbox": true, "work": true},
+		"e2": {"inbox": true, "later": true},
+	}
+	if !reflect.DeepEqual(memberships, wantRestored) {
+		t.Errorf("mailboxes after undo = %v, want %v", memberships, wantRestored)
+	}
+}
+
+func TestClient_UndoArchive_EntryWithoutMailboxes(t *testing.T) {
+	var update map[string]interface{}
+	fake := newFakeJMAPServer(t, map[string]fakeMethod{
+		"Mailbox/get": func(args map[string]interface{}) (string, map[string]interface{}) {
+			return "Mailbox/get", map[string]interface{}{
+				"list": []interface{}{
+					fakeMailbox("inbox", "Inbox", "inbox"),
+					fakeMailbox("archive", "Archive", "archive"),
+				},
+			}
+		},
+		"Email/set": func(args map[string]interface{}) (string, map[string]interface{}) {
+			update = args["update"].(map[string]interface{})
+			return "Email/set", map[string]interface{}{"updated": map[string]interface{}{"e1": nil}}
+		},
+	})
+	client := newFakeClient(t, fake)
+
+	// An entry of an older version, without a target or mailboxes
+	if _, err := client.journal.Record([]string{"e1"}, "", nil); err != nil {
+		t.Fatalf("Record() unexpected error = %v", err)
+	}
+
+	if _, err := client.UndoArchive(context.Background(), "", false); err != nil {
+		t.Fatalf("UndoArchive() unexpected error = %v", err)
+	}
+
+	want := map[string]interface{}{"mailboxIds": map[string]interface{}{"inbox": true}}
+	if !reflect.DeepEqual(update["e1"], want) {
+		t.Errorf("UndoArchive() patched e1 with %v, want it put back in the inbox", update["e1"])
+	}
+}
+
+func TestUndoPatch_LegacyEntry(t *testing.T) {
+	original := map[string]bool{"inbox": true}
+	patch := undoPatch(original, "", "inbox")
+	if !reflect.DeepEqual(patch, PatchObject{"mailboxIds": original}) {
+		t.Errorf("undoPatch() without target = %v, want full mailboxIds replacement", patch)
+	}
+}
+
+func TestUndoPatch_NoMailboxes(t *testing.T) {
+	tests := []struct {
+		name     string
+		original map[string]bool
+		target   string
+		want     PatchObject
+	}{
+		{
+			name:   "nil without target",
+			target: "",
+			want:   PatchObject{"mailboxIds": map[string]bool{"inbox": true}},
+		},
+		{
+			name:     "empty without target",
+			original: map[string]bool{},
+			target:   "",
+			want:     PatchObject{"mailboxIds": map[string]bool{"inbox": true}},
+		},
+		{
+			name:   "nil with target",
+			target: "archive",
+			want:   PatchObject{"mailboxIds/inbox": true, "mailboxIds/archive": nil},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := undoPatch(tt.original, tt.target, "inbox"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("undoPatch() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
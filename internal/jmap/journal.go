@@ -0,0 +1,226 @@
+package jmap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultJournalSize is how many archive operations a journal keeps when no
+// size is configured.
+const DefaultJournalSize = 50
+
+// JournalEntry records one archive operation so it can be undone. Target is
+// the mailbox the emails were moved to and MailboxIDs holds the mailboxes
+// each email was in before the move.
+type JournalEntry struct {
+	ID         string                     `json:"id"`
+	Timestamp  time.Time                  `json:"timestamp"`
+	EmailIDs   []string                   `json:"emailIds"`
+	Target     string                     `json:"target,omitempty"`
+	MailboxIDs map[string]map[string]bool `json:"mailboxIds"`
+	Undone     bool                       `json:"undone"`
+}
+
+// missingMailboxes reports whether any email was journaled without the
+// mailboxes it was in, as entries written by hand or by older versions may be
+func (e JournalEntry) missingMailboxes() bool {
+	for _, id := range e.EmailIDs {
+		if len(e.MailboxIDs[id]) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// UndoResult reports which emails were moved back by an undo
+type UndoResult struct {
+	EntryID  string        `json:"entryId"`
+	Restored []string      `json:"restored"`
+	Failed   []MoveFailure `json:"failed"`
+}
+
+// ErrNothingToUndo is returned when there is no archive operation to undo
+var ErrNothingToUndo = errors.New("nothing to undo")
+
+// Journal is a bounded log of archive operations. When opened with a path it
+// is persisted as JSON after every change so it survives restarts.
+type Journal struct {
+	path       string
+	maxEntries int
+
+	mu      sync.Mutex
+	entries []JournalEntry
+	lastID  int64
+}
+
+// NewMemoryJournal creates a journal that is not persisted
+func NewMemoryJournal(maxEntries int) *Journal {
+	if maxEntries <= 0 {
+		maxEntries = DefaultJournalSize
+	}
+	return &Journal{maxEntries: maxEntries}
+}
+
+// OpenJournal loads the journal stored at path, or starts an empty one if the
+// file does not exist yet.
+func OpenJournal(path string, maxEntries int) (*Journal, error) {
+	j := NewMemoryJournal(maxEntries)
+	j.path = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &j.entries); err != nil {
+		return nil, fmt.Errorf("failed to parse journal: %w", err)
+	}
+	j.trim()
+
+	return j, nil
+}
+
+// Record appends an entry for emails moved to target and returns it
+func (j *Journal) Record(emailIDs []string, target string, mailboxIDs map[string]map[string]bool) (JournalEntry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entry := JournalEntry{
+		ID:         j.nextID(),
+		Timestamp:  time.Now().UTC(),
+		EmailIDs:   emailIDs,
+		Target:     target,
+		MailboxIDs: mailboxIDs,
+	}
+
+	j.entries = append(j.entries, entry)
+	j.trim()
+
+	return entry, j.save()
+}
+
+// Recent returns up to limit entries, newest first
+func (j *Journal) Recent(limit int) []JournalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if limit <= 0 || limit > len(j.entries) {
+		limit = len(j.entries)
+	}
+
+	entries := make([]JournalEntry, 0, limit)
+	for i := len(j.entries) - 1; i >= 0 && len(entries) < limit; i-- {
+		entries = append(entries, j.entries[i])
+	}
+	return entries
+}
+
+// Pending returns the entry with the given ID, or the newest entry that has
+// not been undone when entryID is empty.
+func (j *Journal) Pending(entryID string) (JournalEntry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for i := len(j.entries) - 1; i >= 0; i-- {
+		entry := j.entries[i]
+		if entryID != "" && entry.ID != entryID {
+			continue
+		}
+		if entry.Undone {
+			if entryID != "" {
+				return JournalEntry{}, fmt.Errorf("archive %s was already undone", entryID)
+			}
+			continue
+		}
+		return entry, nil
+	}
+
+	if entryID != "" {
+		return JournalEntry{}, fmt.Errorf("archive %s not found in journal", entryID)
+	}
+	return JournalEntry{}, ErrNothingToUndo
+}
+
+// Update replaces the stored entry with the same ID
+func (j *Journal) Update(entry JournalEntry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for i := range j.entries {
+		if j.entries[i].ID == entry.ID {
+			j.entries[i] = entry
+			return j.save()
+		}
+	}
+	return fmt.Errorf("archive %s not found in journal", entry.ID)
+}
+
+// completeUndo marks the restored emails of an entry as undone. Emails that
+// failed to move back stay in the entry so the undo can be retried.
+func (j *Journal) completeUndo(entry JournalEntry, result *UndoResult) error {
+	if len(result.Failed) == 0 {
+		entry.Undone = true
+		return j.Update(entry)
+	}
+
+	remaining := make([]string, 0, len(result.Failed))
+	for _, failure := range result.Failed {
+		remaining = append(remaining, failure.ID)
+	}
+	entry.EmailIDs = remaining
+	return j.Update(entry)
+}
+
+func (j *Journal) nextID() string {
+	id := time.Now().UnixNano()
+	if id <= j.lastID {
+		id = j.lastID + 1
+	}
+	j.lastID = id
+	return fmt.Sprintf("archive-%d", id)
+}
+
+func (j *Journal) trim() {
+	if len(j.entries) > j.maxEntries {
+		j.entries = append([]JournalEntry(nil), j.entries[len(j.entries)-j.maxEntries:]...)
+	}
+}
+
+// save writes the journal atomically so a crash never leaves a torn file
+func (j *Journal) save() error {
+	if j.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(j.entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode journal: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(j.path), ".journal-*")
+	if err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), j.path); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package jmap
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJournal_RecordAndPending(t *testing.T) {
+	j := NewMemoryJournal(10)
+
+	if _, err := j.Pending(""); !errors.Is(err, ErrNothingToUndo) {
+		t.Errorf("Pending() on empty journal error = %v, want ErrNothingToUndo", err)
+	}
+
+	first, _ := j.Record([]string{"a"}, "archive", map[string]map[string]bool{"a": {"inbox": true}})
+	second, _ := j.Record([]string{"b"}, "archive", map[string]map[string]bool{"b": {"inbox": true}})
+
+	if first.ID == second.ID {
+		t.Fatalf("Record() returned duplicate IDs %q", first.ID)
+	}
+
+	latest, err := j.Pending("")
+	if err != nil || latest.ID != second.ID {
+		t.Errorf("Pending(\"\") = %v, %v, want %s", latest.ID, err, second.ID)
+	}
+
+	second.Undone = true
+	if err := j.Update(second); err != nil {
+		t.Fatalf("Update() unexpected error = %v", err)
+	}
+
+	latest, err = j.Pending("")
+	if err != nil || latest.ID != first.ID {
+		t.Errorf("Pending(\"\") after undo = %v, %v, want %s", latest.ID, err, first.ID)
+	}
+
+	if _, err := j.Pending(second.ID); err == nil {
+		t.Error("Pending() of an undone entry should fail")
+	}
+	if _, err := j.Pending("missing"); err == nil {
+		t.Error("Pending() of an unknown entry should fail")
+	}
+
+	recent := j.Recent(0)
+	if len(recent) != 2 || recent[0].ID != second.ID {
+		t.Errorf("Recent() = %v, want newest first", recent)
+	}
+}
+
+func TestJournal_Trim(t *testing.T) {
+	j := NewMemoryJournal(3)
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		j.Record([]string{id}, "archive", nil)
+	}
+
+	recent := j.Recent(10)
+	if len(recent) != 3 {
+		t.Fatalf("Recent() returned %d entries, want 3", len(recent))
+	}
+	if recent[0].EmailIDs[0] != "e" || recent[2].EmailIDs[0] != "c" {
+		t.Errorf("Recent() kept %v..%v, want e..c", recent[0].EmailIDs, recent[2].EmailIDs)
+	}
+}
+
+func TestJournal_Persistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.json")
+
+	j, err := OpenJournal(path, 10)
+	if err != nil {
+		t.Fatalf("OpenJournal() unexpected error = %v", err)
+	}
+	entry, err := j.Record([]string{"a", "b"}, "archive", map[string]map[string]bool{
+		"a": {"inbox": true, "label": true},
+		"b": {"inbox": true},
+	})
+	if err != nil {
+		t.Fatalf("Record() unexpected error = %v", err)
+	}
+
+	reopened, err := OpenJournal(path, 10)
+	if err != nil {
+		t.Fatalf("OpenJournal() reopen unexpected error = %v", err)
+	}
+
+	got, err := reopened.Pending("")
+	if err != nil {
+		t.Fatalf("Pending() after reopen unexpected error = %v", err)
+	}
+	if got.ID != entry.ID || len(got.EmailIDs) != 2 || got.Target != "archive" || !got.MailboxIDs["a"]["label"] {
+		t.Errorf("Pending() after reopen = %+v, want %+v", got, entry)
+	}
+
+	if err := os.WriteFile(path, []byte("not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenJournal(path, 10); err == nil {
+		t.Error("OpenJournal() should fail on a corrupt journal")
+	}
+}
+
+func TestJournal_CompleteUndoPartial(t *testing.T) {
+	j := NewMemoryJournal(10)
+	entry, _ := j.Record([]string{"a", "b"}, "archive", nil)
+
+	j.completeUndo(entry, &UndoResult{
+		Restored: []string{"a"},
+		Failed:   []MoveFailure{{ID: "b", SetError: SetError{Type: "notFound"}}},
+	})
+
+	remaining, err := j.Pending(entry.ID)
+	if err != nil {
+		t.Fatalf("Pending() after partial undo unexpected error = %v", err)
+	}
+	if len(remaining.EmailIDs) != 1 || remaining.EmailIDs[0] != "b" {
+		t.Errorf("Pending() after partial undo EmailIDs = %v, want [b]", remaining.EmailIDs)
+	}
+}
@@ -0,0 +1,94 @@
+package jmap
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var (
+	// ErrMailboxNotFound is returned when a move targets a mailbox that does
+	// not exist in the account
+	ErrMailboxNotFound = errors.New("mailbox not found")
+
+	// ErrMailboxNotWritable is returned when the user's rights do not allow
+	// removing emails from the inbox or adding them to the target mailbox
+	ErrMailboxNotWritable = errors.New("mailbox is not writable")
+
+	// ErrInvalidMoveTarget is returned when emails are moved to the mailbox
+	// they are already listed from
+	ErrInvalidMoveTarget = errors.New("invalid move target")
+)
+
+// MailboxNode is a mailbox with its child mailboxes, as shown in a folder tree
+type MailboxNode struct {
+	Mailbox
+	Children []*MailboxNode `json:"children"`
+}
+
+// BuildMailboxTree arranges mailboxes by ParentID. Siblings are ordered by
+// SortOrder and then by name, as RFC 8621 section 2 recommends. Mailboxes
+// whose parent is missing are treated as top-level.
+func BuildMailboxTree(mailboxes []Mailbox) []*MailboxNode {
+	nodes := make(map[string]*MailboxNode, len(mailboxes))
+	for _, mb := range mailboxes {
+		nodes[mb.ID] = &MailboxNode{Mailbox: mb, Children: []*MailboxNode{}}
+	}
+
+	roots := []*MailboxNode{}
+	for _, mb := range mailboxes {
+		node := nodes[mb.ID]
+		if parent, ok := nodes[mb.ParentID]; ok && mb.ParentID != mb.ID {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+
+	sortMailboxNodes(roots)
+	return roots
+}
+
+func sortMailboxNodes(nodes []*MailboxNode) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		if nodes[i].SortOrder != nodes[j].SortOrder {
+			return nodes[i].SortOrder < nodes[j].SortOrder
+		}
+		return nodes[i].Name < nodes[j].Name
+	})
+	for _, node := range nodes {
+		sortMailboxNodes(node.Children)
+	}
+}
+
+// checkMove verifies that emails may be moved from the inbox to the target
+// mailbox and returns the inbox ID.
+func checkMove(mailboxes []Mailbox, targetMailboxID string) (string, error) {
+	var inbox, target *Mailbox
+	for i := range mailboxes {
+		if mailboxes[i].Role == "inbox" {
+			inbox = &mailboxes[i]
+		}
+		if mailboxes[i].ID == targetMailboxID {
+			target = &mailboxes[i]
+		}
+	}
+
+	if inbox == nil {
+		return "", fmt.Errorf("inbox not found")
+	}
+	if target == nil {
+		return "", fmt.Errorf("%w: %s", ErrMailboxNotFound, targetMailboxID)
+	}
+	if target.ID == inbox.ID {
+		return "", fmt.Errorf("%w: emails are already in %s", ErrInvalidMoveTarget, inbox.Name)
+	}
+	if !inbox.MyRights.MayRemoveItems {
+		return "", fmt.Errorf("%w: cannot remove emails from %s", ErrMailboxNotWritable, inbox.Name)
+	}
+	if !target.MyRights.MayAddItems {
+		return "", fmt.Errorf("%w: cannot add emails to %s", ErrMailboxNotWritable, target.Name)
+	}
+
+	return inbox.ID, nil
+}
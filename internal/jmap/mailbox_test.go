@@ -0,0 +1,119 @@
+package jmap
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestBuildMailboxTree(t *testing.T) {
+	mailboxes := []Mailbox{
+		{ID: "tech", Name: "Tech", ParentID: "news", SortOrder: 5},
+		{ID: "archive", Name: "Archive", Role: "archive", SortOrder: 2},
+		{ID: "news", Name: "Newsletters", SortOrder: 10},
+		{ID: "deals", Name: "Deals", ParentID: "news", SortOrder: 5},
+		{ID: "inbox", Name: "Inbox", Role: "inbox", SortOrder: 1},
+		{ID: "orphan", Name: "Orphan", ParentID: "gone", SortOrder: 10},
+	}
+
+	tree := BuildMailboxTree(mailboxes)
+
+	var names func(nodes []*MailboxNode) []string
+	names = func(nodes []*MailboxNode) []string {
+		var out []string
+		for _, node := range nodes {
+			out = append(out, node.Name)
+			for _, child := range names(node.Children) {
+				out = append(out, node.Name+"/"+child)
+			}
+		}
+		return out
+	}
+
+	want := []string{"Inbox", "Archive", "Newsletters", "Newsletters/Deals", "Newsletters/Tech", "Orphan"}
+	if got := names(tree); !reflect.DeepEqual(got, want) {
+		t.Errorf("BuildMailboxTree() = %v, want %v", got, want)
+	}
+}
+
+func TestCheckMove(t *testing.T) {
+	writable := Rights{MayReadItems: true, MayAddItems: true, MayRemoveItems: true}
+	mailboxes := []Mailbox{
+		{ID: "inbox", Name: "Inbox", Role: "inbox", MyRights: writable},
+		{ID: "news", Name: "Newsletters", MyRights: writable},
+		{ID: "shared", Name: "Shared", MyRights: Rights{MayReadItems: true}},
+	}
+
+	tests := []struct {
+		name      string
+		mailboxes []Mailbox
+		target    string
+		wantErr   error
+	}{
+		{"writable folder", mailboxes, "news", nil},
+		{"read-only folder", mailboxes, "shared", ErrMailboxNotWritable},
+		{"unknown folder", mailboxes, "missing", ErrMailboxNotFound},
+		{"inbox itself", mailboxes, "inbox", ErrInvalidMoveTarget},
+		{
+			"read-only inbox",
+			[]Mailbox{
+				{ID: "inbox", Name: "Inbox", Role: "inbox", MyRights: Rights{MayReadItems: true, MayAddItems: true}},
+				mailboxes[1],
+			},
+			"news",
+			ErrMailboxNotWritable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inboxID, err := checkMove(tt.mailboxes, tt.target)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("checkMove() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || inboxID != "inbox" {
+				t.Errorf("checkMove() = %q, %v, want inbox", inboxID, err)
+			}
+		})
+	}
+}
+
+func TestDecodeMailbox(t *testing.T) {
+	raw := []byte(`{
+		"id": "tech",
+		"name": "Tech",
+		"parentId": "news",
+		"role": null,
+		"sortOrder": 3,
+		"totalEmails": 12,
+		"unreadEmails": 2,
+		"totalThreads": 10,
+		"unreadThreads": 1,
+		"isSubscribed": true,
+		"myRights": {"mayReadItems": true, "mayAddItems": true}
+	}`)
+
+	var mailbox Mailbox
+	if err := json.Unmarshal(raw, &mailbox); err != nil {
+		t.Fatalf("failed to decode mailbox: %v", err)
+	}
+	want := Mailbox{
+		ID:            "tech",
+		Name:          "Tech",
+		ParentID:      "news",
+		SortOrder:     3,
+		TotalEmails:   12,
+		UnreadEmails:  2,
+		TotalThreads:  10,
+		UnreadThreads: 1,
+		IsSubscribed:  true,
+		MyRights:      Rights{MayReadItems: true, MayAddItems: true},
+	}
+	if mailbox != want {
+		t.Errorf("decoded mailbox = %+v, want %+v", mailbox, want)
+	}
+}
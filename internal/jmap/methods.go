@@ -0,0 +1,205 @@
+package jmap
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Invocation is a method response as sent on the wire: a
+// [name, arguments, callId] triple (RFC 8620 section 3.2). The arguments are
+// kept raw until the caller decodes them into the type for the method.
+type Invocation struct {
+	Name   string
+	Args   json.RawMessage
+	CallID string
+}
+
+func (i Invocation) MarshalJSON() ([]byte, error) {
+	args := i.Args
+	if args == nil {
+		args = json.RawMessage("{}")
+	}
+	return json.Marshal([]interface{}{i.Name, args, i.CallID})
+}
+
+func (i *Invocation) UnmarshalJSON(data []byte) error {
+	var parts []json.RawMessage
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return err
+	}
+	if len(parts) != 3 {
+		return fmt.Errorf("invalid invocation: %d elements, want 3", len(parts))
+	}
+
+	if err := json.Unmarshal(parts[0], &i.Name); err != nil {
+		return fmt.Errorf("invalid invocation name: %w", err)
+	}
+	if err := json.Unmarshal(parts[2], &i.CallID); err != nil {
+		return fmt.Errorf("invalid invocation call ID: %w", err)
+	}
+	i.Args = parts[1]
+	return nil
+}
+
+// ResultReference points a method argument at part of the result of an
+// earlier call in the same request (RFC 8620 section 3.7)
+type ResultReference struct {
+	ResultOf string `json:"resultOf"`
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+}
+
+// MailboxGetRequest is the arguments of Mailbox/get. Nil IDs fetch every
+// mailbox.
+type MailboxGetRequest struct {
+	AccountID  string   `json:"accountId"`
+	IDs        []string `json:"ids"`
+	Properties []string `json:"properties,omitempty"`
+}
+
+// MailboxGetResponse is the result of Mailbox/get
+type MailboxGetResponse struct {
+	AccountID string    `json:"accountId"`
+	State     string    `json:"state"`
+	List      []Mailbox `json:"list"`
+	NotFound  []string  `json:"notFound"`
+}
+
+// EmailFilter is an Email/query filter condition (RFC 8621 section 4.4.1)
+type EmailFilter struct {
+	InMailbox string `json:"inMailbox,omitempty"`
+}
+
+// Comparator is a sort criterion for /query methods
+type Comparator struct {
+	Property    string `json:"property"`
+	IsAscending bool   `json:"isAscending"`
+}
+
+// EmailQueryRequest is the arguments of Email/query
+type EmailQueryRequest struct {
+	AccountID      string       `json:"accountId"`
+	Filter         *EmailFilter `json:"filter,omitempty"`
+	Sort           []Comparator `json:"sort,omitempty"`
+	Position       int          `json:"position,omitempty"`
+	Limit          int          `json:"limit,omitempty"`
+	CalculateTotal bool         `json:"calculateTotal,omitempty"`
+}
+
+// EmailQueryResponse is the result of Email/query
+type EmailQueryResponse struct {
+	AccountID           string   `json:"accountId"`
+	QueryState          string   `json:"queryState"`
+	CanCalculateChanges bool     `json:"canCalculateChanges"`
+	Position            int      `json:"position"`
+	IDs                 []string `json:"ids"`
+	Total               int      `json:"total"`
+}
+
+// EmailGetRequest is the arguments of Email/get. Either IDs or IDsRef must
+// be set: an empty IDs is left out of the request, which would ask for every
+// email in the account.
+type EmailGetRequest struct {
+	AccountID           string           `json:"accountId"`
+	IDs                 []string         `json:"ids,omitempty"`
+	IDsRef              *ResultReference `json:"#ids,omitempty"`
+	Properties          []string         `json:"properties,omitempty"`
+	BodyProperties      []string         `json:"bodyProperties,omitempty"`
+	FetchTextBodyValues bool             `json:"fetchTextBodyValues,omitempty"`
+	FetchHTMLBodyValues bool             `json:"fetchHTMLBodyValues,omitempty"`
+	MaxBodyValueBytes   int              `json:"maxBodyValueBytes,omitempty"`
+}
+
+// EmailGetResponse is the result of Email/get
+type EmailGetResponse struct {
+	AccountID string   `json:"accountId"`
+	State     string   `json:"state"`
+	List      []Email  `json:"list"`
+	NotFound  []string `json:"notFound"`
+}
+
+// PatchObject is an Email/set update in patch syntax: property paths mapped
+// to their new value, or nil to remove them (RFC 8620 section 5.3)
+type PatchObject map[string]interface{}
+
+// EmailSetRequest is the arguments of Email/set. Destroying emails is not
+// supported.
+type EmailSetRequest struct {
+	AccountID string                 `json:"accountId"`
+	IfInState string                 `json:"ifInState,omitempty"`
+	Create    map[string]EmailCreate `json:"create,omitempty"`
+	Update    map[string]PatchObject `json:"update,omitempty"`
+}
+
+// EmailSetResponse is the result of Email/set. Updated maps each updated ID
+// to the properties the server changed beyond the patch, which is usually
+// nil.
+type EmailSetResponse struct {
+	AccountID  string              `json:"accountId"`
+	OldState   string              `json:"oldState"`
+	NewState   string              `json:"newState"`
+	Created    map[string]*Email   `json:"created"`
+	Updated    map[string]*Email   `json:"updated"`
+	NotCreated map[string]SetError `json:"notCreated"`
+	NotUpdated map[string]SetError `json:"notUpdated"`
+}
+
+// ChangesRequest is the arguments of Mailbox/changes and Email/changes
+type ChangesRequest struct {
+	AccountID  string `json:"accountId"`
+	SinceState string `json:"sinceState"`
+	MaxChanges int    `json:"maxChanges,omitempty"`
+}
+
+// ChangesResponse is the result of Mailbox/changes and Email/changes
+type ChangesResponse struct {
+	AccountID      string   `json:"accountId"`
+	OldState       string   `json:"oldState"`
+	NewState       string   `json:"newState"`
+	HasMoreChanges bool     `json:"hasMoreChanges"`
+	Created        []string `json:"created"`
+	Updated        []string `json:"updated"`
+	Destroyed      []string `json:"destroyed"`
+}
+
+// hasChanges reports whether anything changed since the requested state
+func (r *ChangesResponse) hasChanges() bool {
+	return len(r.Created) > 0 || len(r.Updated) > 0 || len(r.Destroyed) > 0 || r.HasMoreChanges
+}
+
+// EmailQueryChangesRequest is the arguments of Email/queryChanges. Filter and
+// sort must match the Email/query the state came from.
+type EmailQueryChangesRequest struct {
+	AccountID       string       `json:"accountId"`
+	Filter          *EmailFilter `json:"filter,omitempty"`
+	Sort            []Comparator `json:"sort,omitempty"`
+	SinceQueryState string       `json:"sinceQueryState"`
+	CalculateTotal  bool         `json:"calculateTotal,omitempty"`
+}
+
+// AddedItem is an ID that entered a query result at the given index
+type AddedItem struct {
+	ID    string `json:"id"`
+	Index int    `json:"index"`
+}
+
+// EmailQueryChangesResponse is the result of Email/queryChanges
+type EmailQueryChangesResponse struct {
+	AccountID     string      `json:"accountId"`
+	OldQueryState string      `json:"oldQueryState"`
+	NewQueryState string      `json:"newQueryState"`
+	Total         int         `json:"total"`
+	Removed       []string    `json:"removed"`
+	Added         []AddedItem `json:"added"`
+}
+
+// sortedAdded returns the added items in index order, the order they must be
+// spliced into the listing
+func (r *EmailQueryChangesResponse) sortedAdded() []AddedItem {
+	added := append([]AddedItem(nil), r.Added...)
+	sort.Slice(added, func(i, j int) bool {
+		return added[i].Index < added[j].Index
+	})
+	return added
+}
@@ -1,29 +1,68 @@
 package jmap
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
+	"strings"
+	"sync"
 	"time"
 )
 
 // MockClient implements the JMAP client interface but returns sample data
 type MockClient struct {
 	sampleEmails []Email
-	archivedIDs  map[string]bool
+	movedTo      map[string]string
+	journal      *Journal
+	push         broadcaster
+	stateMu      sync.Mutex
+	stateCounter int
+	latency      time.Duration
+	sentMu       sync.Mutex
+	sent         []OutgoingEmail
 }
 
 // NewMockClient creates a new mock JMAP client with sample data
 func NewMockClient() *MockClient {
 	mock := &MockClient{
-		archivedIDs: make(map[string]bool),
+		movedTo: make(map[string]string),
+		journal: NewMemoryJournal(DefaultJournalSize),
 	}
 	mock.generateSampleEmails()
 	return mock
 }
 
-// Authenticate always succeeds for mock client
-func (m *MockClient) Authenticate() error {
-	return nil
+// SetLatency makes every call that would reach a real server take d, so
+// slow responses and cancellation can be tried out without one
+func (m *MockClient) SetLatency(d time.Duration) {
+	m.latency = d
+}
+
+// wait simulates a round trip to the server. Like a real request it fails
+// once ctx is cancelled.
+func (m *MockClient) wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if m.latency <= 0 {
+		return nil
+	}
+	return sleepContext(ctx, m.latency)
+}
+
+// Authenticate always succeeds for mock client unless ctx is cancelled
+func (m *MockClient) Authenticate(ctx context.Context) error {
+	return m.wait(ctx)
+}
+
+// SessionHealth reports a healthy mock session
+func (m *MockClient) SessionHealth() SessionHealth {
+	return SessionHealth{
+		Authenticated: true,
+		Healthy:       true,
+		Username:      mockRecipient.Email,
+		State:         "mock-session",
+	}
 }
 
 // GetPrimaryAccount returns a mock account ID
@@ -31,32 +70,50 @@ func (m *MockClient) GetPrimaryAccount() string {
 	return "mock-account-123"
 }
 
-// GetMailboxes returns mock mailboxes
-func (m *MockClient) GetMailboxes() ([]Mailbox, error) {
+// mockOwnRights are the rights the user has on their own mock mailboxes
+var mockOwnRights = Rights{
+	MayReadItems:   true,
+	MayAddItems:    true,
+	MayRemoveItems: true,
+	MaySetSeen:     true,
+	MaySetKeywords: true,
+	MayCreateChild: true,
+	MayRename:      true,
+	MayDelete:      true,
+	MaySubmit:      true,
+}
+
+// GetMailboxes returns mock mailboxes, including nested folders and a
+// read-only shared mailbox that emails cannot be moved to
+func (m *MockClient) GetMailboxes(ctx context.Context) ([]Mailbox, error) {
+	if err := m.wait(ctx); err != nil {
+		return nil, err
+	}
+
 	return []Mailbox{
-		{
-			ID:   "inbox-123",
-			Name: "Inbox",
-			Role: "inbox",
-		},
-		{
-			ID:   "archive-456",
-			Name: "Archive",
-			Role: "archive",
-		},
+		{ID: "inbox-123", Name: "Inbox", Role: "inbox", SortOrder: 1, MyRights: mockOwnRights, IsSubscribed: true},
+		{ID: "archive-456", Name: "Archive", Role: "archive", SortOrder: 2, MyRights: mockOwnRights, IsSubscribed: true},
+		{ID: "folder-newsletters", Name: "Newsletters", SortOrder: 10, MyRights: mockOwnRights, IsSubscribed: true},
+		{ID: "folder-tech", Name: "Tech", ParentID: "folder-newsletters", SortOrder: 10, MyRights: mockOwnRights, IsSubscribed: true},
+		{ID: "folder-receipts", Name: "Receipts", SortOrder: 11, MyRights: mockOwnRights, IsSubscribed: true},
+		{ID: "shared-announcements", Name: "Announcements (shared)", SortOrder: 20, MyRights: Rights{MayReadItems: true}, IsSubscribed: true},
 	}, nil
 }
 
-// GetInboxEmails returns the sample emails that haven't been archived
-func (m *MockClient) GetInboxEmails(limit int) ([]Email, error) {
-	return m.GetInboxEmailsPaginated(limit, 0)
+// GetInboxEmails returns the sample emails that haven't been moved
+func (m *MockClient) GetInboxEmails(ctx context.Context, limit int) ([]Email, error) {
+	return m.GetInboxEmailsPaginated(ctx, limit, 0)
 }
 
-// GetInboxEmailsPaginated returns paginated sample emails that haven't been archived
-func (m *MockClient) GetInboxEmailsPaginated(limit, offset int) ([]Email, error) {
+// GetInboxEmailsPaginated returns paginated sample emails that haven't been moved
+func (m *MockClient) GetInboxEmailsPaginated(ctx context.Context, limit, offset int) ([]Email, error) {
+	if err := m.wait(ctx); err != nil {
+		return nil, err
+	}
+
 	var inboxEmails []Email
 	for _, email := range m.sampleEmails {
-		if !m.archivedIDs[email.ID] {
+		if m.movedTo[email.ID] == "" {
 			inboxEmails = append(inboxEmails, email)
 		}
 	}
@@ -76,21 +133,21 @@ func (m *MockClient) GetInboxEmailsPaginated(limit, offset int) ([]Email, error)
 }
 
 // GetInboxEmailsWithCount returns sample emails with total count
-func (m *MockClient) GetInboxEmailsWithCount(limit int) (*InboxInfo, error) {
-	return m.GetInboxEmailsWithCountPaginated(limit, 0)
+func (m *MockClient) GetInboxEmailsWithCount(ctx context.Context, limit int) (*InboxInfo, error) {
+	return m.GetInboxEmailsWithCountPaginated(ctx, limit, 0)
 }
 
 // GetInboxEmailsWithCountPaginated returns paginated sample emails with total count
-func (m *MockClient) GetInboxEmailsWithCountPaginated(limit, offset int) (*InboxInfo, error) {
-	// Count all non-archived emails
+func (m *MockClient) GetInboxEmailsWithCountPaginated(ctx context.Context, limit, offset int) (*InboxInfo, error) {
+	// Count all emails still in the inbox
 	totalCount := 0
 	for _, email := range m.sampleEmails {
-		if !m.archivedIDs[email.ID] {
+		if m.movedTo[email.ID] == "" {
 			totalCount++
 		}
 	}
 
-	emails, err := m.GetInboxEmailsPaginated(limit, offset)
+	emails, err := m.GetInboxEmailsPaginated(ctx, limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -101,20 +158,213 @@ func (m *MockClient) GetInboxEmailsWithCountPaginated(limit, offset int) (*Inbox
 	}, nil
 }
 
-// ArchiveEmails simulates archiving by marking emails as archived
-func (m *MockClient) ArchiveEmails(emailIDs []string, dryRun bool) error {
+// GetEmails returns the sample emails with the given IDs, wherever they were
+// moved
+func (m *MockClient) GetEmails(ctx context.Context, ids []string) ([]Email, error) {
+	if err := m.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	emails := []Email{}
+	for _, email := range m.sampleEmails {
+		if wanted[email.ID] {
+			emails = append(emails, email)
+		}
+	}
+	return emails, nil
+}
+
+// GetListedEmails returns the sample emails with the given IDs, which are
+// listed as they are
+func (m *MockClient) GetListedEmails(ctx context.Context, ids []string) ([]Email, error) {
+	return m.GetEmails(ctx, ids)
+}
+
+// ArchiveEmails simulates archiving by moving emails to the mock archive
+func (m *MockClient) ArchiveEmails(ctx context.Context, emailIDs []string, dryRun bool) (*MoveResult, error) {
+	if err := m.wait(ctx); err != nil {
+		return nil, err
+	}
+
 	if dryRun {
 		fmt.Printf("[MOCK DRY RUN] Would archive %d emails: %v\n", len(emailIDs), emailIDs)
-		return nil
+		return &MoveResult{Moved: emailIDs, Failed: []MoveFailure{}}, nil
 	}
 
 	fmt.Printf("[MOCK MODE] Archiving %d emails: %v\n", len(emailIDs), emailIDs)
+	return m.moveEmails(emailIDs, "archive-456"), nil
+}
+
+// MoveEmails simulates moving emails out of the inbox, refusing targets the
+// mock user has no rights to add emails to
+func (m *MockClient) MoveEmails(ctx context.Context, emailIDs []string, targetMailboxID string, dryRun bool) (*MoveResult, error) {
+	mailboxes, err := m.GetMailboxes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := checkMove(mailboxes, targetMailboxID); err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		fmt.Printf("[MOCK DRY RUN] Would move %d emails to %s: %v\n", len(emailIDs), targetMailboxID, emailIDs)
+		return &MoveResult{Moved: emailIDs, Failed: []MoveFailure{}}, nil
+	}
+
+	fmt.Printf("[MOCK MODE] Moving %d emails to %s: %v\n", len(emailIDs), targetMailboxID, emailIDs)
+	return m.moveEmails(emailIDs, targetMailboxID), nil
+}
+
+// moveEmails moves inbox emails to the target. Unknown or already moved IDs
+// are reported as notFound, like a real server would.
+func (m *MockClient) moveEmails(emailIDs []string, targetMailboxID string) *MoveResult {
+	inInbox := make(map[string]bool)
+	for _, email := range m.sampleEmails {
+		if m.movedTo[email.ID] == "" {
+			inInbox[email.ID] = true
+		}
+	}
+
+	result := &MoveResult{
+		Moved:  []string{},
+		Failed: []MoveFailure{},
+	}
 	for _, id := range emailIDs {
-		m.archivedIDs[id] = true
+		if !inInbox[id] {
+			result.Failed = append(result.Failed, MoveFailure{
+				ID:       id,
+				SetError: SetError{Type: "notFound", Description: "email is not in the inbox"},
+			})
+			continue
+		}
+		m.movedTo[id] = targetMailboxID
+		result.Moved = append(result.Moved, id)
 	}
+
+	if len(result.Moved) > 0 {
+		mailboxIDs := make(map[string]map[string]bool, len(result.Moved))
+		for _, id := range result.Moved {
+			mailboxIDs[id] = map[string]bool{"inbox-123": true}
+		}
+		entry, err := m.journal.Record(result.Moved, targetMailboxID, mailboxIDs)
+		if err != nil {
+			fmt.Printf("[MOCK MODE] Failed to record move in journal: %v\n", err)
+		} else {
+			result.JournalID = entry.ID
+		}
+	}
+
+	return result
+}
+
+// SetJournal replaces the journal archive operations are recorded in
+func (m *MockClient) SetJournal(journal *Journal) {
+	m.journal = journal
+}
+
+// ArchiveHistory returns the most recent mock archive operations, newest first
+func (m *MockClient) ArchiveHistory(limit int) []JournalEntry {
+	return m.journal.Recent(limit)
+}
+
+// UndoArchive moves the emails of a journaled mock move back to the inbox
+func (m *MockClient) UndoArchive(ctx context.Context, entryID string, dryRun bool) (*UndoResult, error) {
+	if err := m.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	entry, err := m.journal.Pending(entryID)
+	if err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		fmt.Printf("[MOCK DRY RUN] Would restore %d emails from %s\n", len(entry.EmailIDs), entry.ID)
+		return &UndoResult{EntryID: entry.ID, Restored: entry.EmailIDs, Failed: []MoveFailure{}}, nil
+	}
+
+	fmt.Printf("[MOCK MODE] Restoring %d emails from %s\n", len(entry.EmailIDs), entry.ID)
+
+	result := &UndoResult{
+		EntryID:  entry.ID,
+		Restored: []string{},
+		Failed:   []MoveFailure{},
+	}
+	for _, id := range entry.EmailIDs {
+		if m.movedTo[id] == "" {
+			result.Failed = append(result.Failed, MoveFailure{
+				ID:       id,
+				SetError: SetError{Type: "notFound", Description: "email is no longer where it was moved to"},
+			})
+			continue
+		}
+		delete(m.movedTo, id)
+		result.Restored = append(result.Restored, id)
+	}
+
+	if err := m.journal.completeUndo(entry, result); err != nil {
+		fmt.Printf("[MOCK MODE] Failed to update journal: %v\n", err)
+	}
+
+	return result, nil
+}
+
+// SendEmail records msg instead of sending it
+func (m *MockClient) SendEmail(ctx context.Context, msg OutgoingEmail) error {
+	if err := m.wait(ctx); err != nil {
+		return err
+	}
+
+	fmt.Printf("[MOCK MODE] Sending email to %s: %s\n", msg.To, msg.Subject)
+
+	m.sentMu.Lock()
+	defer m.sentMu.Unlock()
+	m.sent = append(m.sent, msg)
 	return nil
 }
 
+// SentEmails returns the emails sent through the mock, oldest first
+func (m *MockClient) SentEmails() []OutgoingEmail {
+	m.sentMu.Lock()
+	defer m.sentMu.Unlock()
+	return append([]OutgoingEmail(nil), m.sent...)
+}
+
+// Subscribe returns a channel that receives the mock's synthetic state changes
+func (m *MockClient) Subscribe() (<-chan StateChange, func()) {
+	return m.push.subscribe()
+}
+
+// EmitStateChange publishes a synthetic StateChange for the given types
+// (defaulting to Email), as if the server had pushed one
+func (m *MockClient) EmitStateChange(types ...string) {
+	if len(types) == 0 {
+		types = []string{"Email"}
+	}
+
+	m.stateMu.Lock()
+	m.stateCounter++
+	state := fmt.Sprintf("mock-state-%d", m.stateCounter)
+	m.stateMu.Unlock()
+
+	changed := make(map[string]string)
+	for _, t := range types {
+		changed[t] = state
+	}
+
+	m.push.publish(StateChange{
+		Type:    "StateChange",
+		Changed: map[string]map[string]string{m.GetPrimaryAccount(): changed},
+	})
+}
+
+// mockRecipient is the mock account's own address
+var mockRecipient = EmailAddress{Name: "Mock User", Email: "mock@example.com"}
+
 // generateSampleEmails creates realistic sample email data
 func (m *MockClient) generateSampleEmails() {
 	senders := []string{
@@ -169,8 +419,12 @@ func (m *MockClient) generateSampleEmails() {
 		for j := 0; j < numSimilar; j++ {
 			email := Email{
 				ID:         fmt.Sprintf("email-%d-%d", i, j),
+				ThreadID:   fmt.Sprintf("thread-%d", i),
+				MailboxIDs: map[string]bool{"inbox-123": true},
+				Size:       len(baseContent) + 2048,
 				Subject:    baseSubject,
 				From:       []EmailAddress{{Email: sender, Name: extractNameFromEmail(sender)}},
+				To:         []EmailAddress{mockRecipient},
 				Preview:    baseContent,
 				ReceivedAt: baseTime.Add(time.Duration(i*24+j*6) * time.Hour),
 				BodyValues: map[string]BodyValue{
@@ -178,6 +432,8 @@ func (m *MockClient) generateSampleEmails() {
 				},
 			}
 
+			addMockListHeaders(&email, sender)
+
 			// Add slight variations to subjects for some emails
 			if j > 0 {
 				variations := []string{
@@ -197,6 +453,9 @@ func (m *MockClient) generateSampleEmails() {
 	uniqueEmails := []Email{
 		{
 			ID:         "unique-1",
+			ThreadID:   "thread-unique-1",
+			MailboxIDs: map[string]bool{"inbox-123": true},
+			To:         []EmailAddress{mockRecipient},
 			Subject:    "Welcome to our platform!",
 			From:       []EmailAddress{{Email: "welcome@newservice.com", Name: "New Service"}},
 			Preview:    "Thanks for signing up! Here's how to get started.",
@@ -207,6 +466,9 @@ func (m *MockClient) generateSampleEmails() {
 		},
 		{
 			ID:         "unique-2",
+			ThreadID:   "thread-unique-2",
+			MailboxIDs: map[string]bool{"inbox-123": true},
+			To:         []EmailAddress{mockRecipient},
 			Subject:    "Conference invitation",
 			From:       []EmailAddress{{Email: "events@techconf.com", Name: "Tech Conference"}},
 			Preview:    "You're invited to speak at our upcoming conference.",
@@ -218,6 +480,43 @@ func (m *MockClient) generateSampleEmails() {
 	}
 
 	m.sampleEmails = append(m.sampleEmails, uniqueEmails...)
+
+	// Fetched emails get their body text when they are decoded
+	for i := range m.sampleEmails {
+		m.sampleEmails[i].BodyText = m.sampleEmails[i].bodyText()
+	}
+}
+
+// mockLists are the senders that mail through a mailing list, with their
+// List-Id and whether they support one-click unsubscribe
+var mockLists = map[string]struct {
+	listID   string
+	oneClick bool
+}{
+	"notifications@github.com":  {"GitHub Notifications <notifications.github.com>", true},
+	"newsletter@techcrunch.com": {"TechCrunch Daily <daily.techcrunch.com>", true},
+	"updates@docker.com":        {"Docker Updates <updates.docker.com>", false},
+	"info@mailchimp.com":        {"Mailchimp News <news.mailchimp.com>", true},
+}
+
+// addMockListHeaders gives emails from list senders the mailing list headers
+// a real newsletter would carry
+func addMockListHeaders(email *Email, sender string) {
+	list, ok := mockLists[sender]
+	if !ok {
+		return
+	}
+
+	domain := sender[strings.Index(sender, "@")+1:]
+	email.ListID = list.listID
+	email.ListUnsubscribe = []string{
+		"https://" + domain + "/unsubscribe?id=" + email.ID,
+		"mailto:unsubscribe@" + domain + "?subject=unsubscribe",
+	}
+	if list.oneClick {
+		email.ListUnsubscribePost = "List-Unsubscribe=One-Click"
+	}
+	email.Precedence = "bulk"
 }
 
 // extractNameFromEmail creates a display name from an email address
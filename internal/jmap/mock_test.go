@@ -1,7 +1,10 @@
 package jmap
 
 import (
+	"context"
+	"errors"
 	"testing"
+	"time"
 )
 
 func TestNewMockClient(t *testing.T) {
@@ -19,14 +22,14 @@ func TestNewMockClient(t *testing.T) {
 		t.Error("NewMockClient() should generate sample emails")
 	}
 
-	if client.archivedIDs == nil {
-		t.Error("NewMockClient() archivedIDs is nil")
+	if client.movedTo == nil {
+		t.Error("NewMockClient() movedTo is nil")
 	}
 }
 
 func TestMockClient_Authenticate(t *testing.T) {
 	client := NewMockClient()
-	err := client.Authenticate()
+	err := client.Authenticate(context.Background())
 
 	if err != nil {
 		t.Errorf("MockClient.Authenticate() unexpected error = %v", err)
@@ -44,7 +47,7 @@ func TestMockClient_GetPrimaryAccount(t *testing.T) {
 
 func TestMockClient_GetMailboxes(t *testing.T) {
 	client := NewMockClient()
-	mailboxes, err := client.GetMailboxes()
+	mailboxes, err := client.GetMailboxes(context.Background())
 
 	if err != nil {
 		t.Errorf("MockClient.GetMailboxes() unexpected error = %v", err)
@@ -102,7 +105,7 @@ func TestMockClient_GetInboxEmails(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			emails, err := client.GetInboxEmails(tt.limit)
+			emails, err := client.GetInboxEmails(context.Background(), tt.limit)
 			if err != nil {
 				t.Errorf("MockClient.GetInboxEmails() unexpected error = %v", err)
 			}
@@ -146,7 +149,7 @@ func TestMockClient_GetInboxEmailsPaginated(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			emails, err := client.GetInboxEmailsPaginated(tt.limit, tt.offset)
+			emails, err := client.GetInboxEmailsPaginated(context.Background(), tt.limit, tt.offset)
 
 			if tt.wantErr {
 				if err == nil {
@@ -169,7 +172,7 @@ func TestMockClient_GetInboxEmailsPaginated(t *testing.T) {
 func TestMockClient_GetInboxEmailsWithCount(t *testing.T) {
 	client := NewMockClient()
 
-	info, err := client.GetInboxEmailsWithCount(10)
+	info, err := client.GetInboxEmailsWithCount(context.Background(), 10)
 	if err != nil {
 		t.Errorf("MockClient.GetInboxEmailsWithCount() unexpected error = %v", err)
 	}
@@ -197,13 +200,13 @@ func TestMockClient_GetInboxEmailsWithCountPaginated(t *testing.T) {
 	client := NewMockClient()
 
 	// Get first page
-	info1, err := client.GetInboxEmailsWithCountPaginated(5, 0)
+	info1, err := client.GetInboxEmailsWithCountPaginated(context.Background(), 5, 0)
 	if err != nil {
 		t.Fatalf("MockClient.GetInboxEmailsWithCountPaginated() first page error = %v", err)
 	}
 
 	// Get second page
-	info2, err := client.GetInboxEmailsWithCountPaginated(5, 5)
+	info2, err := client.GetInboxEmailsWithCountPaginated(context.Background(), 5, 5)
 	if err != nil {
 		t.Fatalf("MockClient.GetInboxEmailsWithCountPaginated() second page error = %v", err)
 	}
@@ -257,12 +260,12 @@ func TestMockClient_ArchiveEmails(t *testing.T) {
 			// Count non-archived emails before
 			nonArchivedBefore := 0
 			for _, email := range client.sampleEmails {
-				if !client.archivedIDs[email.ID] {
+				if client.movedTo[email.ID] == "" {
 					nonArchivedBefore++
 				}
 			}
 
-			err := client.ArchiveEmails(tt.emailIDs, tt.dryRun)
+			_, err := client.ArchiveEmails(context.Background(), tt.emailIDs, tt.dryRun)
 
 			if tt.wantErr {
 				if err == nil {
@@ -282,14 +285,14 @@ func TestMockClient_ArchiveEmails(t *testing.T) {
 				// In dry run mode, emails should not be archived
 				if tt.dryRun {
 					for _, id := range tt.emailIDs {
-						if client.archivedIDs[id] {
+						if client.movedTo[id] != "" {
 							t.Errorf("MockClient.ArchiveEmails() in dry run mode but email %s was archived", id)
 						}
 					}
 				} else {
 					// In real mode, emails should be marked as archived
 					for _, id := range tt.emailIDs {
-						if !client.archivedIDs[id] {
+						if client.movedTo[id] == "" {
 							t.Errorf("MockClient.ArchiveEmails() email %s should be archived", id)
 						}
 					}
@@ -303,7 +306,7 @@ func TestMockClient_ArchiveAndRetrieve(t *testing.T) {
 	client := NewMockClient()
 
 	// Get initial inbox count
-	initialEmails, err := client.GetInboxEmails(100)
+	initialEmails, err := client.GetInboxEmails(context.Background(), 100)
 	if err != nil {
 		t.Fatalf("Failed to get initial emails: %v", err)
 	}
@@ -315,13 +318,13 @@ func TestMockClient_ArchiveAndRetrieve(t *testing.T) {
 
 	// Archive some emails
 	emailsToArchive := []string{initialEmails[0].ID, initialEmails[1].ID}
-	err = client.ArchiveEmails(emailsToArchive, false)
+	_, err = client.ArchiveEmails(context.Background(), emailsToArchive, false)
 	if err != nil {
 		t.Fatalf("Failed to archive emails: %v", err)
 	}
 
 	// Get inbox emails again
-	afterEmails, err := client.GetInboxEmails(100)
+	afterEmails, err := client.GetInboxEmails(context.Background(), 100)
 	if err != nil {
 		t.Fatalf("Failed to get emails after archiving: %v", err)
 	}
@@ -387,3 +390,166 @@ func TestMockClient_GenerateSampleEmails(t *testing.T) {
 		t.Error("generateSampleEmails() should create groups of similar emails from same senders")
 	}
 }
+
+func TestMockClient_EmitStateChange(t *testing.T) {
+	client := NewMockClient()
+
+	changes, cancel := client.Subscribe()
+	defer cancel()
+
+	client.EmitStateChange()
+	client.EmitStateChange("Email", "Mailbox")
+
+	first := <-changes
+	if first.Changed[client.GetPrimaryAccount()]["Email"] == "" {
+		t.Errorf("EmitStateChange() default change = %+v, want Email state", first)
+	}
+
+	second := <-changes
+	account := second.Changed[client.GetPrimaryAccount()]
+	if len(account) != 2 || account["Mailbox"] == "" {
+		t.Errorf("EmitStateChange(Email, Mailbox) change = %+v", second)
+	}
+	if account["Email"] == first.Changed[client.GetPrimaryAccount()]["Email"] {
+		t.Error("EmitStateChange() should advance the state string")
+	}
+}
+
+func TestMockClient_ArchiveEmails_PartialFailure(t *testing.T) {
+	client := NewMockClient()
+
+	if _, err := client.ArchiveEmails(context.Background(), []string{"email-0-0"}, false); err != nil {
+		t.Fatalf("ArchiveEmails() unexpected error = %v", err)
+	}
+
+	result, err := client.ArchiveEmails(context.Background(), []string{"email-0-0", "email-0-1", "does-not-exist"}, false)
+	if err != nil {
+		t.Fatalf("ArchiveEmails() unexpected error = %v", err)
+	}
+
+	if len(result.Moved) != 1 || result.Moved[0] != "email-0-1" {
+		t.Errorf("ArchiveEmails() Moved = %v, want [email-0-1]", result.Moved)
+	}
+	if len(result.Failed) != 2 {
+		t.Fatalf("ArchiveEmails() Failed = %+v, want 2 failures", result.Failed)
+	}
+	for _, failure := range result.Failed {
+		if failure.Type != "notFound" {
+			t.Errorf("ArchiveEmails() failure %s type = %q, want notFound", failure.ID, failure.Type)
+		}
+	}
+}
+
+func TestMockClient_UndoArchive(t *testing.T) {
+	client := NewMockClient()
+
+	before, _ := client.GetInboxEmailsWithCount(context.Background(), 100)
+
+	first, _ := client.ArchiveEmails(context.Background(), []string{"email-0-0", "email-0-1"}, false)
+	second, _ := client.ArchiveEmails(context.Background(), []string{"email-1-0"}, false)
+
+	// Undo the older operation first; any of the last N can be undone
+	result, err := client.UndoArchive(context.Background(), first.JournalID, false)
+	if err != nil {
+		t.Fatalf("UndoArchive() unexpected error = %v", err)
+	}
+	if len(result.Restored) != 2 || len(result.Failed) != 0 {
+		t.Errorf("UndoArchive() = %+v, want 2 restored", result)
+	}
+
+	if client.movedTo["email-0-0"] != "" || client.movedTo["email-1-0"] == "" {
+		t.Error("UndoArchive() restored the wrong emails")
+	}
+
+	if _, err := client.UndoArchive(context.Background(), first.JournalID, false); err == nil {
+		t.Error("UndoArchive() of an already undone entry should fail")
+	}
+
+	if _, err := client.UndoArchive(context.Background(), "", true); err != nil {
+		t.Errorf("UndoArchive() dry run unexpected error = %v", err)
+	}
+	if client.movedTo["email-1-0"] == "" {
+		t.Error("UndoArchive() dry run should not restore emails")
+	}
+
+	if _, err := client.UndoArchive(context.Background(), second.JournalID, false); err != nil {
+		t.Fatalf("UndoArchive() unexpected error = %v", err)
+	}
+
+	after, _ := client.GetInboxEmailsWithCount(context.Background(), 100)
+	if after.TotalCount != before.TotalCount {
+		t.Errorf("inbox count after undoing everything = %d, want %d", after.TotalCount, before.TotalCount)
+	}
+
+	history := client.ArchiveHistory(10)
+	if len(history) != 2 || !history[0].Undone || !history[1].Undone {
+		t.Errorf("ArchiveHistory() = %+v, want both entries undone", history)
+	}
+}
+
+func TestMockClient_MoveEmails(t *testing.T) {
+	client := NewMockClient()
+
+	result, err := client.MoveEmails(context.Background(), []string{"email-0-0"}, "folder-tech", false)
+	if err != nil {
+		t.Fatalf("MoveEmails() unexpected error = %v", err)
+	}
+	if len(result.Moved) != 1 || client.movedTo["email-0-0"] != "folder-tech" {
+		t.Errorf("MoveEmails() = %+v, email-0-0 moved to %q", result, client.movedTo["email-0-0"])
+	}
+
+	if _, err := client.MoveEmails(context.Background(), []string{"email-1-0"}, "shared-announcements", false); !errors.Is(err, ErrMailboxNotWritable) {
+		t.Errorf("MoveEmails() to read-only mailbox error = %v, want ErrMailboxNotWritable", err)
+	}
+	if client.movedTo["email-1-0"] != "" {
+		t.Error("MoveEmails() moved an email to a read-only mailbox")
+	}
+
+	if _, err := client.UndoArchive(context.Background(), result.JournalID, false); err != nil {
+		t.Fatalf("UndoArchive() of a move unexpected error = %v", err)
+	}
+	if client.movedTo["email-0-0"] != "" {
+		t.Error("UndoArchive() did not move email-0-0 back to the inbox")
+	}
+}
+
+func TestMockClient_Cancelled(t *testing.T) {
+	client := NewMockClient()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := client.Authenticate(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Authenticate() error = %v, want context.Canceled", err)
+	}
+	if _, err := client.GetInboxEmailsWithCount(ctx, 10); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetInboxEmailsWithCount() error = %v, want context.Canceled", err)
+	}
+	if _, err := client.MoveEmails(ctx, []string{"mock-email-1"}, "folder-receipts", false); !errors.Is(err, context.Canceled) {
+		t.Errorf("MoveEmails() error = %v, want context.Canceled", err)
+	}
+
+	emails, _ := client.GetInboxEmails(context.Background(), 100)
+	if _, err := client.ArchiveEmails(ctx, []string{emails[0].ID}, false); !errors.Is(err, context.Canceled) {
+		t.Errorf("ArchiveEmails() error = %v, want context.Canceled", err)
+	}
+	if after, _ := client.GetInboxEmails(context.Background(), 100); len(after) != len(emails) {
+		t.Errorf("cancelled ArchiveEmails() moved emails: %d -> %d", len(emails), len(after))
+	}
+}
+
+func TestMockClient_Latency(t *testing.T) {
+	client := NewMockClient()
+	client.SetLatency(time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := client.GetMailboxes(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetMailboxes() error = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("GetMailboxes() took %v after the deadline", elapsed)
+	}
+}
@@ -0,0 +1,205 @@
+package jmap
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StateChange is a push notification telling which data types changed state
+// in which accounts (RFC 8620 section 7.1). Changed maps account ID to type
+// name (e.g. "Email", "Mailbox") to the new state string.
+type StateChange struct {
+	Type    string                       `json:"@type"`
+	Changed map[string]map[string]string `json:"changed"`
+}
+
+// StateNotifier is implemented by clients that can push state changes to
+// subscribers. The returned function cancels the subscription.
+type StateNotifier interface {
+	Subscribe() (<-chan StateChange, func())
+}
+
+// pushReconnectDelay is how long WatchPush waits before reconnecting a
+// dropped event source connection.
+var pushReconnectDelay = 5 * time.Second
+
+// eventSourceURL expands the session's eventSourceUrl template
+// (RFC 8620 section 7.3) for the given types.
+func eventSourceURL(template string, types []string, pingSeconds int) string {
+	replacer := strings.NewReplacer(
+		"{types}", strings.Join(types, ","),
+		"{closeafter}", "no",
+		"{ping}", fmt.Sprintf("%d", pingSeconds),
+	)
+	return replacer.Replace(template)
+}
+
+// WatchEvents connects to the JMAP event source and calls handler for every
+// StateChange until the connection ends or stop is closed. When the event
+// source rejects the session it is refreshed, so the next connection uses
+// the new one.
+func (c *Client) WatchEvents(types []string, stop <-chan struct{}, handler func(StateChange)) error {
+	session := c.currentSession()
+	if session == nil {
+		return fmt.Errorf("client not authenticated")
+	}
+	if session.EventSourceUrl == "" {
+		return fmt.Errorf("server does not advertise an event source")
+	}
+
+	// Closing stop cancels the request, whether it is still connecting or
+	// already reading the stream
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if stop != nil {
+		go func() {
+			select {
+			case <-stop:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", eventSourceURL(session.EventSourceUrl, types, 30), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create event source request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+c.apiToken)
+	req.Header.Set("Accept", "text/event-stream")
+
+	// The shared client has an overall timeout, which would cut the stream
+	eventClient := &http.Client{Transport: c.httpClient.Transport}
+	resp, err := eventClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to connect to event source: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		reqErr := newRequestError(resp)
+		if isStaleSession(reqErr) {
+			log.Printf("JMAP session looks stale (%v)", reqErr)
+			if err := c.refreshSession(ctx, session); err != nil {
+				return fmt.Errorf("failed to refresh session: %w", err)
+			}
+		}
+		return fmt.Errorf("event source failed: %w", reqErr)
+	}
+
+	err = readEventStream(resp.Body, func(event, data string) {
+		if event != "state" {
+			return
+		}
+		var change StateChange
+		if err := json.Unmarshal([]byte(data), &change); err != nil {
+			log.Printf("Ignoring malformed state change: %v", err)
+			return
+		}
+		handler(change)
+	})
+
+	select {
+	case <-stop:
+		return nil
+	default:
+		return err
+	}
+}
+
+// readEventStream parses a text/event-stream body and calls dispatch for each
+// complete event.
+func readEventStream(r io.Reader, dispatch func(event, data string)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var event string
+	var data []string
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if line == "" {
+			if len(data) > 0 {
+				if event == "" {
+					event = "message"
+				}
+				dispatch(event, strings.Join(data, "\n"))
+			}
+			event = ""
+			data = nil
+			continue
+		}
+
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+// broadcaster fans state changes out to subscribers. Slow subscribers miss
+// notifications rather than blocking the publisher.
+type broadcaster struct {
+	mu   sync.Mutex
+	subs map[chan StateChange]struct{}
+}
+
+func (b *broadcaster) subscribe() (<-chan StateChange, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.subs == nil {
+		b.subs = make(map[chan StateChange]struct{})
+	}
+
+	ch := make(chan StateChange, 8)
+	b.subs[ch] = struct{}{}
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			delete(b.subs, ch)
+			close(ch)
+		})
+	}
+
+	return ch, cancel
+}
+
+func (b *broadcaster) publish(change StateChange) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs {
+		select {
+		case ch <- change:
+		default:
+		}
+	}
+}
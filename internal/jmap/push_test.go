@@ -0,0 +1,180 @@
+package jmap
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventSourceURL(t *testing.T) {
+	got := eventSourceURL("https://example.com/events?types={types}&closeafter={closeafter}&ping={ping}",
+		[]string{"Email", "Mailbox"}, 30)
+	want := "https://example.com/events?types=Email,Mailbox&closeafter=no&ping=30"
+	if got != want {
+		t.Errorf("eventSourceURL() = %q, want %q", got, want)
+	}
+}
+
+func TestReadEventStream(t *testing.T) {
+	stream := ": comment\n" +
+		"event: ping\n" +
+		"data: {\"interval\":30}\n" +
+		"\n" +
+		"event: state\n" +
+		"data: {\"@type\":\"StateChange\",\n" +
+		"data:\"changed\":{}}\n" +
+		"\n" +
+		"data: no event name\n" +
+		"\n"
+
+	type event struct{ name, data string }
+	var got []event
+	err := readEventStream(strings.NewReader(stream), func(name, data string) {
+		got = append(got, event{name, data})
+	})
+	if err == nil {
+		t.Error("readEventStream() should report the end of the stream")
+	}
+
+	want := []event{
+		{"ping", `{"interval":30}`},
+		{"state", "{\"@type\":\"StateChange\",\n\"changed\":{}}"},
+		{"message", "no event name"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readEventStream() = %q, want %q", got, want)
+	}
+}
+
+func TestClient_WatchEvents(t *testing.T) {
+	events := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("types"); got != "Email,Mailbox" {
+			t.Errorf("event source types = %q, want Email,Mailbox", got)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer test-token" {
+			t.Errorf("event source Authorization = %q", got)
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: ping\ndata: {}\n\n")
+		fmt.Fprint(w, "event: state\ndata: {\"@type\":\"StateChange\",\"changed\":{\"acc-1\":{\"Email\":\"s-2\"}}}\n\n")
+	}))
+	defer events.Close()
+
+	client := NewClient("https://example.com/session", "test-token")
+	client.session = &Session{EventSourceUrl: events.URL + "/?types={types}&closeafter={closeafter}&ping={ping}"}
+
+	var changes []StateChange
+	err := client.WatchEvents([]string{"Email", "Mailbox"}, nil, func(change StateChange) {
+		changes = append(changes, change)
+	})
+	if err == nil {
+		t.Error("WatchEvents() should report the closed stream")
+	}
+
+	if len(changes) != 1 {
+		t.Fatalf("WatchEvents() delivered %d changes, want 1", len(changes))
+	}
+	if got := changes[0].Changed["acc-1"]["Email"]; got != "s-2" {
+		t.Errorf("WatchEvents() Email state = %q, want s-2", got)
+	}
+}
+
+func TestClient_WatchEvents_Stop(t *testing.T) {
+	// The event source accepts connections but never answers them
+	release := make(chan struct{})
+	events := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer events.Close()
+	defer close(release)
+
+	client := NewClient("https://example.com/session", "test-token")
+	client.session = &Session{EventSourceUrl: events.URL}
+
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- client.WatchEvents([]string{"Email"}, stop, func(StateChange) {})
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("WatchEvents() still connecting after stop was closed")
+	}
+}
+
+func TestClient_WatchEvents_StaleSession(t *testing.T) {
+	for _, status := range []int{http.StatusUnauthorized, http.StatusNotFound} {
+		events := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "session expired", status)
+		}))
+		defer events.Close()
+
+		fake := newFakeJMAPServer(t, nil)
+		client := newFakeClient(t, fake)
+		client.session.EventSourceUrl = events.URL
+
+		err := client.WatchEvents([]string{"Email"}, nil, func(StateChange) {})
+		var reqErr *RequestError
+		if !errors.As(err, &reqErr) || reqErr.StatusCode != status {
+			t.Errorf("status %d: WatchEvents() error = %v, want the RequestError", status, err)
+		}
+		if fake.sessionFetches != 2 {
+			t.Errorf("status %d: session fetched %d times, want a refresh", status, fake.sessionFetches)
+		}
+	}
+}
+
+func TestClient_WatchEvents_NoEventSource(t *testing.T) {
+	client := NewClient("https://example.com/session", "test-token")
+	if err := client.WatchEvents(nil, nil, func(StateChange) {}); err == nil {
+		t.Error("WatchEvents() should fail when not authenticated")
+	}
+
+	client.session = &Session{}
+	if err := client.WatchEvents(nil, nil, func(StateChange) {}); err == nil {
+		t.Error("WatchEvents() should fail without an eventSourceUrl")
+	}
+}
+
+func TestBroadcaster(t *testing.T) {
+	var b broadcaster
+
+	ch1, cancel1 := b.subscribe()
+	ch2, cancel2 := b.subscribe()
+	defer cancel2()
+
+	b.publish(StateChange{Type: "StateChange"})
+
+	for i, ch := range []<-chan StateChange{ch1, ch2} {
+		select {
+		case change := <-ch:
+			if change.Type != "StateChange" {
+				t.Errorf("subscriber %d got %+v", i, change)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("subscriber %d did not receive the change", i)
+		}
+	}
+
+	cancel1()
+	cancel1() // cancelling twice must be safe
+	if _, ok := <-ch1; ok {
+		t.Error("cancelled subscription channel should be closed")
+	}
+
+	// Publishing after a subscriber left must not panic
+	b.publish(StateChange{Type: "StateChange"})
+}
@@ -0,0 +1,206 @@
+package jmap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Request-level error types a JMAP server reports as RFC 7807 problem
+// details (RFC 8620 section 3.6.1).
+const (
+	ProblemUnknownCapability = "urn:ietf:params:jmap:error:unknownCapability"
+	ProblemNotJSON           = "urn:ietf:params:jmap:error:notJSON"
+	ProblemNotRequest        = "urn:ietf:params:jmap:error:notRequest"
+	ProblemLimit             = "urn:ietf:params:jmap:error:limit"
+)
+
+// RequestError is an HTTP response other than 200 OK. When the server sent
+// problem details they are decoded into Type, Title, Detail and Limit;
+// otherwise Body holds the raw response.
+type RequestError struct {
+	StatusCode int           `json:"-"`
+	Type       string        `json:"type"`
+	Title      string        `json:"title"`
+	Detail     string        `json:"detail"`
+	Limit      string        `json:"limit"`
+	Body       string        `json:"-"`
+	RetryAfter time.Duration `json:"-"`
+}
+
+func (e *RequestError) Error() string {
+	if e.Type == "" {
+		return fmt.Sprintf("request failed: %d - %s", e.StatusCode, e.Body)
+	}
+
+	msg := fmt.Sprintf("request failed: %d %s", e.StatusCode, e.Type)
+	if e.Limit != "" {
+		msg += " (" + e.Limit + ")"
+	}
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	} else if e.Title != "" {
+		msg += ": " + e.Title
+	}
+	return msg
+}
+
+// Temporary reports whether the request may succeed if sent again later
+func (e *RequestError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode == http.StatusServiceUnavailable
+}
+
+// newRequestError reads a failed response into a RequestError
+func newRequestError(resp *http.Response) *RequestError {
+	body, _ := io.ReadAll(resp.Body)
+
+	reqErr := &RequestError{}
+	if json.Unmarshal(body, reqErr) != nil || reqErr.Type == "" {
+		reqErr = &RequestError{Body: string(body)}
+	}
+	reqErr.StatusCode = resp.StatusCode
+	reqErr.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+
+	return reqErr
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as
+// an HTTP date. It returns zero when the header is missing or invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	if at, err := http.ParseTime(value); err == nil {
+		if wait := at.Sub(now); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+// RetryPolicy controls how often and how patiently failed requests are
+// retried. Only rate limiting (429), unavailability (503) and failures to
+// connect are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts per request, including the
+	// first one. 1 disables retries.
+	MaxAttempts int
+	// BaseDelay is the backoff before the first retry; it doubles with every
+	// further attempt.
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff. A Retry-After longer than this makes the
+	// client give up instead of waiting.
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy is used by clients created with NewClient
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    30 * time.Second,
+}
+
+// SetRetryPolicy replaces the retry policy for requests to the server
+func (c *Client) SetRetryPolicy(policy RetryPolicy) {
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+	c.retryPolicy = policy
+}
+
+// backoff returns how long to wait before retry number attempt (starting at
+// 0): exponential in the attempt, capped at MaxDelay, with the upper half
+// jittered so clients that failed together do not retry together.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 0; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+// isRetryable reports whether err is worth retrying: a rate limit or
+// unavailability response, or a failure to connect to the server. Requests
+// that reached the server are not retried when their response is lost, as
+// the server may have carried them out: sending an email again would send
+// it twice. Nothing is retried once ctx is done.
+func isRetryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var reqErr *RequestError
+	if errors.As(err, &reqErr) {
+		return reqErr.Temporary()
+	}
+
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// sleepContext waits for d or until ctx is cancelled, whichever comes first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// withRetry calls do until it succeeds, fails with an error that is not
+// worth retrying, the retry policy is exhausted or ctx is cancelled.
+func (c *Client) withRetry(ctx context.Context, do func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := do()
+		if err == nil {
+			return nil
+		}
+		if !isRetryable(ctx, err) || attempt+1 >= c.retryPolicy.MaxAttempts {
+			return err
+		}
+
+		delay := c.retryPolicy.backoff(attempt)
+		var reqErr *RequestError
+		if errors.As(err, &reqErr) && reqErr.RetryAfter > 0 {
+			if reqErr.RetryAfter > c.retryPolicy.MaxDelay {
+				return err
+			}
+			delay = reqErr.RetryAfter
+		}
+
+		log.Printf("JMAP request failed (%v), retrying in %v", err, delay)
+		if err := c.sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,347 @@
+package jmap
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// newFlakyClient returns a client whose API requests go to handler and whose
+// retry delays are recorded instead of slept.
+func newFlakyClient(t *testing.T, handler http.HandlerFunc) (*Client, *[]time.Duration) {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	var delays []time.Duration
+	client := NewClient(srv.URL, "test-token")
+	client.session = &Session{APIUrl: srv.URL, State: "s"}
+	client.sleep = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+	return client, &delays
+}
+
+func okResponse(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, `{"methodResponses":[["Core/echo",{},"0"]],"sessionState":"s"}`)
+}
+
+func TestMakeRequest_RetriesUnavailable(t *testing.T) {
+	var attempts int32
+	client, delays := newFlakyClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) <= 2 {
+			http.Error(w, "try later", http.StatusServiceUnavailable)
+			return
+		}
+		okResponse(w)
+	})
+
+	if _, err := client.makeRequest(context.Background(), []MethodCall{{"Core/echo", map[string]interface{}{}, "0"}}); err != nil {
+		t.Fatalf("makeRequest() unexpected error = %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("makeRequest() made %d attempts, want 3", attempts)
+	}
+	if len(*delays) != 2 {
+		t.Fatalf("makeRequest() slept %d times, want 2", len(*delays))
+	}
+	if (*delays)[1] < DefaultRetryPolicy.BaseDelay {
+		t.Errorf("second backoff %v should be at least the base delay", (*delays)[1])
+	}
+}
+
+func TestMakeRequest_HonoursRetryAfter(t *testing.T) {
+	var attempts int32
+	client, delays := newFlakyClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		okResponse(w)
+	})
+
+	if _, err := client.makeRequest(context.Background(), nil); err != nil {
+		t.Fatalf("makeRequest() unexpected error = %v", err)
+	}
+	if len(*delays) != 1 || (*delays)[0] != 2*time.Second {
+		t.Errorf("makeRequest() delays = %v, want [2s]", *delays)
+	}
+}
+
+func TestMakeRequest_RetryAfterBeyondBudget(t *testing.T) {
+	var attempts int32
+	client, _ := newFlakyClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	_, err := client.makeRequest(context.Background(), nil)
+	var reqErr *RequestError
+	if !errors.As(err, &reqErr) || reqErr.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("makeRequest() error = %v, want a 429 RequestError", err)
+	}
+	if attempts != 1 {
+		t.Errorf("makeRequest() made %d attempts, want 1 when Retry-After exceeds MaxDelay", attempts)
+	}
+}
+
+func TestMakeRequest_BudgetExhausted(t *testing.T) {
+	var attempts int32
+	client, delays := newFlakyClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	client.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: 4 * time.Second})
+
+	_, err := client.makeRequest(context.Background(), nil)
+	if !isRetryable(context.Background(), err) {
+		t.Errorf("makeRequest() error = %v, want the last 503", err)
+	}
+	if attempts != 3 || len(*delays) != 2 {
+		t.Errorf("makeRequest() made %d attempts with %d delays, want 3 and 2", attempts, len(*delays))
+	}
+}
+
+func TestMakeRequest_ProblemDetails(t *testing.T) {
+	var attempts int32
+	client, _ := newFlakyClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"type":"urn:ietf:params:jmap:error:limit","status":400,"limit":"maxCallsInRequest","detail":"Too many calls"}`)
+	})
+
+	_, err := client.makeRequest(context.Background(), nil)
+
+	var reqErr *RequestError
+	if !errors.As(err, &reqErr) {
+		t.Fatalf("makeRequest() error = %v, want a RequestError", err)
+	}
+	if reqErr.Type != ProblemLimit || reqErr.Limit != "maxCallsInRequest" || reqErr.Detail != "Too many calls" {
+		t.Errorf("makeRequest() problem = %+v", reqErr)
+	}
+	if attempts != 1 {
+		t.Errorf("makeRequest() retried a request-level error %d times", attempts-1)
+	}
+}
+
+func TestMakeRequest_RetriesFailedConnections(t *testing.T) {
+	var attempts int32
+	client, delays := newFlakyClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		okResponse(w)
+	})
+	// The first connection is refused before the request is sent
+	var dials int32
+	client.httpClient.Transport = &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if atomic.AddInt32(&dials, 1) == 1 {
+				return nil, &net.OpError{Op: "dial", Net: network, Err: syscall.ECONNREFUSED}
+			}
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}
+
+	if _, err := client.makeRequest(context.Background(), nil); err != nil {
+		t.Fatalf("makeRequest() unexpected error = %v", err)
+	}
+	if attempts != 1 || len(*delays) != 1 {
+		t.Errorf("makeRequest() reached the server %d times with %d delays, want 1 and 1", attempts, len(*delays))
+	}
+}
+
+func TestMakeRequest_DroppedConnectionNotRetried(t *testing.T) {
+	var attempts int32
+	client, delays := newFlakyClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		// Drop the connection without answering, after the request arrived
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	})
+
+	if _, err := client.makeRequest(context.Background(), nil); err == nil {
+		t.Fatal("makeRequest() succeeded, want the dropped connection reported")
+	}
+	if n := atomic.LoadInt32(&attempts); n != 1 || len(*delays) != 0 {
+		t.Errorf("makeRequest() made %d attempts with %d delays, want 1 and 0", n, len(*delays))
+	}
+}
+
+func TestAuthenticate_Retries(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"apiUrl":"https://example.com/api"}`)
+	}))
+	defer srv.Close()
+
+	client := NewClient(srv.URL, "test-token")
+	client.sleep = func(context.Context, time.Duration) error { return nil }
+
+	if err := client.Authenticate(context.Background()); err != nil {
+		t.Fatalf("Authenticate() unexpected error = %v", err)
+	}
+	if attempts != 2 {
+		t.Errorf("Authenticate() made %d attempts, want 2", attempts)
+	}
+}
+
+func TestMakeRequest_Cancelled(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	var attempts int32
+	client, _ := newFlakyClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := client.makeRequest(ctx, []MethodCall{{"Core/echo", map[string]interface{}{}, "0"}})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("makeRequest() error = %v, want context.DeadlineExceeded", err)
+	}
+	if n := atomic.LoadInt32(&attempts); n != 1 {
+		t.Errorf("makeRequest() made %d attempts, want 1", n)
+	}
+}
+
+func TestMakeRequest_CancelledDuringBackoff(t *testing.T) {
+	var attempts int32
+	client, _ := newFlakyClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		http.Error(w, "try later", http.StatusServiceUnavailable)
+	})
+	client.sleep = sleepContext
+	client.SetRetryPolicy(RetryPolicy{MaxAttempts: 4, BaseDelay: time.Hour, MaxDelay: time.Hour})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := client.makeRequest(ctx, []MethodCall{{"Core/echo", map[string]interface{}{}, "0"}})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("makeRequest() error = %v, want context.DeadlineExceeded", err)
+	}
+	if n := atomic.LoadInt32(&attempts); n != 1 {
+		t.Errorf("makeRequest() made %d attempts, want 1", n)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	// transport wraps err the way the HTTP client reports a failed request
+	transport := func(err error) error {
+		return fmt.Errorf("failed to make request: %w", &url.Error{Op: "Post", URL: "https://jmap.example.com/api", Err: err})
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"rate limited", &RequestError{StatusCode: http.StatusTooManyRequests}, true},
+		{"unavailable", &RequestError{StatusCode: http.StatusServiceUnavailable}, true},
+		{"bad request", &RequestError{StatusCode: http.StatusBadRequest}, false},
+		{"connection refused", transport(&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}), true},
+		{"dial timeout", transport(&net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded}), true},
+		{"response timeout", transport(os.ErrDeadlineExceeded), false},
+		{"connection reset", transport(&net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}), false},
+		{"connection closed", transport(io.EOF), false},
+		{"unsupported scheme", transport(errors.New("unsupported protocol scheme \"ftp\"")), false},
+		{"bad certificate", transport(&tls.CertificateVerificationError{Err: errors.New("unknown authority")}), false},
+		{"cancelled", transport(context.Canceled), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryable(context.Background(), tt.err); got != tt.want {
+				t.Errorf("isRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if isRetryable(ctx, transport(&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED})) {
+		t.Error("isRetryable() with a cancelled context = true, want false")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"5", 5 * time.Second},
+		{"-1", 0},
+		{"Mon, 01 Jan 2024 12:00:30 GMT", 30 * time.Second},
+		{"Mon, 01 Jan 2024 11:00:00 GMT", 0},
+		{"soon", 0},
+	}
+
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	for attempt := 0; attempt < 8; attempt++ {
+		full := policy.BaseDelay << attempt
+		if full > policy.MaxDelay {
+			full = policy.MaxDelay
+		}
+		for i := 0; i < 20; i++ {
+			got := policy.backoff(attempt)
+			if got < full/2 || got > full {
+				t.Fatalf("backoff(%d) = %v, want between %v and %v", attempt, got, full/2, full)
+			}
+		}
+	}
+}
+
+func TestRequestError_Error(t *testing.T) {
+	tests := []struct {
+		err  *RequestError
+		want string
+	}{
+		{&RequestError{StatusCode: 500, Body: "boom"}, "request failed: 500 - boom"},
+		{&RequestError{StatusCode: 400, Type: ProblemNotRequest, Detail: "missing using"}, "request failed: 400 urn:ietf:params:jmap:error:notRequest: missing using"},
+		{&RequestError{StatusCode: 400, Type: ProblemLimit, Limit: "maxSizeRequest"}, "request failed: 400 urn:ietf:params:jmap:error:limit (maxSizeRequest)"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.err.Error(); got != tt.want {
+			t.Errorf("Error() = %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package jmap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// SessionHealth describes the JMAP session a client is working with
+type SessionHealth struct {
+	Authenticated bool       `json:"authenticated"`
+	Healthy       bool       `json:"healthy"`
+	Username      string     `json:"username,omitempty"`
+	State         string     `json:"state,omitempty"`
+	APIUrl        string     `json:"apiUrl,omitempty"`
+	FetchedAt     time.Time  `json:"fetchedAt"`
+	Refreshes     int        `json:"refreshes"`
+	LastError     string     `json:"lastError,omitempty"`
+	LastErrorAt   *time.Time `json:"lastErrorAt,omitempty"`
+}
+
+// SessionReporter is implemented by clients that can report the health of
+// their JMAP session.
+type SessionReporter interface {
+	SessionHealth() SessionHealth
+}
+
+// currentSession returns the session requests should currently be sent to
+func (c *Client) currentSession() *Session {
+	c.sessionMu.RLock()
+	defer c.sessionMu.RUnlock()
+	return c.session
+}
+
+// SessionHealth reports the current session and the outcome of the last
+// attempt to fetch it
+func (c *Client) SessionHealth() SessionHealth {
+	c.sessionMu.RLock()
+	defer c.sessionMu.RUnlock()
+
+	health := SessionHealth{
+		Authenticated: c.session != nil,
+		Healthy:       c.session != nil && c.sessionErr == "",
+		FetchedAt:     c.sessionFetchedAt,
+		Refreshes:     c.sessionRefreshes,
+		LastError:     c.sessionErr,
+	}
+	if c.session != nil {
+		health.Username = c.session.Username
+		health.State = c.session.State
+		health.APIUrl = c.session.APIUrl
+	}
+	if c.sessionErr != "" {
+		at := c.sessionErrAt
+		health.LastErrorAt = &at
+	}
+	return health
+}
+
+// loadSession fetches the session resource and makes it the current session.
+// Callers must hold refreshMu.
+func (c *Client) loadSession(ctx context.Context) error {
+	var session Session
+	err := c.withRetry(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, "GET", c.endpoint, nil)
+		if err != nil {
+			return fmt.Errorf("failed to create session request: %w", err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+c.apiToken)
+		req.Header.Set("Accept", "application/json")
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to get session: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("authentication failed: %w", newRequestError(resp))
+		}
+
+		if err := json.NewDecoder(resp.Body).Decode(&session); err != nil {
+			return fmt.Errorf("failed to decode session: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		c.setSessionError(err)
+		return err
+	}
+
+	c.sessionMu.Lock()
+	defer c.sessionMu.Unlock()
+
+	if c.session != nil {
+		c.sessionRefreshes++
+	}
+	c.session = &session
+	c.limits = parseCoreLimits(session.Capabilities)
+	c.sessionFetchedAt = time.Now()
+	c.sessionErr = ""
+	return nil
+}
+
+// setSessionError records why the current session could not be used
+func (c *Client) setSessionError(err error) {
+	c.sessionMu.Lock()
+	defer c.sessionMu.Unlock()
+	c.sessionErr = err.Error()
+	c.sessionErrAt = time.Now()
+}
+
+// clearSessionError forgets a recorded session problem once a request
+// succeeded again
+func (c *Client) clearSessionError() {
+	c.sessionMu.Lock()
+	defer c.sessionMu.Unlock()
+	c.sessionErr = ""
+}
+
+// refreshSession re-fetches the session after stale was found to be out of
+// date. Concurrent callers that saw the same stale session share one fetch.
+func (c *Client) refreshSession(ctx context.Context, stale *Session) error {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	if c.currentSession() != stale {
+		return nil
+	}
+
+	log.Printf("Refreshing JMAP session (state %s)", stale.State)
+	return c.loadSession(ctx)
+}
+
+// isStaleSession reports whether a request failed because the session it was
+// sent with is no longer valid: the token was rejected, or the API URL is
+// gone after the server rotated the session.
+func isStaleSession(err error) bool {
+	var reqErr *RequestError
+	if !errors.As(err, &reqErr) {
+		return false
+	}
+	return reqErr.StatusCode == http.StatusUnauthorized || reqErr.StatusCode == http.StatusNotFound
+}
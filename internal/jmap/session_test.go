@@ -0,0 +1,146 @@
+package jmap
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func newEchoServer(t *testing.T) *fakeJMAPServer {
+	return newFakeJMAPServer(t, map[string]fakeMethod{
+		"Core/echo": func(args map[string]interface{}) (string, map[string]interface{}) {
+			return "Core/echo", args
+		},
+	})
+}
+
+func echo(client *Client) error {
+	_, err := client.makeRequest(context.Background(), []MethodCall{{"Core/echo", map[string]interface{}{}, "0"}})
+	return err
+}
+
+func TestClient_RefreshesChangedSession(t *testing.T) {
+	f := newEchoServer(t)
+	client := newFakeClient(t, f)
+
+	f.rotateSession("session-2", "/api-v2")
+
+	// The old API URL is gone: the request is retried at the new one
+	if err := echo(client); err != nil {
+		t.Fatalf("makeRequest() after rotation unexpected error = %v", err)
+	}
+
+	health := client.SessionHealth()
+	if health.State != "session-2" || !strings.HasSuffix(health.APIUrl, "/api-v2") {
+		t.Errorf("session = %s at %s, want session-2 at /api-v2", health.State, health.APIUrl)
+	}
+	if health.Refreshes != 1 || !health.Healthy {
+		t.Errorf("health = %+v, want one refresh and healthy", health)
+	}
+}
+
+func TestClient_RefreshesOnSessionStateMismatch(t *testing.T) {
+	f := newEchoServer(t)
+	client := newFakeClient(t, f)
+
+	// Same API URL, but responses now carry a new session state
+	f.rotateSession("session-2", "/api")
+
+	if err := echo(client); err != nil {
+		t.Fatalf("makeRequest() unexpected error = %v", err)
+	}
+	if state := client.SessionHealth().State; state != "session-2" {
+		t.Errorf("session state = %s, want session-2", state)
+	}
+
+	if err := echo(client); err != nil {
+		t.Fatalf("makeRequest() unexpected error = %v", err)
+	}
+	if f.sessionFetches != 2 {
+		t.Errorf("session fetched %d times, want 2", f.sessionFetches)
+	}
+}
+
+func TestClient_RefreshesOnUnauthorized(t *testing.T) {
+	f := newEchoServer(t)
+	client := newFakeClient(t, f)
+
+	f.rejectAPI = 1
+	if err := echo(client); err != nil {
+		t.Fatalf("makeRequest() unexpected error = %v", err)
+	}
+	if f.sessionFetches != 2 || f.requests != 1 {
+		t.Errorf("session fetches = %d, requests = %d, want 2 and 1", f.sessionFetches, f.requests)
+	}
+
+	// Only one retry: a token that stays rejected fails the call
+	f.rejectAPI = 2
+	err := echo(client)
+	reqErr, ok := err.(*RequestError)
+	if !ok || reqErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("makeRequest() error = %v, want a 401 RequestError", err)
+	}
+	if health := client.SessionHealth(); health.Healthy || health.LastError == "" || health.LastErrorAt == nil {
+		t.Errorf("health = %+v, want unhealthy with the last error", health)
+	}
+}
+
+func TestClient_RefreshFails(t *testing.T) {
+	f := newEchoServer(t)
+	client := newFakeClient(t, f)
+
+	f.rejectAPI = 1
+	f.rejectSession = true
+
+	err := echo(client)
+	if err == nil || !strings.Contains(err.Error(), "failed to refresh session") {
+		t.Fatalf("makeRequest() error = %v, want a session refresh failure", err)
+	}
+
+	health := client.SessionHealth()
+	if health.Healthy || !health.Authenticated {
+		t.Errorf("health = %+v, want authenticated but unhealthy", health)
+	}
+
+	f.rejectSession = false
+	if err := echo(client); err != nil {
+		t.Fatalf("makeRequest() after recovery unexpected error = %v", err)
+	}
+	if !client.SessionHealth().Healthy {
+		t.Error("session should be healthy again after a successful request")
+	}
+}
+
+func TestClient_ConcurrentRefresh(t *testing.T) {
+	f := newEchoServer(t)
+	client := newFakeClient(t, f)
+
+	f.rotateSession("session-2", "/api-v2")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := echo(client); err != nil {
+				t.Errorf("makeRequest() unexpected error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if f.sessionFetches != 2 {
+		t.Errorf("session fetched %d times, want 2", f.sessionFetches)
+	}
+}
+
+func TestClient_SessionHealth_Unauthenticated(t *testing.T) {
+	client := NewClient("http://127.0.0.1:0/session", "test-token")
+
+	health := client.SessionHealth()
+	if health.Authenticated || health.Healthy {
+		t.Errorf("health = %+v, want unauthenticated", health)
+	}
+}
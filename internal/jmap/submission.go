@@ -0,0 +1,235 @@
+package jmap
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const submissionCapability = "urn:ietf:params:jmap:submission"
+
+// OutgoingEmail is a plain text message to send
+type OutgoingEmail struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// Mailer is implemented by clients that can send email, e.g. the messages a
+// mailto: unsubscribe link asks for.
+type Mailer interface {
+	SendEmail(ctx context.Context, msg OutgoingEmail) error
+}
+
+// Identity is an address the user may send from (RFC 8621 section 6)
+type Identity struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// IdentityGetRequest is the arguments of Identity/get. Nil IDs fetch every
+// identity.
+type IdentityGetRequest struct {
+	AccountID string   `json:"accountId"`
+	IDs       []string `json:"ids"`
+}
+
+// IdentityGetResponse is the result of Identity/get
+type IdentityGetResponse struct {
+	AccountID string     `json:"accountId"`
+	State     string     `json:"state"`
+	List      []Identity `json:"list"`
+}
+
+// EmailCreate is a new single part text/plain email for Email/set create
+type EmailCreate struct {
+	MailboxIDs map[string]bool             `json:"mailboxIds"`
+	Keywords   map[string]bool             `json:"keywords,omitempty"`
+	From       []EmailAddress              `json:"from"`
+	To         []EmailAddress              `json:"to"`
+	Subject    string                      `json:"subject"`
+	BodyValues map[string]EmailCreateValue `json:"bodyValues"`
+	TextBody   []EmailCreatePart           `json:"textBody"`
+}
+
+// EmailCreatePart is a body part of a new email, with its content in the
+// bodyValues entry of the same part ID
+type EmailCreatePart struct {
+	PartID string `json:"partId"`
+	Type   string `json:"type"`
+}
+
+// EmailCreateValue is the content of a body part of a new email
+type EmailCreateValue struct {
+	Value string `json:"value"`
+}
+
+// EmailSubmissionCreate is a new EmailSubmission: the email to send and the
+// identity to send it as (RFC 8621 section 7)
+type EmailSubmissionCreate struct {
+	IdentityID string `json:"identityId"`
+	EmailID    string `json:"emailId"`
+}
+
+// EmailSubmissionSetRequest is the arguments of EmailSubmission/set.
+// OnSuccessUpdateEmail patches the sent email, keyed by "#" and the creation
+// ID of the submission.
+type EmailSubmissionSetRequest struct {
+	AccountID             string                           `json:"accountId"`
+	Create                map[string]EmailSubmissionCreate `json:"create"`
+	OnSuccessUpdateEmail  map[string]PatchObject           `json:"onSuccessUpdateEmail,omitempty"`
+	OnSuccessDestroyEmail []string                         `json:"onSuccessDestroyEmail,omitempty"`
+}
+
+// CreatedObject is the server-set properties of a created object
+type CreatedObject struct {
+	ID string `json:"id"`
+}
+
+// EmailSubmissionSetResponse is the result of EmailSubmission/set
+type EmailSubmissionSetResponse struct {
+	AccountID  string                   `json:"accountId"`
+	Created    map[string]CreatedObject `json:"created"`
+	NotCreated map[string]SetError      `json:"notCreated"`
+}
+
+// capabilitiesFor returns the capabilities a request making these calls has
+// to declare in "using"
+func capabilitiesFor(methodCalls []MethodCall) []string {
+	using := []string{"urn:ietf:params:jmap:core", "urn:ietf:params:jmap:mail"}
+	for _, call := range methodCalls {
+		name, _ := call[0].(string)
+		if strings.HasPrefix(name, "EmailSubmission/") || strings.HasPrefix(name, "Identity/") {
+			return append(using, submissionCapability)
+		}
+	}
+	return using
+}
+
+// SendEmail creates msg as a draft and submits it in one request. Once sent
+// the email is moved from Drafts to Sent, or destroyed if there is no Sent
+// mailbox.
+func (c *Client) SendEmail(ctx context.Context, msg OutgoingEmail) error {
+	accountID := c.GetPrimaryAccount()
+	if accountID == "" {
+		return fmt.Errorf("no primary account found")
+	}
+
+	mailboxes, err := c.GetMailboxes(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get mailboxes: %w", err)
+	}
+	var draftsID, sentID string
+	for _, mailbox := range mailboxes {
+		switch mailbox.Role {
+		case "drafts":
+			draftsID = mailbox.ID
+		case "sent":
+			sentID = mailbox.ID
+		}
+	}
+	if draftsID == "" {
+		return fmt.Errorf("drafts mailbox not found")
+	}
+
+	identity, err := c.sendingIdentity(ctx, accountID)
+	if err != nil {
+		return err
+	}
+
+	draft := EmailCreate{
+		MailboxIDs: map[string]bool{draftsID: true},
+		Keywords:   map[string]bool{"$draft": true, "$seen": true},
+		From:       []EmailAddress{{Name: identity.Name, Email: identity.Email}},
+		To:         []EmailAddress{{Email: msg.To}},
+		Subject:    msg.Subject,
+		BodyValues: map[string]EmailCreateValue{"body": {Value: msg.Body}},
+		TextBody:   []EmailCreatePart{{PartID: "body", Type: "text/plain"}},
+	}
+
+	submission := EmailSubmissionSetRequest{
+		AccountID: accountID,
+		Create: map[string]EmailSubmissionCreate{
+			"send": {IdentityID: identity.ID, EmailID: "#draft"},
+		},
+	}
+	if sentID != "" {
+		submission.OnSuccessUpdateEmail = map[string]PatchObject{
+			"#send": {
+				"mailboxIds/" + draftsID: nil,
+				"mailboxIds/" + sentID:   true,
+				"keywords/$draft":        nil,
+			},
+		}
+	} else {
+		submission.OnSuccessDestroyEmail = []string{"#send"}
+	}
+
+	resp, err := c.makeRequest(ctx, []MethodCall{
+		{"Email/set", EmailSetRequest{
+			AccountID: accountID,
+			Create:    map[string]EmailCreate{"draft": draft},
+		}, "0"},
+		{"EmailSubmission/set", submission, "1"},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	var created EmailSetResponse
+	if err := resp.methodResult("0", "Email/set", &created); err != nil {
+		return fmt.Errorf("failed to create email: %w", err)
+	}
+	if setErr, ok := created.NotCreated["draft"]; ok {
+		return fmt.Errorf("failed to create email: %s", describeSetError(setErr))
+	}
+
+	var sent EmailSubmissionSetResponse
+	if err := resp.methodResult("1", "EmailSubmission/set", &sent); err != nil {
+		return fmt.Errorf("failed to submit email: %w", err)
+	}
+	if setErr, ok := sent.NotCreated["send"]; ok {
+		return fmt.Errorf("failed to submit email: %s", describeSetError(setErr))
+	}
+
+	return nil
+}
+
+// sendingIdentity picks the identity matching the session user, or the first
+// one if none does
+func (c *Client) sendingIdentity(ctx context.Context, accountID string) (*Identity, error) {
+	resp, err := c.makeRequest(ctx, []MethodCall{
+		{"Identity/get", IdentityGetRequest{AccountID: accountID}, "0"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get identities: %w", err)
+	}
+
+	var identities IdentityGetResponse
+	if err := resp.methodResult("0", "Identity/get", &identities); err != nil {
+		return nil, fmt.Errorf("failed to get identities: %w", err)
+	}
+	if len(identities.List) == 0 {
+		return nil, fmt.Errorf("no identity to send from")
+	}
+
+	username := ""
+	if session := c.currentSession(); session != nil {
+		username = session.Username
+	}
+	for i := range identities.List {
+		if strings.EqualFold(identities.List[i].Email, username) {
+			return &identities.List[i], nil
+		}
+	}
+	return &identities.List[0], nil
+}
+
+// describeSetError formats a SetError for an error message
+func describeSetError(setErr SetError) string {
+	if setErr.Description != "" {
+		return setErr.Type + ": " + setErr.Description
+	}
+	return setErr.Type
+}
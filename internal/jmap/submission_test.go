@@ -0,0 +1,198 @@
+package jmap
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newSubmissionServer(t *testing.T, mailboxes []interface{}, notSubmitted bool) *fakeJMAPServer {
+	return newFakeJMAPServer(t, map[string]fakeMethod{
+		"Mailbox/get": func(args map[string]interface{}) (string, map[string]interface{}) {
+			return "Mailbox/get", map[string]interface{}{"state": "mb-1", "list": mailboxes}
+		},
+		"Identity/get": func(args map[string]interface{}) (string, map[string]interface{}) {
+			return "Identity/get", map[string]interface{}{"list": []interface{}{
+				map[string]interface{}{"id": "id-alias", "name": "Alias", "email": "alias@example.com"},
+				map[string]interface{}{"id": "id-main", "name": "Test User", "email": "test@example.com"},
+			}}
+		},
+		"Email/set": func(args map[string]interface{}) (string, map[string]interface{}) {
+			return "Email/set", map[string]interface{}{"created": map[string]interface{}{
+				"draft": map[string]interface{}{"id": "e-new"},
+			}}
+		},
+		"EmailSubmission/set": func(args map[string]interface{}) (string, map[string]interface{}) {
+			if notSubmitted {
+				return "EmailSubmission/set", map[string]interface{}{"notCreated": map[string]interface{}{
+					"send": map[string]interface{}{"type": "forbiddenToSend", "description": "quota exceeded"},
+				}}
+			}
+			return "EmailSubmission/set", map[string]interface{}{"created": map[string]interface{}{
+				"send": map[string]interface{}{"id": "sub-1"},
+			}}
+		},
+	})
+}
+
+func TestClient_SendEmail(t *testing.T) {
+	fake := newSubmissionServer(t, []interface{}{
+		fakeMailbox("inbox", "Inbox", "inbox"),
+		fakeMailbox("drafts", "Drafts", "drafts"),
+		fakeMailbox("sent", "Sent", "sent"),
+	}, false)
+	client := newFakeClient(t, fake)
+
+	msg := OutgoingEmail{To: "leave@lists.example.com", Subject: "unsubscribe", Body: "Please remove me"}
+	if err := client.SendEmail(context.Background(), msg); err != nil {
+		t.Fatalf("SendEmail() unexpected error = %v", err)
+	}
+
+	sets := fake.callsTo("Email/set")
+	if len(sets) != 1 {
+		t.Fatalf("Email/set called %d times, want 1", len(sets))
+	}
+	draft := sets[0]["create"].(map[string]interface{})["draft"].(map[string]interface{})
+	if draft["subject"] != "unsubscribe" {
+		t.Errorf("draft subject = %v, want unsubscribe", draft["subject"])
+	}
+	if !reflect.DeepEqual(draft["mailboxIds"], map[string]interface{}{"drafts": true}) {
+		t.Errorf("draft mailboxIds = %v, want drafts", draft["mailboxIds"])
+	}
+	from := draft["from"].([]interface{})[0].(map[string]interface{})
+	if from["email"] != "test@example.com" {
+		t.Errorf("draft from = %v, want the identity of the session user", from)
+	}
+	to := draft["to"].([]interface{})[0].(map[string]interface{})
+	if to["email"] != "leave@lists.example.com" {
+		t.Errorf("draft to = %v, want leave@lists.example.com", to)
+	}
+	values := draft["bodyValues"].(map[string]interface{})["body"].(map[string]interface{})
+	if values["value"] != "Please remove me" {
+		t.Errorf("draft body = %v, want the message body", values["value"])
+	}
+
+	submissions := fake.callsTo("EmailSubmission/set")
+	if len(submissions) != 1 {
+		t.Fatalf("EmailSubmission/set called %d times, want 1", len(submissions))
+	}
+	send := submissions[0]["create"].(map[string]interface{})["send"].(map[string]interface{})
+	if send["identityId"] != "id-main" || send["emailId"] != "#draft" {
+		t.Errorf("submission = %v, want id-main sending #draft", send)
+	}
+	wantPatch := map[string]interface{}{
+		"mailboxIds/drafts": nil,
+		"mailboxIds/sent":   true,
+		"keywords/$draft":   nil,
+	}
+	patch := submissions[0]["onSuccessUpdateEmail"].(map[string]interface{})["#send"]
+	if !reflect.DeepEqual(patch, wantPatch) {
+		t.Errorf("onSuccessUpdateEmail = %v, want %v", patch, wantPatch)
+	}
+}
+
+func TestClient_SendEmail_NoSentMailbox(t *testing.T) {
+	fake := newSubmissionServer(t, []interface{}{
+		fakeMailbox("inbox", "Inbox", "inbox"),
+		fakeMailbox("drafts", "Drafts", "drafts"),
+	}, false)
+	client := newFakeClient(t, fake)
+
+	if err := client.SendEmail(context.Background(), OutgoingEmail{To: "a@example.com"}); err != nil {
+		t.Fatalf("SendEmail() unexpected error = %v", err)
+	}
+
+	submission := fake.callsTo("EmailSubmission/set")[0]
+	if _, ok := submission["onSuccessUpdateEmail"]; ok {
+		t.Error("onSuccessUpdateEmail should not be set without a sent mailbox")
+	}
+	if got := getStringSlice(submission, "onSuccessDestroyEmail"); !reflect.DeepEqual(got, []string{"#send"}) {
+		t.Errorf("onSuccessDestroyEmail = %v, want [#send]", got)
+	}
+}
+
+func TestClient_SendEmail_Errors(t *testing.T) {
+	tests := []struct {
+		name         string
+		mailboxes    []interface{}
+		notSubmitted bool
+		wantErr      string
+	}{
+		{
+			name:      "no drafts mailbox",
+			mailboxes: []interface{}{fakeMailbox("inbox", "Inbox", "inbox")},
+			wantErr:   "drafts mailbox not found",
+		},
+		{
+			name:         "submission refused",
+			mailboxes:    []interface{}{fakeMailbox("drafts", "Drafts", "drafts")},
+			notSubmitted: true,
+			wantErr:      "forbiddenToSend: quota exceeded",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newSubmissionServer(t, tt.mailboxes, tt.notSubmitted)
+			client := newFakeClient(t, fake)
+
+			err := client.SendEmail(context.Background(), OutgoingEmail{To: "a@example.com"})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("SendEmail() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClient_SendEmail_TimeoutNotResent(t *testing.T) {
+	fake := newSubmissionServer(t, []interface{}{
+		fakeMailbox("drafts", "Drafts", "drafts"),
+		fakeMailbox("sent", "Sent", "sent"),
+	}, false)
+	submit := fake.methods["EmailSubmission/set"]
+	fake.methods["EmailSubmission/set"] = func(args map[string]interface{}) (string, map[string]interface{}) {
+		// The email is sent, but the response comes too late
+		time.Sleep(200 * time.Millisecond)
+		return submit(args)
+	}
+	client := newFakeClient(t, fake)
+	client.httpClient.Timeout = 50 * time.Millisecond
+	client.sleep = func(context.Context, time.Duration) error { return nil }
+
+	if err := client.SendEmail(context.Background(), OutgoingEmail{To: "a@example.com"}); err == nil {
+		t.Fatal("SendEmail() succeeded, want the timeout reported")
+	}
+
+	// Wait for every request the server received to be handled
+	fake.Close()
+	if got := len(fake.callsTo("EmailSubmission/set")); got != 1 {
+		t.Errorf("EmailSubmission/set called %d times, want 1", got)
+	}
+}
+
+func TestCapabilitiesFor(t *testing.T) {
+	mail := []string{"urn:ietf:params:jmap:core", "urn:ietf:params:jmap:mail"}
+
+	if got := capabilitiesFor([]MethodCall{{"Email/get", nil, "0"}}); !reflect.DeepEqual(got, mail) {
+		t.Errorf("capabilitiesFor(Email/get) = %v, want %v", got, mail)
+	}
+
+	got := capabilitiesFor([]MethodCall{{"Email/set", nil, "0"}, {"EmailSubmission/set", nil, "1"}})
+	if want := append(mail, submissionCapability); !reflect.DeepEqual(got, want) {
+		t.Errorf("capabilitiesFor(EmailSubmission/set) = %v, want %v", got, want)
+	}
+}
+
+func TestMockClient_SendEmail(t *testing.T) {
+	mock := NewMockClient()
+
+	msg := OutgoingEmail{To: "unsubscribe@example.com", Subject: "unsubscribe"}
+	if err := mock.SendEmail(context.Background(), msg); err != nil {
+		t.Fatalf("SendEmail() unexpected error = %v", err)
+	}
+	if sent := mock.SentEmails(); len(sent) != 1 || sent[0] != msg {
+		t.Errorf("SentEmails() = %v, want [%v]", sent, msg)
+	}
+}
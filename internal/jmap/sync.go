@@ -0,0 +1,607 @@
+package jmap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultSyncInterval is how long a synced view is served from memory before
+// the next read asks the server for changes.
+const DefaultSyncInterval = 15 * time.Second
+
+// syncTimeout bounds a sync of the shared view, which runs detached from the
+// request that triggered it
+const syncTimeout = time.Minute
+
+// SyncClient wraps a Client and keeps a local copy of the mailboxes and the
+// inbox listing. After the first full fetch it only asks the server for what
+// changed, using Mailbox/changes, Email/changes and Email/queryChanges, and
+// falls back to a full resync when the server cannot calculate the changes.
+type SyncClient struct {
+	client   *Client
+	interval time.Duration
+	push     broadcaster
+
+	mu           sync.Mutex
+	synced       bool
+	lastSync     time.Time
+	accountID    string
+	mailboxes    []Mailbox
+	mailboxState string
+	inboxID      string
+	emailState   string
+	queryState   string
+	inboxIDs     []string
+	totalCount   int
+	emails       map[string]Email
+}
+
+// NewSyncClient creates a SyncClient on top of an authenticated Client
+func NewSyncClient(client *Client) *SyncClient {
+	return &SyncClient{
+		client:   client,
+		interval: DefaultSyncInterval,
+		emails:   make(map[string]Email),
+	}
+}
+
+// SetSyncInterval changes how long the synced view is considered fresh.
+// Zero makes every read check the server for changes.
+func (s *SyncClient) SetSyncInterval(interval time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.interval = interval
+}
+
+// Authenticate re-authenticates the underlying client and drops the synced view
+func (s *SyncClient) Authenticate(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.client.Authenticate(ctx); err != nil {
+		return err
+	}
+	s.reset()
+	return nil
+}
+
+// GetPrimaryAccount returns the primary mail account of the underlying client
+func (s *SyncClient) GetPrimaryAccount() string {
+	return s.client.GetPrimaryAccount()
+}
+
+// GetMailboxes returns the synced mailboxes
+func (s *SyncClient) GetMailboxes(ctx context.Context) ([]Mailbox, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ctx, cancel := detach(ctx)
+	defer cancel()
+	if err := s.syncIfStale(ctx); err != nil {
+		return nil, err
+	}
+
+	mailboxes := make([]Mailbox, len(s.mailboxes))
+	copy(mailboxes, s.mailboxes)
+	return mailboxes, nil
+}
+
+// GetInboxEmails returns the newest inbox emails from the synced view
+func (s *SyncClient) GetInboxEmails(ctx context.Context, limit int) ([]Email, error) {
+	return s.GetInboxEmailsPaginated(ctx, limit, 0)
+}
+
+// GetInboxEmailsPaginated returns a page of inbox emails from the synced view
+func (s *SyncClient) GetInboxEmailsPaginated(ctx context.Context, limit, offset int) ([]Email, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.page(ctx, limit, offset)
+}
+
+// GetInboxEmailsWithCount returns the newest inbox emails with the total count
+func (s *SyncClient) GetInboxEmailsWithCount(ctx context.Context, limit int) (*InboxInfo, error) {
+	return s.GetInboxEmailsWithCountPaginated(ctx, limit, 0)
+}
+
+// GetInboxEmailsWithCountPaginated returns a page of inbox emails with the total count
+func (s *SyncClient) GetInboxEmailsWithCountPaginated(ctx context.Context, limit, offset int) (*InboxInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	emails, err := s.page(ctx, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	return &InboxInfo{
+		Emails:     emails,
+		TotalCount: s.totalCount,
+	}, nil
+}
+
+// GetEmails fetches emails with all their details through the underlying
+// client. The synced view only holds what the listing needs.
+func (s *SyncClient) GetEmails(ctx context.Context, ids []string) ([]Email, error) {
+	return s.client.GetEmails(ctx, ids)
+}
+
+// GetListedEmails returns the emails of the synced view with the given IDs
+// and fetches the others, such as emails that have left the inbox since
+func (s *SyncClient) GetListedEmails(ctx context.Context, ids []string) ([]Email, error) {
+	s.mu.Lock()
+	emails := make([]Email, 0, len(ids))
+	var missing []string
+	for _, id := range ids {
+		if email, ok := s.emails[id]; ok {
+			emails = append(emails, email)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	s.mu.Unlock()
+
+	if len(missing) == 0 {
+		return emails, nil
+	}
+	fetched, err := s.client.GetListedEmails(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	return append(emails, fetched...), nil
+}
+
+// ArchiveEmails archives through the underlying client and marks the synced
+// view stale so the next read picks up the change.
+func (s *SyncClient) ArchiveEmails(ctx context.Context, emailIDs []string, dryRun bool) (*MoveResult, error) {
+	result, err := s.client.ArchiveEmails(ctx, emailIDs, dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	if !dryRun {
+		s.Invalidate()
+	}
+	return result, nil
+}
+
+// MoveEmails moves emails through the underlying client and marks the synced
+// view stale.
+func (s *SyncClient) MoveEmails(ctx context.Context, emailIDs []string, targetMailboxID string, dryRun bool) (*MoveResult, error) {
+	result, err := s.client.MoveEmails(ctx, emailIDs, targetMailboxID, dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	if !dryRun {
+		s.Invalidate()
+	}
+	return result, nil
+}
+
+// UndoArchive undoes an archive through the underlying client and marks the
+// synced view stale.
+func (s *SyncClient) UndoArchive(ctx context.Context, entryID string, dryRun bool) (*UndoResult, error) {
+	result, err := s.client.UndoArchive(ctx, entryID, dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	if !dryRun {
+		s.Invalidate()
+	}
+	return result, nil
+}
+
+// ArchiveHistory returns the archive journal of the underlying client
+func (s *SyncClient) ArchiveHistory(limit int) []JournalEntry {
+	return s.client.ArchiveHistory(limit)
+}
+
+// SendEmail sends through the underlying client. The synced view is left
+// alone: sent emails do not land in the inbox.
+func (s *SyncClient) SendEmail(ctx context.Context, msg OutgoingEmail) error {
+	return s.client.SendEmail(ctx, msg)
+}
+
+// SessionHealth reports the session of the underlying client
+func (s *SyncClient) SessionHealth() SessionHealth {
+	return s.client.SessionHealth()
+}
+
+// Invalidate marks the synced view stale without dropping it, so the next
+// read performs a delta sync.
+func (s *SyncClient) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastSync = time.Time{}
+}
+
+// Sync brings the synced view up to date with the server right away
+func (s *SyncClient) Sync(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ctx, cancel := detach(ctx)
+	defer cancel()
+	return s.sync(ctx)
+}
+
+// Subscribe returns a channel that receives a StateChange after every push
+// notification has been applied to the synced view.
+func (s *SyncClient) Subscribe() (<-chan StateChange, func()) {
+	return s.push.subscribe()
+}
+
+// WatchPush listens on the server's event source for Email and Mailbox state
+// changes, delta-syncs on each one and notifies subscribers. It reconnects
+// after errors and returns once stop is closed.
+func (s *SyncClient) WatchPush(stop <-chan struct{}) {
+	for {
+		err := s.client.WatchEvents([]string{"Email", "Mailbox"}, stop, func(change StateChange) {
+			if err := s.Sync(context.Background()); err != nil {
+				log.Printf("Failed to sync after state change: %v", err)
+				return
+			}
+			s.push.publish(change)
+		})
+
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		if err != nil {
+			log.Printf("Event source disconnected: %v", err)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(pushReconnectDelay):
+		}
+	}
+}
+
+func (s *SyncClient) page(ctx context.Context, limit, offset int) ([]Email, error) {
+	ctx, cancel := detach(ctx)
+	defer cancel()
+
+	if err := s.syncIfStale(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := s.ensureWindow(ctx, offset+limit); err != nil {
+		return nil, err
+	}
+
+	if offset >= len(s.inboxIDs) {
+		return []Email{}, nil
+	}
+
+	end := offset + limit
+	if end > len(s.inboxIDs) {
+		end = len(s.inboxIDs)
+	}
+
+	emails := make([]Email, 0, end-offset)
+	for _, id := range s.inboxIDs[offset:end] {
+		emails = append(emails, s.emails[id])
+	}
+	return emails, nil
+}
+
+// detach keeps the values of a request context but not its cancellation. The
+// synced view is shared, so a client going away must not abort a sync other
+// requests are waiting on, or leave it half applied.
+func detach(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), syncTimeout)
+}
+
+func (s *SyncClient) syncIfStale(ctx context.Context) error {
+	if s.synced && time.Since(s.lastSync) < s.interval {
+		return nil
+	}
+	return s.sync(ctx)
+}
+
+func (s *SyncClient) sync(ctx context.Context) error {
+	// A refreshed session may point at another account; its states mean
+	// nothing for the synced view
+	if !s.synced || s.accountID != s.client.GetPrimaryAccount() {
+		return s.fullSync(ctx)
+	}
+
+	err := s.syncChanges(ctx)
+	var methodErr *MethodError
+	if errors.As(err, &methodErr) && methodErr.Type == "cannotCalculateChanges" {
+		return s.fullSync(ctx)
+	}
+	return err
+}
+
+func (s *SyncClient) reset() {
+	s.synced = false
+	s.lastSync = time.Time{}
+	s.accountID = ""
+	s.mailboxes = nil
+	s.mailboxState = ""
+	s.inboxID = ""
+	s.emailState = ""
+	s.queryState = ""
+	s.inboxIDs = nil
+	s.totalCount = 0
+	s.emails = make(map[string]Email)
+}
+
+// fullSync discards the synced view and fetches mailboxes and the first page
+// of the inbox from scratch.
+func (s *SyncClient) fullSync(ctx context.Context) error {
+	window := len(s.inboxIDs)
+	s.reset()
+
+	if err := s.loadMailboxes(ctx); err != nil {
+		return err
+	}
+
+	if window == 0 {
+		window = 100
+	}
+	if err := s.ensureWindow(ctx, window); err != nil {
+		return err
+	}
+
+	s.synced = true
+	s.lastSync = time.Now()
+	s.accountID = s.client.GetPrimaryAccount()
+	return nil
+}
+
+func (s *SyncClient) loadMailboxes(ctx context.Context) error {
+	mailboxes, state, err := s.client.getMailboxes(ctx)
+	if err != nil {
+		return err
+	}
+
+	var inboxID string
+	for _, mb := range mailboxes {
+		if mb.Role == "inbox" {
+			inboxID = mb.ID
+			break
+		}
+	}
+	if inboxID == "" {
+		return fmt.Errorf("inbox not found")
+	}
+
+	if s.inboxID != "" && s.inboxID != inboxID {
+		// The inbox itself was replaced, the listing is no longer valid
+		s.synced = false
+	}
+
+	s.mailboxes = mailboxes
+	s.mailboxState = state
+	s.inboxID = inboxID
+	return nil
+}
+
+// windowAttempts is how many times ensureWindow syncs a listing that keeps
+// changing while its tail is queried before giving up
+const windowAttempts = 3
+
+// errListingChanged reports that the inbox listing changed since it was
+// synced, so a tail queried from it would not line up with the synced view
+var errListingChanged = errors.New("inbox listing changed while it was read")
+
+// ensureWindow makes sure at least n inbox emails (or all of them) are synced,
+// querying for the missing tail of the listing. When the listing changed
+// since it was synced, the changes are synced first and the tail queried
+// again.
+func (s *SyncClient) ensureWindow(ctx context.Context, n int) error {
+	for attempt := 1; ; attempt++ {
+		err := s.extendWindow(ctx, n)
+		if !errors.Is(err, errListingChanged) || attempt == windowAttempts {
+			return err
+		}
+		if err := s.sync(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// extendWindow queries the tail ensureWindow is missing and appends it to
+// the synced view, unless the listing changed
+func (s *SyncClient) extendWindow(ctx context.Context, n int) error {
+	if len(s.inboxIDs) >= n {
+		return nil
+	}
+	if s.queryState != "" && len(s.inboxIDs) >= s.totalCount {
+		return nil
+	}
+
+	accountID := s.client.GetPrimaryAccount()
+	if accountID == "" {
+		return fmt.Errorf("no primary account found")
+	}
+
+	query := inboxQuery(accountID, s.inboxID)
+	query.Position = len(s.inboxIDs)
+	query.Limit = n - len(s.inboxIDs)
+	query.CalculateTotal = true
+
+	queryResult, emails, emailState, err := s.client.queryEmails(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	queryState := queryResult.QueryState
+	if s.queryState != "" && queryState != s.queryState {
+		return errListingChanged
+	}
+
+	s.queryState = queryState
+	s.totalCount = queryResult.Total
+	if s.emailState == "" {
+		s.emailState = emailState
+	}
+
+	for _, email := range emails {
+		s.emails[email.ID] = email
+	}
+	for _, id := range queryResult.IDs {
+		if _, ok := s.emails[id]; ok {
+			s.inboxIDs = append(s.inboxIDs, id)
+		}
+	}
+
+	return nil
+}
+
+// syncChanges applies Mailbox/changes, Email/queryChanges and Email/changes
+// to the synced view in a single round trip, then fetches the emails that
+// were added to the inbox or modified.
+func (s *SyncClient) syncChanges(ctx context.Context) error {
+	accountID := s.client.GetPrimaryAccount()
+	if accountID == "" {
+		return fmt.Errorf("no primary account found")
+	}
+
+	query := inboxQuery(accountID, s.inboxID)
+	queryChangesRequest := EmailQueryChangesRequest{
+		AccountID:       accountID,
+		Filter:          query.Filter,
+		Sort:            query.Sort,
+		SinceQueryState: s.queryState,
+		CalculateTotal:  true,
+	}
+
+	resp, err := s.client.makeRequest(ctx, []MethodCall{
+		{"Mailbox/changes", ChangesRequest{AccountID: accountID, SinceState: s.mailboxState}, "0"},
+		{"Email/queryChanges", queryChangesRequest, "1"},
+		{"Email/changes", ChangesRequest{AccountID: accountID, SinceState: s.emailState}, "2"},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get changes: %w", err)
+	}
+
+	var mailboxChanges, emailChanges ChangesResponse
+	var queryChanges EmailQueryChangesResponse
+	if err := resp.methodResult("0", "Mailbox/changes", &mailboxChanges); err != nil {
+		return fmt.Errorf("failed to get mailbox changes: %w", err)
+	}
+	if err := resp.methodResult("1", "Email/queryChanges", &queryChanges); err != nil {
+		return fmt.Errorf("failed to get inbox changes: %w", err)
+	}
+	if err := resp.methodResult("2", "Email/changes", &emailChanges); err != nil {
+		return fmt.Errorf("failed to get email changes: %w", err)
+	}
+
+	if mailboxChanges.hasChanges() {
+		if err := s.loadMailboxes(ctx); err != nil {
+			return err
+		}
+		if !s.synced {
+			return s.fullSync(ctx)
+		}
+	} else {
+		s.mailboxState = mailboxChanges.NewState
+	}
+
+	toFetch := make(map[string]bool)
+
+	// Apply removals first, then additions in index order (RFC 8620 section 5.6)
+	removed := make(map[string]bool)
+	for _, id := range queryChanges.Removed {
+		removed[id] = true
+	}
+	// The new listing is built aside and only applied once the emails it
+	// needs have been fetched, so a failed fetch leaves the view as it was
+	ids := make([]string, 0, len(s.inboxIDs)+len(queryChanges.Added))
+	for _, id := range s.inboxIDs {
+		if !removed[id] {
+			ids = append(ids, id)
+		}
+	}
+
+	for _, item := range queryChanges.sortedAdded() {
+		if item.Index > len(ids) {
+			continue
+		}
+		ids = append(ids, "")
+		copy(ids[item.Index+1:], ids[item.Index:])
+		ids[item.Index] = item.ID
+		toFetch[item.ID] = true
+	}
+
+	inInbox := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		inInbox[id] = true
+	}
+
+	for _, id := range emailChanges.Updated {
+		if inInbox[id] {
+			toFetch[id] = true
+		}
+	}
+
+	if emailChanges.HasMoreChanges {
+		// Too many changes to page through; cheaper to start over
+		return s.fullSync(ctx)
+	}
+
+	if err := s.fetchEmails(ctx, accountID, toFetch); err != nil {
+		return err
+	}
+	s.emailState = emailChanges.NewState
+	s.queryState = queryChanges.NewQueryState
+	s.totalCount = queryChanges.Total
+
+	for _, id := range emailChanges.Destroyed {
+		delete(s.emails, id)
+	}
+	// Drop cached emails that are no longer part of the inbox listing
+	for id := range s.emails {
+		if !inInbox[id] {
+			delete(s.emails, id)
+		}
+	}
+
+	// Keep only IDs whose email we actually have
+	s.inboxIDs = ids[:0]
+	for _, id := range ids {
+		if _, ok := s.emails[id]; ok {
+			s.inboxIDs = append(s.inboxIDs, id)
+		}
+	}
+
+	s.lastSync = time.Now()
+	return nil
+}
+
+func (s *SyncClient) fetchEmails(ctx context.Context, accountID string, ids map[string]bool) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	idList := make([]string, 0, len(ids))
+	for id := range ids {
+		idList = append(idList, id)
+	}
+	sort.Strings(idList)
+
+	emails, _, err := s.client.getEmails(ctx, emailGetRequest(accountID), idList)
+	if err != nil {
+		return err
+	}
+
+	for _, email := range emails {
+		s.emails[email.ID] = email
+	}
+	return nil
+}
@@ -0,0 +1,381 @@
+package jmap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// fakeInbox backs the sync tests with a small mutable inbox
+type fakeInbox struct {
+	ids      []string
+	subjects map[string]string
+	// queryState is the state Email/query reports, q-1 when unset
+	queryState string
+
+	queryChanges map[string]interface{}
+	emailChanges map[string]interface{}
+	// getError makes Email/get fail with this error type when set
+	getError string
+}
+
+func (fi *fakeInbox) methods() map[string]fakeMethod {
+	return map[string]fakeMethod{
+		"Mailbox/get": func(args map[string]interface{}) (string, map[string]interface{}) {
+			return "Mailbox/get", map[string]interface{}{
+				"state": "mb-1",
+				"list": []interface{}{
+					fakeMailbox("inbox", "Inbox", "inbox"),
+					fakeMailbox("archive", "Archive", "archive"),
+				},
+			}
+		},
+		"Mailbox/changes": func(args map[string]interface{}) (string, map[string]interface{}) {
+			return "Mailbox/changes", map[string]interface{}{
+				"oldState": args["sinceState"], "newState": "mb-1",
+				"created": []interface{}{}, "updated": []interface{}{}, "destroyed": []interface{}{},
+			}
+		},
+		"Email/query": func(args map[string]interface{}) (string, map[string]interface{}) {
+			start := getInt(args, "position")
+			end := start + getInt(args, "limit")
+			if end > len(fi.ids) {
+				end = len(fi.ids)
+			}
+			var ids []interface{}
+			for _, id := range fi.ids[start:end] {
+				ids = append(ids, id)
+			}
+			queryState := fi.queryState
+			if queryState == "" {
+				queryState = "q-1"
+			}
+			return "Email/query", map[string]interface{}{
+				"queryState": queryState, "ids": ids, "position": start, "total": len(fi.ids),
+			}
+		},
+		"Email/get": func(args map[string]interface{}) (string, map[string]interface{}) {
+			if fi.getError != "" {
+				return "error", map[string]interface{}{"type": fi.getError}
+			}
+			var list []interface{}
+			for _, id := range idsArg(args) {
+				list = append(list, map[string]interface{}{"id": id, "subject": fi.subjects[id]})
+			}
+			return "Email/get", map[string]interface{}{"state": "s-1", "list": list}
+		},
+		"Email/queryChanges": func(args map[string]interface{}) (string, map[string]interface{}) {
+			if fi.queryChanges == nil {
+				return "Email/queryChanges", map[string]interface{}{
+					"oldQueryState": args["sinceQueryState"], "newQueryState": args["sinceQueryState"],
+					"removed": []interface{}{}, "added": []interface{}{}, "total": len(fi.ids),
+				}
+			}
+			if getString(fi.queryChanges, "type") != "" {
+				return "error", fi.queryChanges
+			}
+			return "Email/queryChanges", fi.queryChanges
+		},
+		"Email/changes": func(args map[string]interface{}) (string, map[string]interface{}) {
+			if fi.emailChanges == nil {
+				return "Email/changes", map[string]interface{}{
+					"oldState": args["sinceState"], "newState": args["sinceState"],
+					"created": []interface{}{}, "updated": []interface{}{}, "destroyed": []interface{}{},
+				}
+			}
+			return "Email/changes", fi.emailChanges
+		},
+	}
+}
+
+func emailIDs(emails []Email) []string {
+	ids := make([]string, len(emails))
+	for i, email := range emails {
+		ids[i] = email.ID
+	}
+	return ids
+}
+
+func TestSyncClient_InitialSyncAndCache(t *testing.T) {
+	inbox := &fakeInbox{
+		ids:      []string{"e3", "e2", "e1"},
+		subjects: map[string]string{"e1": "One", "e2": "Two", "e3": "Three"},
+	}
+	fake := newFakeJMAPServer(t, inbox.methods())
+	syncClient := NewSyncClient(newFakeClient(t, fake))
+
+	info, err := syncClient.GetInboxEmailsWithCount(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("GetInboxEmailsWithCount() unexpected error = %v", err)
+	}
+	if got := emailIDs(info.Emails); !reflect.DeepEqual(got, []string{"e3", "e2", "e1"}) {
+		t.Errorf("GetInboxEmailsWithCount() ids = %v", got)
+	}
+	if info.TotalCount != 3 {
+		t.Errorf("GetInboxEmailsWithCount() TotalCount = %d, want 3", info.TotalCount)
+	}
+
+	requests := fake.requests
+	if _, err := syncClient.GetInboxEmailsPaginated(context.Background(), 1, 1); err != nil {
+		t.Fatalf("GetInboxEmailsPaginated() unexpected error = %v", err)
+	}
+	if fake.requests != requests {
+		t.Errorf("fresh synced view made %d extra requests, want 0", fake.requests-requests)
+	}
+}
+
+func TestSyncClient_GetListedEmails(t *testing.T) {
+	inbox := &fakeInbox{
+		ids:      []string{"e2", "e1"},
+		subjects: map[string]string{"e1": "One", "e2": "Two", "old": "Archived"},
+	}
+	fake := newFakeJMAPServer(t, inbox.methods())
+	syncClient := NewSyncClient(newFakeClient(t, fake))
+	if _, err := syncClient.GetInboxEmails(context.Background(), 10); err != nil {
+		t.Fatalf("GetInboxEmails() unexpected error = %v", err)
+	}
+	gets := len(fake.callsTo("Email/get"))
+
+	emails, err := syncClient.GetListedEmails(context.Background(), []string{"e1", "old"})
+	if err != nil {
+		t.Fatalf("GetListedEmails() unexpected error = %v", err)
+	}
+	if got := emailIDs(emails); !reflect.DeepEqual(got, []string{"e1", "old"}) {
+		t.Errorf("GetListedEmails() ids = %v, want e1 and old", got)
+	}
+
+	// Only the email that is not in the synced view is fetched
+	calls := fake.callsTo("Email/get")[gets:]
+	if len(calls) != 1 || !reflect.DeepEqual(idsArg(calls[0]), []string{"old"}) {
+		t.Errorf("GetListedEmails() fetched %v, want only old", calls)
+	}
+}
+
+func TestSyncClient_DeltaSync(t *testing.T) {
+	inbox := &fakeInbox{
+		ids:      []string{"e3", "e2", "e1"},
+		subjects: map[string]string{"e1": "One", "e2": "Two", "e3": "Three", "e4": "Four"},
+	}
+	fake := newFakeJMAPServer(t, inbox.methods())
+	syncClient := NewSyncClient(newFakeClient(t, fake))
+	syncClient.SetSyncInterval(0)
+
+	if _, err := syncClient.GetInboxEmails(context.Background(), 10); err != nil {
+		t.Fatalf("GetInboxEmails() unexpected error = %v", err)
+	}
+
+	// e2 was archived elsewhere, e4 arrived and e1 was modified
+	inbox.ids = []string{"e4", "e3", "e1"}
+	inbox.subjects["e1"] = "One (edited)"
+	inbox.queryChanges = map[string]interface{}{
+		"oldQueryState": "q-1", "newQueryState": "q-2", "total": 3,
+		"removed": []interface{}{"e2"},
+		"added":   []interface{}{map[string]interface{}{"id": "e4", "index": 0}},
+	}
+	inbox.emailChanges = map[string]interface{}{
+		"oldState": "s-1", "newState": "s-2", "hasMoreChanges": false,
+		"created": []interface{}{"e4"}, "updated": []interface{}{"e1", "e2"}, "destroyed": []interface{}{},
+	}
+
+	queries := len(fake.callsTo("Email/query"))
+	emails, err := syncClient.GetInboxEmails(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("GetInboxEmails() after changes unexpected error = %v", err)
+	}
+
+	if got := emailIDs(emails); !reflect.DeepEqual(got, []string{"e4", "e3", "e1"}) {
+		t.Errorf("GetInboxEmails() after changes ids = %v, want [e4 e3 e1]", got)
+	}
+	if emails[2].Subject != "One (edited)" {
+		t.Errorf("updated email subject = %q, want %q", emails[2].Subject, "One (edited)")
+	}
+	if got := len(fake.callsTo("Email/query")); got != queries {
+		t.Errorf("delta sync issued %d Email/query calls, want none", got-queries)
+	}
+
+	gets := fake.callsTo("Email/get")
+	fetched := idsArg(gets[len(gets)-1])
+	sort.Strings(fetched)
+	if !reflect.DeepEqual(fetched, []string{"e1", "e4"}) {
+		t.Errorf("delta sync fetched %v, want only [e1 e4]", fetched)
+	}
+}
+
+func TestSyncClient_ListingChangedBetweenPages(t *testing.T) {
+	inbox := &fakeInbox{subjects: map[string]string{"new": "New"}}
+	for i := 150; i > 0; i-- {
+		id := fmt.Sprintf("e%d", i)
+		inbox.ids = append(inbox.ids, id)
+		inbox.subjects[id] = id
+	}
+	fake := newFakeJMAPServer(t, inbox.methods())
+	syncClient := NewSyncClient(newFakeClient(t, fake))
+
+	// The first sync lists the newest 100 emails
+	if _, err := syncClient.GetInboxEmailsPaginated(context.Background(), 50, 0); err != nil {
+		t.Fatalf("GetInboxEmailsPaginated() unexpected error = %v", err)
+	}
+
+	// An email arrives before the next page is read
+	inbox.ids = append([]string{"new"}, inbox.ids...)
+	inbox.queryState = "q-2"
+	inbox.queryChanges = map[string]interface{}{
+		"oldQueryState": "q-1", "newQueryState": "q-2", "total": len(inbox.ids),
+		"removed": []interface{}{},
+		"added":   []interface{}{map[string]interface{}{"id": "new", "index": 0}},
+	}
+
+	emails, err := syncClient.GetInboxEmailsPaginated(context.Background(), 50, 100)
+	if err != nil {
+		t.Fatalf("GetInboxEmailsPaginated() after the listing changed unexpected error = %v", err)
+	}
+	if got, want := emailIDs(emails), inbox.ids[100:150]; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetInboxEmailsPaginated() after the listing changed ids = %v, want %v", got, want)
+	}
+	if syncClient.queryState != "q-2" {
+		t.Errorf("query state = %q, want q-2", syncClient.queryState)
+	}
+}
+
+func TestSyncClient_FailedFetchKeepsView(t *testing.T) {
+	inbox := &fakeInbox{
+		ids:      []string{"e3", "e2", "e1"},
+		subjects: map[string]string{"e1": "One", "e2": "Two", "e3": "Three", "e4": "Four"},
+	}
+	fake := newFakeJMAPServer(t, inbox.methods())
+	syncClient := NewSyncClient(newFakeClient(t, fake))
+	syncClient.SetSyncInterval(0)
+
+	if _, err := syncClient.GetInboxEmails(context.Background(), 10); err != nil {
+		t.Fatalf("GetInboxEmails() unexpected error = %v", err)
+	}
+
+	// e4 arrived but cannot be fetched
+	inbox.ids = []string{"e4", "e3", "e2", "e1"}
+	inbox.queryChanges = map[string]interface{}{
+		"oldQueryState": "q-1", "newQueryState": "q-2", "total": 4,
+		"removed": []interface{}{},
+		"added":   []interface{}{map[string]interface{}{"id": "e4", "index": 0}},
+	}
+	inbox.emailChanges = map[string]interface{}{
+		"oldState": "s-1", "newState": "s-2", "hasMoreChanges": false,
+		"created": []interface{}{"e4"}, "updated": []interface{}{}, "destroyed": []interface{}{},
+	}
+	inbox.getError = "invalidArguments"
+
+	if _, err := syncClient.GetInboxEmails(context.Background(), 10); err == nil {
+		t.Fatal("GetInboxEmails() with a failing Email/get succeeded")
+	}
+	if !reflect.DeepEqual(syncClient.inboxIDs, []string{"e3", "e2", "e1"}) || syncClient.queryState != "q-1" || syncClient.totalCount != 3 {
+		t.Errorf("failed sync changed the view to %v (query state %q, total %d)", syncClient.inboxIDs, syncClient.queryState, syncClient.totalCount)
+	}
+
+	// The next sync applies the same changes again
+	inbox.getError = ""
+	emails, err := syncClient.GetInboxEmails(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("GetInboxEmails() after recovery unexpected error = %v", err)
+	}
+	if got := emailIDs(emails); !reflect.DeepEqual(got, []string{"e4", "e3", "e2", "e1"}) {
+		t.Errorf("GetInboxEmails() after recovery ids = %v, want [e4 e3 e2 e1]", got)
+	}
+	if emails[0].Subject != "Four" {
+		t.Errorf("new email subject = %q, want %q", emails[0].Subject, "Four")
+	}
+}
+
+func TestSyncClient_SyncOutlivesRequest(t *testing.T) {
+	inbox := &fakeInbox{
+		ids:      []string{"e1"},
+		subjects: map[string]string{"e1": "One"},
+	}
+	fake := newFakeJMAPServer(t, inbox.methods())
+	syncClient := NewSyncClient(newFakeClient(t, fake))
+
+	// A client that went away does not abort the sync of the shared view
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	emails, err := syncClient.GetInboxEmails(ctx, 10)
+	if err != nil {
+		t.Fatalf("GetInboxEmails() with a cancelled request unexpected error = %v", err)
+	}
+	if got := emailIDs(emails); !reflect.DeepEqual(got, []string{"e1"}) {
+		t.Errorf("GetInboxEmails() ids = %v, want [e1]", got)
+	}
+}
+
+func TestSyncClient_CannotCalculateChanges(t *testing.T) {
+	inbox := &fakeInbox{
+		ids:      []string{"e2", "e1"},
+		subjects: map[string]string{"e1": "One", "e2": "Two", "e5": "Five"},
+	}
+	fake := newFakeJMAPServer(t, inbox.methods())
+	syncClient := NewSyncClient(newFakeClient(t, fake))
+	syncClient.SetSyncInterval(0)
+
+	if _, err := syncClient.GetInboxEmails(context.Background(), 10); err != nil {
+		t.Fatalf("GetInboxEmails() unexpected error = %v", err)
+	}
+
+	inbox.ids = []string{"e5"}
+	inbox.queryChanges = map[string]interface{}{"type": "cannotCalculateChanges"}
+
+	emails, err := syncClient.GetInboxEmails(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("GetInboxEmails() after resync unexpected error = %v", err)
+	}
+	if got := emailIDs(emails); !reflect.DeepEqual(got, []string{"e5"}) {
+		t.Errorf("GetInboxEmails() after resync ids = %v, want [e5]", got)
+	}
+	if got := len(fake.callsTo("Email/query")); got != 2 {
+		t.Errorf("Email/query called %d times, want 2 (initial + resync)", got)
+	}
+}
+
+func TestResponse_MethodResult(t *testing.T) {
+	var resp Response
+	err := json.Unmarshal([]byte(`{"methodResponses": [
+		["Email/get", {"state": "s-1", "list": [{"id": "e1", "threadId": "t1", "size": 42}]}, "0"],
+		["error", {"type": "cannotCalculateChanges"}, "1"],
+		["Email/query", {"ids": []}, "3"],
+		["EmailSubmission/set", {"created": {"send": {"id": "sub-1"}}}, "4"],
+		["Email/set", {"updated": {"e1": null}}, "4"]
+	], "sessionState": "session-1"}`), &resp)
+	if err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	var result EmailGetResponse
+	if err := resp.methodResult("0", "Email/get", &result); err != nil || result.State != "s-1" {
+		t.Errorf("methodResult(0) = %+v, %v", result, err)
+	}
+	if len(result.List) != 1 || result.List[0].ThreadID != "t1" || result.List[0].Size != 42 {
+		t.Errorf("methodResult(0) list = %+v, want e1 with thread and size", result.List)
+	}
+
+	err = resp.methodResult("1", "Email/changes", &ChangesResponse{})
+	methodErr, ok := err.(*MethodError)
+	if !ok || methodErr.Type != "cannotCalculateChanges" {
+		t.Errorf("methodResult(1) error = %v, want *MethodError cannotCalculateChanges", err)
+	}
+
+	if err := resp.methodResult("2", "Email/get", &result); err == nil {
+		t.Error("methodResult(2) expected error for missing call")
+	}
+
+	if err := resp.methodResult("3", "Email/get", &result); err == nil {
+		t.Error("methodResult(3) expected error for a response to another method")
+	}
+
+	// The implicit Email/set shares the call ID of the submission
+	var setResult EmailSetResponse
+	if err := resp.methodResult("4", "Email/set", &setResult); err != nil {
+		t.Errorf("methodResult(4) unexpected error = %v", err)
+	}
+	if _, ok := setResult.Updated["e1"]; !ok {
+		t.Errorf("methodResult(4) updated = %v, want e1", setResult.Updated)
+	}
+}
@@ -1,26 +1,41 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
+	"io"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"mailboxzero/internal/config"
 	"mailboxzero/internal/jmap"
 	"mailboxzero/internal/similarity"
+	"mailboxzero/internal/unsubscribe"
 
 	"github.com/gorilla/mux"
 )
 
 type Server struct {
-	config     *config.Config
-	jmapClient jmap.JMAPClient
-	templates  *template.Template
+	config       *config.Config
+	jmapClient   jmap.JMAPClient
+	templates    *template.Template
+	unsubscriber *unsubscribe.Unsubscriber
+	feedback     *similarity.Feedback
+	// learning tracks the archive decisions still being learned from
+	learning sync.WaitGroup
 }
 
+// learnTimeout bounds learning from an archive, which goes on after the
+// request has been answered
+const learnTimeout = time.Minute
+
 type PageData struct {
 	DryRun            bool
 	DefaultSimilarity int
@@ -35,13 +50,32 @@ func New(cfg *config.Config, jmapClient jmap.JMAPClient) (*Server, error) {
 		return nil, fmt.Errorf("failed to parse templates: %w", err)
 	}
 
+	// Sending email is optional: without it mailto unsubscribes are reported
+	// as unsupported
+	mailer, _ := jmapClient.(jmap.Mailer)
+
+	// The mock's list headers point at real sites, which must not be
+	// contacted in mock mode
+	var httpClient *http.Client
+	if cfg.MockMode {
+		httpClient = &http.Client{Transport: mockUnsubscribeTransport{}}
+	}
+
 	return &Server{
-		config:     cfg,
-		jmapClient: jmapClient,
-		templates:  templates,
+		config:       cfg,
+		jmapClient:   jmapClient,
+		templates:    templates,
+		unsubscriber: unsubscribe.New(httpClient, mailer),
+		feedback:     similarity.NewMemoryFeedback(),
 	}, nil
 }
 
+// SetFeedback replaces where archive decisions and the weights learned from
+// them are kept
+func (s *Server) SetFeedback(feedback *similarity.Feedback) {
+	s.feedback = feedback
+}
+
 func (s *Server) Start() error {
 	r := mux.NewRouter()
 
@@ -49,9 +83,21 @@ func (s *Server) Start() error {
 
 	r.HandleFunc("/", s.handleIndex).Methods("GET")
 	r.HandleFunc("/api/emails", s.handleGetEmails).Methods("GET")
+	r.HandleFunc("/api/emails/{id}", s.handleGetEmail).Methods("GET")
 	r.HandleFunc("/api/similar", s.handleFindSimilar).Methods("POST")
+	r.HandleFunc("/api/groups", s.handleGetGroups).Methods("POST")
+	r.HandleFunc("/api/mailboxes", s.handleMailboxes).Methods("GET")
 	r.HandleFunc("/api/archive", s.handleArchive).Methods("POST")
+	r.HandleFunc("/api/move", s.handleMove).Methods("POST")
+	r.HandleFunc("/api/undo", s.handleUndo).Methods("POST")
+	r.HandleFunc("/api/history", s.handleHistory).Methods("GET")
 	r.HandleFunc("/api/clear", s.handleClear).Methods("POST")
+	r.HandleFunc("/api/events", s.handleEvents).Methods("GET")
+	r.HandleFunc("/api/session", s.handleSession).Methods("GET")
+	r.HandleFunc("/api/unsubscribe", s.handleUnsubscribe).Methods("POST")
+	r.HandleFunc("/api/unsubscribe", s.handleUnsubscribeHistory).Methods("GET")
+	r.HandleFunc("/api/weights", s.handleWeights).Methods("GET")
+	r.HandleFunc("/api/weights", s.handleResetWeights).Methods("DELETE")
 
 	addr := s.config.GetServerAddr()
 	log.Printf("Server starting on http://%s", addr)
@@ -88,12 +134,14 @@ func (s *Server) handleGetEmails(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	inboxInfo, err := s.jmapClient.GetInboxEmailsWithCountPaginated(limit, offset)
+	inboxInfo, err := s.jmapClient.GetInboxEmailsWithCountPaginated(r.Context(), limit, offset)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to get emails: %v", err), http.StatusInternalServerError)
 		return
 	}
 
+	inboxInfo.Emails = forBrowser(inboxInfo.Emails)
+
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(inboxInfo); err != nil {
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
@@ -101,9 +149,112 @@ func (s *Server) handleGetEmails(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleGetEmail returns one email with all its details, which the listing
+// leaves out
+func (s *Server) handleGetEmail(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	emails, err := s.jmapClient.GetEmails(r.Context(), []string{id})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get email: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if len(emails) == 0 {
+		http.Error(w, "Email not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(forBrowser(emails)[0]); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// forBrowser returns emails as they are sent to the browser: with their body
+// as BodyText only, so it is not sent twice. Similarity reads BodyText too.
+func forBrowser(emails []jmap.Email) []jmap.Email {
+	sent := make([]jmap.Email, len(emails))
+	for i, email := range emails {
+		email.BodyText = email.PlainText()
+		email.BodyValues = nil
+		sent[i] = email
+	}
+	return sent
+}
+
+// SimilarRequest asks for the emails similar to EmailID, or for the largest
+// group if it is empty. Mode picks the grouping lens and defaults to fuzzy;
+// Clustering picks how fuzzy groups are formed and defaults to greedy;
+// BodyScoring and Weights override the configured body scoring and
+// similarity weights.
 type SimilarRequest struct {
-	EmailID             string  `json:"emailId,omitempty"`
-	SimilarityThreshold float64 `json:"similarityThreshold"`
+	EmailID             string              `json:"emailId,omitempty"`
+	SimilarityThreshold float64             `json:"similarityThreshold"`
+	Mode                string              `json:"mode,omitempty"`
+	Clustering          string              `json:"clustering,omitempty"`
+	BodyScoring         string              `json:"bodyScoring,omitempty"`
+	Weights             *similarity.Weights `json:"weights,omitempty"`
+}
+
+// groupingOptions builds the similarity options for a request from its mode,
+// clustering, body scoring, threshold in percent and optional weights
+func (s *Server) groupingOptions(mode, clustering, bodyScoring string, threshold float64, weights *similarity.Weights) (similarity.Options, error) {
+	parsed, err := similarity.ParseMode(mode)
+	if err != nil {
+		return similarity.Options{}, err
+	}
+	cluster, err := similarity.ParseClustering(clustering)
+	if err != nil {
+		return similarity.Options{}, err
+	}
+	if bodyScoring == "" {
+		bodyScoring = string(s.config.Similarity.BodyScoring)
+	}
+	body, err := similarity.ParseBodyScoring(bodyScoring)
+	if err != nil {
+		return similarity.Options{}, err
+	}
+
+	w, _ := s.weights()
+	if weights != nil {
+		w = *weights
+	}
+	scorer, err := similarity.NewLevenshteinScorer(w)
+	if err != nil {
+		return similarity.Options{}, err
+	}
+
+	return similarity.Options{
+		Mode:       parsed,
+		Threshold:  threshold / 100.0,
+		Clustering: cluster,
+		Body:       body,
+		Scorer:     scorer,
+		Workers:    s.config.Similarity.Workers,
+	}, nil
+}
+
+// weights are the weights learned from the user's archive decisions, or the
+// configured ones until enough decisions have been made
+func (s *Server) weights() (w similarity.Weights, learned bool) {
+	if w, ok := s.feedback.Weights(s.jmapClient.GetPrimaryAccount()); ok {
+		return w, true
+	}
+	w = s.config.Similarity.Weights
+	if w == (similarity.Weights{}) {
+		w = similarity.DefaultWeights
+	}
+	return w, false
+}
+
+// maxEmails is how many of the newest inbox emails are grouped, and searched
+// for the emails a request names
+func (s *Server) maxEmails() int {
+	if s.config.Similarity.MaxEmails > 0 {
+		return s.config.Similarity.MaxEmails
+	}
+	return config.DefaultSimilarityMaxEmails
 }
 
 func (s *Server) handleFindSimilar(w http.ResponseWriter, r *http.Request) {
@@ -113,13 +264,22 @@ func (s *Server) handleFindSimilar(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	emails, err := s.jmapClient.GetInboxEmails(1000)
+	opts, err := s.groupingOptions(req.Mode, req.Clustering, req.BodyScoring, req.SimilarityThreshold, req.Weights)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	emails, err := s.jmapClient.GetInboxEmails(r.Context(), s.maxEmails())
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to get emails: %v", err), http.StatusInternalServerError)
 		return
 	}
+	emails = forBrowser(emails)
 
-	var similarEmails []jmap.Email
+	// Every match carries the breakdown of its score so the UI can show why
+	// it matched
+	var similarEmails []similarity.ScoredEmail
 	if req.EmailID != "" {
 		var targetEmail *jmap.Email
 		for _, email := range emails {
@@ -134,9 +294,9 @@ func (s *Server) handleFindSimilar(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		similarEmails = similarity.FindSimilarToEmail(*targetEmail, emails, req.SimilarityThreshold/100.0)
-	} else {
-		similarEmails = similarity.FindSimilarEmails(emails, req.SimilarityThreshold/100.0)
+		similarEmails = similarity.ExplainSimilarToEmail(*targetEmail, emails, opts)
+	} else if groups := similarity.FindEmailGroupsWith(emails, opts); len(groups) > 0 {
+		similarEmails = groups[0].ScoredEmails()
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -146,8 +306,71 @@ func (s *Server) handleFindSimilar(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+type GroupsRequest struct {
+	SimilarityThreshold float64             `json:"similarityThreshold"`
+	Mode                string              `json:"mode,omitempty"`
+	Clustering          string              `json:"clustering,omitempty"`
+	BodyScoring         string              `json:"bodyScoring,omitempty"`
+	Weights             *similarity.Weights `json:"weights,omitempty"`
+}
+
+type GroupsResponse struct {
+	Groups      []similarity.EmailGroup `json:"groups"`
+	TotalGroups int                     `json:"totalGroups"`
+	Mode        similarity.Mode         `json:"mode"`
+	Clustering  similarity.Clustering   `json:"clustering"`
+}
+
+func (s *Server) handleGetGroups(w http.ResponseWriter, r *http.Request) {
+	var req GroupsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	opts, err := s.groupingOptions(req.Mode, req.Clustering, req.BodyScoring, req.SimilarityThreshold, req.Weights)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	emails, err := s.jmapClient.GetInboxEmails(r.Context(), s.maxEmails())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get emails: %v", err), http.StatusInternalServerError)
+		return
+	}
+	emails = forBrowser(emails)
+
+	groups := similarity.FindEmailGroupsWith(emails, opts)
+	if groups == nil {
+		groups = []similarity.EmailGroup{}
+	}
+
+	response := GroupsResponse{
+		Groups:      groups,
+		TotalGroups: len(groups),
+		Mode:        opts.Mode,
+		Clustering:  opts.Clustering,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// ArchiveRequest archives EmailIDs. With Learn set, they are the members of
+// a similarity group the user kept selected and RejectedIDs the ones they
+// deselected, and both are recorded as decisions to learn weights from.
+// ArchiveRequest archives EmailIDs. With Learn the archived emails and the
+// RejectedIDs left out of their group are learned from, scoring bodies with
+// BodyScoring as the group was.
 type ArchiveRequest struct {
-	EmailIDs []string `json:"emailIds"`
+	EmailIDs    []string `json:"emailIds"`
+	RejectedIDs []string `json:"rejectedIds,omitempty"`
+	Learn       bool     `json:"learn,omitempty"`
+	BodyScoring string   `json:"bodyScoring,omitempty"`
 }
 
 func (s *Server) handleArchive(w http.ResponseWriter, r *http.Request) {
@@ -162,22 +385,435 @@ func (s *Server) handleArchive(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.jmapClient.ArchiveEmails(req.EmailIDs, s.config.DryRun); err != nil {
+	result, err := s.jmapClient.ArchiveEmails(r.Context(), req.EmailIDs, s.config.DryRun)
+	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to archive emails: %v", err), http.StatusInternalServerError)
 		return
 	}
 
+	message := fmt.Sprintf("Successfully archived %d emails", len(result.Moved))
+	if len(result.Failed) > 0 {
+		message = fmt.Sprintf("Archived %d of %d emails, %d failed",
+			len(result.Moved), len(req.EmailIDs), len(result.Failed))
+	}
+
+	// Dry runs change nothing, so they teach nothing either. Learning goes
+	// on after the response, which only says whether it started.
+	learning := req.Learn && !s.config.DryRun && len(result.Moved) > 0
+	if learning {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), learnTimeout)
+		s.learning.Add(1)
+		go func() {
+			defer s.learning.Done()
+			defer cancel()
+			if _, err := s.learn(ctx, result.Moved, req.RejectedIDs, req.BodyScoring); err != nil {
+				log.Printf("Failed to learn from archive decisions: %v", err)
+			}
+		}()
+	}
+
+	response := map[string]interface{}{
+		"success":   len(result.Failed) == 0,
+		"message":   message,
+		"dryRun":    s.config.DryRun,
+		"archived":  result.Moved,
+		"failed":    result.Failed,
+		"journalId": result.JournalID,
+		"learning":  learning,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// learn records the archived and rejected members of a group as decisions
+// and learns the user's weights again. The emails are read as the inbox
+// listing has them, and their bodies scored with bodyScoring, so the
+// features learned from are the ones the group was scored with.
+func (s *Server) learn(ctx context.Context, archivedIDs, rejectedIDs []string, bodyScoring string) (similarity.FeedbackSummary, error) {
+	opts, err := s.groupingOptions("", "", bodyScoring, 0, nil)
+	if err != nil {
+		return similarity.FeedbackSummary{}, err
+	}
+
+	ids := append(append([]string(nil), archivedIDs...), rejectedIDs...)
+	emails, err := s.jmapClient.GetListedEmails(ctx, ids)
+	if err != nil {
+		return similarity.FeedbackSummary{}, fmt.Errorf("failed to get emails: %w", err)
+	}
+	emails = forBrowser(emails)
+
+	// TF-IDF weighs words by how common they are in the inbox the group was
+	// found in, which the archived emails were part of
+	if opts.Body == similarity.BodyTFIDF {
+		inbox, err := s.jmapClient.GetInboxEmails(ctx, s.maxEmails())
+		if err != nil {
+			return similarity.FeedbackSummary{}, fmt.Errorf("failed to get emails: %w", err)
+		}
+		corpus := forBrowser(inbox)
+		listed := make(map[string]bool, len(corpus))
+		for _, email := range corpus {
+			listed[email.ID] = true
+		}
+		for _, email := range emails {
+			if !listed[email.ID] {
+				corpus = append(corpus, email)
+			}
+		}
+		opts.Scorer = opts.Scorer.(*similarity.LevenshteinScorer).WithTFIDF(similarity.NewTFIDF(corpus))
+	}
+
+	byID := make(map[string]jmap.Email, len(emails))
+	for _, email := range emails {
+		byID[email.ID] = email
+	}
+	pick := func(ids []string) []jmap.Email {
+		var picked []jmap.Email
+		for _, id := range ids {
+			if email, ok := byID[id]; ok {
+				picked = append(picked, email)
+			}
+		}
+		return picked
+	}
+
+	decisions := similarity.Decisions(pick(archivedIDs), pick(rejectedIDs), opts)
+	return s.feedback.Record(s.jmapClient.GetPrimaryAccount(), decisions)
+}
+
+type MoveRequest struct {
+	EmailIDs  []string `json:"emailIds"`
+	MailboxID string   `json:"mailboxId"`
+}
+
+func (s *Server) handleMove(w http.ResponseWriter, r *http.Request) {
+	var req MoveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.EmailIDs) == 0 {
+		http.Error(w, "No emails to move", http.StatusBadRequest)
+		return
+	}
+	if req.MailboxID == "" {
+		http.Error(w, "No target mailbox", http.StatusBadRequest)
+		return
+	}
+
+	result, err := s.jmapClient.MoveEmails(r.Context(), req.EmailIDs, req.MailboxID, s.config.DryRun)
+	switch {
+	case errors.Is(err, jmap.ErrMailboxNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, jmap.ErrMailboxNotWritable):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case errors.Is(err, jmap.ErrInvalidMoveTarget):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, fmt.Sprintf("Failed to move emails: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	message := fmt.Sprintf("Successfully moved %d emails", len(result.Moved))
+	if len(result.Failed) > 0 {
+		message = fmt.Sprintf("Moved %d of %d emails, %d failed",
+			len(result.Moved), len(req.EmailIDs), len(result.Failed))
+	}
+
+	response := map[string]interface{}{
+		"success":   len(result.Failed) == 0,
+		"message":   message,
+		"dryRun":    s.config.DryRun,
+		"mailboxId": req.MailboxID,
+		"moved":     result.Moved,
+		"failed":    result.Failed,
+		"journalId": result.JournalID,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleMailboxes returns the account's mailboxes as a tree, including the
+// user's rights so the UI can disable targets that cannot be written to.
+func (s *Server) handleMailboxes(w http.ResponseWriter, r *http.Request) {
+	mailboxes, err := s.jmapClient.GetMailboxes(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get mailboxes: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(jmap.BuildMailboxTree(mailboxes)); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+type UndoRequest struct {
+	EntryID string `json:"entryId,omitempty"`
+}
+
+func (s *Server) handleUndo(w http.ResponseWriter, r *http.Request) {
+	var req UndoRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	result, err := s.jmapClient.UndoArchive(r.Context(), req.EntryID, s.config.DryRun)
+	if errors.Is(err, jmap.ErrNothingToUndo) {
+		http.Error(w, "Nothing to undo", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to undo archive: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	message := fmt.Sprintf("Restored %d emails", len(result.Restored))
+	if len(result.Failed) > 0 {
+		message = fmt.Sprintf("Restored %d emails, %d failed", len(result.Restored), len(result.Failed))
+	}
+
 	response := map[string]interface{}{
-		"success": true,
-		"message": fmt.Sprintf("Successfully archived %d emails", len(req.EmailIDs)),
+		"success":  len(result.Failed) == 0,
+		"message":  message,
+		"dryRun":   s.config.DryRun,
+		"entryId":  result.EntryID,
+		"restored": result.Restored,
+		"failed":   result.Failed,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	limit := 10
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			limit = l
+		}
+	}
+
+	entries := s.jmapClient.ArchiveHistory(limit)
+	if entries == nil {
+		entries = []jmap.JournalEntry{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// handleSession reports the health of the JMAP session. It answers 503 when
+// the session is missing or could not be refreshed, so it doubles as a
+// health check.
+func (s *Server) handleSession(w http.ResponseWriter, r *http.Request) {
+	reporter, ok := s.jmapClient.(jmap.SessionReporter)
+	if !ok {
+		http.Error(w, "Session health not supported", http.StatusNotImplemented)
+		return
+	}
+
+	health := reporter.SessionHealth()
+
+	w.Header().Set("Content-Type", "application/json")
+	if !health.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(health)
+}
+
+// WeightsResponse reports the weights fuzzy matching uses unless a request
+// overrides them, and the archive decisions they were learned from
+type WeightsResponse struct {
+	Weights  similarity.Weights `json:"weights"`
+	Learned  bool               `json:"learned"`
+	Accepted int                `json:"accepted"`
+	Rejected int                `json:"rejected"`
+}
+
+func (s *Server) weightsResponse() WeightsResponse {
+	summary := s.feedback.Summary(s.jmapClient.GetPrimaryAccount())
+	weights, learned := s.weights()
+	return WeightsResponse{
+		Weights:  weights,
+		Learned:  learned,
+		Accepted: summary.Accepted,
+		Rejected: summary.Rejected,
+	}
+}
+
+func (s *Server) handleWeights(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.weightsResponse())
+}
+
+// handleResetWeights forgets the user's archive decisions, so the configured
+// weights apply again
+func (s *Server) handleResetWeights(w http.ResponseWriter, r *http.Request) {
+	if err := s.feedback.Reset(s.jmapClient.GetPrimaryAccount()); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to reset weights: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.weightsResponse())
+}
+
+type UnsubscribeRequest struct {
+	EmailIDs []string `json:"emailIds"`
+}
+
+// handleUnsubscribe unsubscribes from the senders of the given emails, once
+// per sender. The List-Unsubscribe headers are read from the server, never
+// taken from the request.
+func (s *Server) handleUnsubscribe(w http.ResponseWriter, r *http.Request) {
+	var req UnsubscribeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.EmailIDs) == 0 {
+		http.Error(w, "No emails to unsubscribe from", http.StatusBadRequest)
+		return
+	}
+
+	emails, err := s.jmapClient.GetInboxEmails(r.Context(), s.maxEmails())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get emails: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	wanted := make(map[string]bool, len(req.EmailIDs))
+	for _, id := range req.EmailIDs {
+		wanted[id] = true
+	}
+	var selected []jmap.Email
+	for _, email := range emails {
+		if wanted[email.ID] {
+			selected = append(selected, email)
+		}
+	}
+	if len(selected) == 0 {
+		http.Error(w, "Emails not found", http.StatusNotFound)
+		return
+	}
+
+	results := s.unsubscriber.Unsubscribe(r.Context(), selected, s.config.DryRun)
+
+	failed := 0
+	for _, result := range results {
+		if result.Status == unsubscribe.StatusFailed {
+			failed++
+		}
+	}
+
+	message := fmt.Sprintf("Processed %d senders", len(results))
+	if failed > 0 {
+		message = fmt.Sprintf("Processed %d senders, %d failed", len(results), failed)
+	}
+
+	response := map[string]interface{}{
+		"success": failed == 0,
+		"message": message,
 		"dryRun":  s.config.DryRun,
+		"results": results,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// handleUnsubscribeHistory returns the most recent unsubscribe results,
+// newest first
+func (s *Server) handleUnsubscribeHistory(w http.ResponseWriter, r *http.Request) {
+	limit := 20
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			limit = l
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.unsubscriber.History(limit))
+}
+
+// mockUnsubscribeTransport accepts every one-click unsubscribe without
+// sending it anywhere
+type mockUnsubscribeTransport struct{}
+
+func (mockUnsubscribeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	log.Printf("[MOCK MODE] One-click unsubscribe: %s %s", req.Method, req.URL)
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Status:     "200 OK",
+		Body:       io.NopCloser(strings.NewReader("")),
+		Request:    req,
+	}, nil
+}
+
 func (s *Server) handleClear(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
 }
+
+// eventsKeepAlive is how often handleEvents writes a comment line so proxies
+// do not close an idle stream.
+var eventsKeepAlive = 30 * time.Second
+
+// handleEvents streams inbox state changes to the browser as Server-Sent
+// Events, so the UI can refresh when mail arrives or is moved elsewhere.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	notifier, ok := s.jmapClient.(jmap.StateNotifier)
+	if !ok {
+		http.Error(w, "Push updates not supported", http.StatusNotImplemented)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	changes, cancel := notifier.Subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case change, ok := <-changes:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(change)
+			if err != nil {
+				log.Printf("Failed to encode state change: %v", err)
+				continue
+			}
+			fmt.Fprintf(w, "event: state\ndata: %s\n\n", data)
+			flusher.Flush()
+		}
+	}
+}
@@ -1,15 +1,21 @@
 package server
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"mailboxzero/internal/config"
 	"mailboxzero/internal/jmap"
+	"mailboxzero/internal/similarity"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/gorilla/mux"
 )
 
 // setupTestServer creates a test server with mock JMAP client
@@ -194,12 +200,71 @@ func TestHandleGetEmails(t *testing.T) {
 	}
 }
 
+func TestHandleGetEmails_BodyOnce(t *testing.T) {
+	server := setupTestServer(t)
+
+	w := httptest.NewRecorder()
+	server.handleGetEmails(w, httptest.NewRequest("GET", "/api/emails", nil))
+	if strings.Contains(w.Body.String(), `"bodyValues"`) {
+		t.Error("handleGetEmails() sent body values along with the body text")
+	}
+
+	var response jmap.InboxInfo
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("handleGetEmails() failed to decode response: %v", err)
+	}
+	for _, email := range response.Emails {
+		if email.BodyText == "" {
+			t.Errorf("email %s has no body text", email.ID)
+		}
+	}
+}
+
+func TestHandleGetEmail(t *testing.T) {
+	server := setupTestServer(t)
+	inbox, _ := server.jmapClient.GetInboxEmails(context.Background(), 1)
+
+	tests := []struct {
+		name           string
+		id             string
+		wantStatusCode int
+	}{
+		{name: "existing email", id: inbox[0].ID, wantStatusCode: http.StatusOK},
+		{name: "unknown email", id: "missing", wantStatusCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/emails/"+tt.id, nil)
+			req = mux.SetURLVars(req, map[string]string{"id": tt.id})
+			w := httptest.NewRecorder()
+
+			server.handleGetEmail(w, req)
+
+			if w.Code != tt.wantStatusCode {
+				t.Fatalf("handleGetEmail() status = %v, want %v", w.Code, tt.wantStatusCode)
+			}
+			if tt.wantStatusCode != http.StatusOK {
+				return
+			}
+
+			var email jmap.Email
+			if err := json.NewDecoder(w.Body).Decode(&email); err != nil {
+				t.Fatalf("handleGetEmail() failed to decode response: %v", err)
+			}
+			if email.ID != tt.id {
+				t.Errorf("handleGetEmail() id = %q, want %q", email.ID, tt.id)
+			}
+		})
+	}
+}
+
 func TestHandleFindSimilar(t *testing.T) {
 	server := setupTestServer(t)
 
 	// Get some emails first to use their IDs
 	mockClient := server.jmapClient.(*jmap.MockClient)
-	emails, _ := mockClient.GetInboxEmails(10)
+	emails, _ := mockClient.GetInboxEmails(context.Background(), 10)
 
 	tests := []struct {
 		name           string
@@ -243,6 +308,22 @@ func TestHandleFindSimilar(t *testing.T) {
 			},
 			wantStatusCode: http.StatusOK,
 		},
+		{
+			name: "find similar by sender",
+			requestBody: SimilarRequest{
+				EmailID: emails[0].ID,
+				Mode:    "sender",
+			},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name: "unknown mode",
+			requestBody: SimilarRequest{
+				SimilarityThreshold: 75.0,
+				Mode:                "subject",
+			},
+			wantStatusCode: http.StatusBadRequest,
+		},
 		{
 			name:           "invalid request body",
 			requestBody:    "invalid json",
@@ -284,12 +365,134 @@ func TestHandleFindSimilar(t *testing.T) {
 	}
 }
 
+func TestHandleGetGroups(t *testing.T) {
+	server := setupTestServer(t)
+
+	tests := []struct {
+		name           string
+		body           string
+		wantStatusCode int
+		wantGroups     bool
+	}{
+		{
+			name:           "default threshold",
+			body:           `{"similarityThreshold": 75}`,
+			wantStatusCode: http.StatusOK,
+			wantGroups:     true,
+		},
+		{
+			name:           "threshold nothing matches",
+			body:           `{"similarityThreshold": 100.1}`,
+			wantStatusCode: http.StatusOK,
+			wantGroups:     false,
+		},
+		{
+			name:           "invalid request body",
+			body:           "invalid json",
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "unknown mode",
+			body:           `{"similarityThreshold": 75, "mode": "subject"}`,
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "connected clustering",
+			body:           `{"similarityThreshold": 75, "clustering": "connected"}`,
+			wantStatusCode: http.StatusOK,
+			wantGroups:     true,
+		},
+		{
+			name:           "average clustering",
+			body:           `{"similarityThreshold": 75, "clustering": "average"}`,
+			wantStatusCode: http.StatusOK,
+			wantGroups:     true,
+		},
+		{
+			name:           "unknown clustering",
+			body:           `{"similarityThreshold": 75, "clustering": "single"}`,
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "tfidf body scoring",
+			body:           `{"similarityThreshold": 75, "bodyScoring": "tfidf"}`,
+			wantStatusCode: http.StatusOK,
+			wantGroups:     true,
+		},
+		{
+			name:           "unknown body scoring",
+			body:           `{"similarityThreshold": 75, "bodyScoring": "bm25"}`,
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "sender only weights",
+			body:           `{"similarityThreshold": 99, "weights": {"sender": 1}}`,
+			wantStatusCode: http.StatusOK,
+			wantGroups:     true,
+		},
+		{
+			name:           "negative weight",
+			body:           `{"similarityThreshold": 75, "weights": {"subject": 1, "body": -1}}`,
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "all weights zero",
+			body:           `{"similarityThreshold": 75, "weights": {}}`,
+			wantStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/groups", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			server.handleGetGroups(w, req)
+
+			if w.Code != tt.wantStatusCode {
+				t.Fatalf("handleGetGroups() status = %v, want %v", w.Code, tt.wantStatusCode)
+			}
+			if tt.wantStatusCode != http.StatusOK {
+				return
+			}
+
+			var response GroupsResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("handleGetGroups() failed to decode response: %v", err)
+			}
+
+			if response.Groups == nil {
+				t.Fatal("handleGetGroups() response.Groups is nil")
+			}
+			if response.TotalGroups != len(response.Groups) {
+				t.Errorf("handleGetGroups() totalGroups = %d, want %d", response.TotalGroups, len(response.Groups))
+			}
+			if tt.wantGroups && len(response.Groups) < 2 {
+				t.Errorf("handleGetGroups() returned %d groups, want several", len(response.Groups))
+			}
+			if !tt.wantGroups && len(response.Groups) != 0 {
+				t.Errorf("handleGetGroups() returned %d groups, want 0", len(response.Groups))
+			}
+
+			for i, group := range response.Groups {
+				if group.ID == "" || group.Size != len(group.Emails) {
+					t.Errorf("handleGetGroups() group %d invalid: id=%q size=%d emails=%d",
+						i, group.ID, group.Size, len(group.Emails))
+				}
+				if i > 0 && group.Size > response.Groups[i-1].Size {
+					t.Errorf("handleGetGroups() groups not ranked by size at index %d", i)
+				}
+			}
+		})
+	}
+}
+
 func TestHandleArchive(t *testing.T) {
 	server := setupTestServer(t)
 
 	// Get some emails first to use their IDs
 	mockClient := server.jmapClient.(*jmap.MockClient)
-	emails, _ := mockClient.GetInboxEmails(10)
+	emails, _ := mockClient.GetInboxEmails(context.Background(), 10)
 
 	tests := []struct {
 		name           string
@@ -368,6 +571,249 @@ func TestHandleArchive(t *testing.T) {
 	}
 }
 
+func TestHandleArchive_PartialFailure(t *testing.T) {
+	server := setupTestServer(t)
+	server.config.DryRun = false
+
+	mockClient := server.jmapClient.(*jmap.MockClient)
+	emails, _ := mockClient.GetInboxEmails(context.Background(), 1)
+
+	body, _ := json.Marshal(ArchiveRequest{EmailIDs: []string{emails[0].ID, "missing-id"}})
+	req := httptest.NewRequest("POST", "/api/archive", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+
+	server.handleArchive(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("handleArchive() status = %v, want %v", w.Code, http.StatusOK)
+	}
+
+	var response struct {
+		Success  bool               `json:"success"`
+		Message  string             `json:"message"`
+		Archived []string           `json:"archived"`
+		Failed   []jmap.MoveFailure `json:"failed"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("handleArchive() failed to decode response: %v", err)
+	}
+
+	if response.Success {
+		t.Error("handleArchive() success = true, want false for partial failure")
+	}
+	if len(response.Archived) != 1 || response.Archived[0] != emails[0].ID {
+		t.Errorf("handleArchive() archived = %v, want [%s]", response.Archived, emails[0].ID)
+	}
+	if len(response.Failed) != 1 || response.Failed[0].ID != "missing-id" || response.Failed[0].Type != "notFound" {
+		t.Errorf("handleArchive() failed = %+v, want missing-id notFound", response.Failed)
+	}
+	if !strings.Contains(response.Message, "1 failed") {
+		t.Errorf("handleArchive() message = %q, want partial failure message", response.Message)
+	}
+}
+
+func TestHandleMove(t *testing.T) {
+	server := setupTestServer(t)
+	server.config.DryRun = false
+
+	mockClient := server.jmapClient.(*jmap.MockClient)
+	emails, _ := mockClient.GetInboxEmails(context.Background(), 10)
+
+	tests := []struct {
+		name           string
+		requestBody    interface{}
+		wantStatusCode int
+	}{
+		{
+			name:           "move to folder",
+			requestBody:    MoveRequest{EmailIDs: []string{emails[0].ID}, MailboxID: "folder-newsletters"},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "move to read-only mailbox",
+			requestBody:    MoveRequest{EmailIDs: []string{emails[1].ID}, MailboxID: "shared-announcements"},
+			wantStatusCode: http.StatusForbidden,
+		},
+		{
+			name:           "move to unknown mailbox",
+			requestBody:    MoveRequest{EmailIDs: []string{emails[1].ID}, MailboxID: "missing"},
+			wantStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "move to inbox",
+			requestBody:    MoveRequest{EmailIDs: []string{emails[1].ID}, MailboxID: "inbox-123"},
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "no target mailbox",
+			requestBody:    MoveRequest{EmailIDs: []string{emails[1].ID}},
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "move empty list",
+			requestBody:    MoveRequest{EmailIDs: []string{}, MailboxID: "folder-receipts"},
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid request body",
+			requestBody:    "invalid json",
+			wantStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body []byte
+			if str, ok := tt.requestBody.(string); ok {
+				body = []byte(str)
+			} else {
+				body, _ = json.Marshal(tt.requestBody)
+			}
+
+			req := httptest.NewRequest("POST", "/api/move", bytes.NewReader(body))
+			w := httptest.NewRecorder()
+
+			server.handleMove(w, req)
+
+			if w.Code != tt.wantStatusCode {
+				t.Errorf("handleMove() status = %v, want %v", w.Code, tt.wantStatusCode)
+			}
+		})
+	}
+
+	inbox, _ := mockClient.GetInboxEmails(context.Background(), 1000)
+	for _, email := range inbox {
+		if email.ID == emails[0].ID {
+			t.Errorf("handleMove() left %s in the inbox", email.ID)
+		}
+		if email.ID == emails[1].ID {
+			return
+		}
+	}
+	t.Errorf("refused moves removed %s from the inbox", emails[1].ID)
+}
+
+func TestHandleMailboxes(t *testing.T) {
+	server := setupTestServer(t)
+
+	req := httptest.NewRequest("GET", "/api/mailboxes", nil)
+	w := httptest.NewRecorder()
+
+	server.handleMailboxes(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("handleMailboxes() status = %v, want %v", w.Code, http.StatusOK)
+	}
+
+	var tree []jmap.MailboxNode
+	if err := json.NewDecoder(w.Body).Decode(&tree); err != nil {
+		t.Fatalf("handleMailboxes() failed to decode response: %v", err)
+	}
+
+	if len(tree) == 0 || tree[0].Role != "inbox" {
+		t.Fatalf("handleMailboxes() first mailbox = %+v, want the inbox", tree)
+	}
+
+	var nested, readOnly bool
+	for _, node := range tree {
+		if node.ID == "folder-newsletters" && len(node.Children) == 1 && node.Children[0].ParentID == node.ID {
+			nested = true
+		}
+		if node.ID == "shared-announcements" && !node.MyRights.MayAddItems {
+			readOnly = true
+		}
+	}
+	if !nested {
+		t.Error("handleMailboxes() did not nest Tech under Newsletters")
+	}
+	if !readOnly {
+		t.Error("handleMailboxes() did not expose the read-only rights of the shared mailbox")
+	}
+}
+
+func TestHandleSession(t *testing.T) {
+	server := setupTestServer(t)
+
+	w := httptest.NewRecorder()
+	server.handleSession(w, httptest.NewRequest("GET", "/api/session", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("handleSession() status = %v, want %v", w.Code, http.StatusOK)
+	}
+
+	var health jmap.SessionHealth
+	if err := json.NewDecoder(w.Body).Decode(&health); err != nil {
+		t.Fatalf("handleSession() failed to decode response: %v", err)
+	}
+	if !health.Healthy || health.Username == "" {
+		t.Errorf("handleSession() health = %+v, want a healthy mock session", health)
+	}
+
+	// A client that never authenticated reports itself unavailable
+	server.jmapClient = jmap.NewClient("http://127.0.0.1:0/session", "test-token")
+	w = httptest.NewRecorder()
+	server.handleSession(w, httptest.NewRequest("GET", "/api/session", nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("handleSession() unauthenticated status = %v, want %v", w.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestHandleUndo(t *testing.T) {
+	server := setupTestServer(t)
+	server.config.DryRun = false
+
+	undo := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/undo", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		server.handleUndo(w, req)
+		return w
+	}
+
+	if w := undo(`{}`); w.Code != http.StatusNotFound {
+		t.Errorf("handleUndo() with empty journal status = %v, want %v", w.Code, http.StatusNotFound)
+	}
+	if w := undo("invalid json"); w.Code != http.StatusBadRequest {
+		t.Errorf("handleUndo() invalid body status = %v, want %v", w.Code, http.StatusBadRequest)
+	}
+
+	mockClient := server.jmapClient.(*jmap.MockClient)
+	emails, _ := mockClient.GetInboxEmails(context.Background(), 2)
+	archived, _ := mockClient.ArchiveEmails(context.Background(), []string{emails[0].ID, emails[1].ID}, false)
+
+	historyReq := httptest.NewRequest("GET", "/api/history?limit=5", nil)
+	historyW := httptest.NewRecorder()
+	server.handleHistory(historyW, historyReq)
+
+	var history []jmap.JournalEntry
+	if err := json.NewDecoder(historyW.Body).Decode(&history); err != nil {
+		t.Fatalf("handleHistory() failed to decode response: %v", err)
+	}
+	if len(history) != 1 || history[0].ID != archived.JournalID {
+		t.Fatalf("handleHistory() = %+v, want the archive entry", history)
+	}
+
+	w := undo(`{"entryId": "` + archived.JournalID + `"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("handleUndo() status = %v, want %v", w.Code, http.StatusOK)
+	}
+
+	var response map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("handleUndo() failed to decode response: %v", err)
+	}
+	if response["success"] != true || response["entryId"] != archived.JournalID {
+		t.Errorf("handleUndo() response = %v", response)
+	}
+	if restored, _ := response["restored"].([]interface{}); len(restored) != 2 {
+		t.Errorf("handleUndo() restored = %v, want 2 emails", response["restored"])
+	}
+
+	if w := undo(`{"entryId": "` + archived.JournalID + `"}`); w.Code != http.StatusInternalServerError {
+		t.Errorf("handleUndo() twice status = %v, want %v", w.Code, http.StatusInternalServerError)
+	}
+}
+
 func TestHandleClear(t *testing.T) {
 	server := setupTestServer(t)
 
@@ -501,6 +947,39 @@ func TestHandleGetEmails_ParseErrors(t *testing.T) {
 	}
 }
 
+func TestHandlers_CancelledRequest(t *testing.T) {
+	server := setupTestServer(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	body, _ := json.Marshal(ArchiveRequest{EmailIDs: []string{"mock-email-1"}})
+	tests := []struct {
+		name    string
+		req     *http.Request
+		handler http.HandlerFunc
+	}{
+		{"emails", httptest.NewRequest("GET", "/api/emails", nil), server.handleGetEmails},
+		{"similar", httptest.NewRequest("POST", "/api/similar", bytes.NewReader([]byte(`{"similarityThreshold":75}`))), server.handleFindSimilar},
+		{"archive", httptest.NewRequest("POST", "/api/archive", bytes.NewReader(body)), server.handleArchive},
+		{"mailboxes", httptest.NewRequest("GET", "/api/mailboxes", nil), server.handleMailboxes},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.handler(w, tt.req.WithContext(ctx))
+
+			if w.Code != http.StatusInternalServerError {
+				t.Errorf("status = %v, want %v", w.Code, http.StatusInternalServerError)
+			}
+			if !strings.Contains(w.Body.String(), context.Canceled.Error()) {
+				t.Errorf("body = %q, want it to mention the cancellation", w.Body.String())
+			}
+		})
+	}
+}
+
 func TestHandleIndex_WithPageData(t *testing.T) {
 	server := setupTestServer(t)
 
@@ -703,3 +1182,354 @@ func TestServer_ConfigValues(t *testing.T) {
 		t.Errorf("Test server DefaultSimilarity = %v, want 75", server.config.DefaultSimilarity)
 	}
 }
+
+func TestHandleEvents(t *testing.T) {
+	server := setupTestServer(t)
+	mockClient := server.jmapClient.(*jmap.MockClient)
+
+	ts := httptest.NewServer(http.HandlerFunc(server.handleEvents))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("GET /api/events failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("handleEvents() Content-Type = %q, want text/event-stream", ct)
+	}
+
+	reader := bufio.NewReader(resp.Body)
+
+	// The stream opens with a comment once the subscription is in place
+	if line, _ := reader.ReadString('\n'); !strings.HasPrefix(line, ":") {
+		t.Fatalf("handleEvents() first line = %q, want comment", line)
+	}
+	reader.ReadString('\n')
+
+	mockClient.EmitStateChange("Email")
+
+	event, _ := reader.ReadString('\n')
+	data, _ := reader.ReadString('\n')
+	if event != "event: state\n" {
+		t.Errorf("handleEvents() event line = %q, want %q", event, "event: state\n")
+	}
+
+	var change jmap.StateChange
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(data, "data: ")), &change); err != nil {
+		t.Fatalf("handleEvents() failed to decode data %q: %v", data, err)
+	}
+	if change.Changed[mockClient.GetPrimaryAccount()]["Email"] == "" {
+		t.Errorf("handleEvents() change = %+v, want Email state", change)
+	}
+}
+
+type noPushClient struct {
+	jmap.JMAPClient
+}
+
+func TestHandleEvents_NotSupported(t *testing.T) {
+	server := setupTestServer(t)
+	server.jmapClient = noPushClient{server.jmapClient}
+
+	req := httptest.NewRequest("GET", "/api/events", nil)
+	w := httptest.NewRecorder()
+
+	server.handleEvents(w, req)
+
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("handleEvents() status = %v, want %v", w.Code, http.StatusNotImplemented)
+	}
+}
+
+func TestHandleUnsubscribe(t *testing.T) {
+	server := setupTestServer(t)
+	mock := server.jmapClient.(*jmap.MockClient)
+
+	emails, _ := mock.GetInboxEmails(context.Background(), 1000)
+	idsFrom := func(sender string) []string {
+		var ids []string
+		for _, email := range emails {
+			if len(email.From) > 0 && email.From[0].Email == sender {
+				ids = append(ids, email.ID)
+			}
+		}
+		if len(ids) == 0 {
+			t.Fatalf("no mock emails from %s", sender)
+		}
+		return ids
+	}
+	ids := append(idsFrom("notifications@github.com"), idsFrom("updates@docker.com")...)
+
+	unsubscribe := func(ids []string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		body, _ := json.Marshal(UnsubscribeRequest{EmailIDs: ids})
+		w := httptest.NewRecorder()
+		server.handleUnsubscribe(w, httptest.NewRequest("POST", "/api/unsubscribe", bytes.NewReader(body)))
+
+		var response map[string]interface{}
+		json.NewDecoder(w.Body).Decode(&response)
+		return w, response
+	}
+	statuses := func(response map[string]interface{}) map[string]string {
+		got := make(map[string]string)
+		for _, item := range response["results"].([]interface{}) {
+			result := item.(map[string]interface{})
+			got[result["sender"].(string)] = result["method"].(string) + " " + result["status"].(string)
+		}
+		return got
+	}
+
+	w, response := unsubscribe(ids)
+	if w.Code != http.StatusOK || response["dryRun"] != true {
+		t.Fatalf("handleUnsubscribe() status = %v, response = %v", w.Code, response)
+	}
+	want := map[string]string{
+		"notifications.github.com": "oneClick dryRun",
+		"updates.docker.com":       "mailto dryRun",
+	}
+	if got := statuses(response); !reflect.DeepEqual(got, want) {
+		t.Errorf("handleUnsubscribe() dry run results = %v, want %v", got, want)
+	}
+	if sent := mock.SentEmails(); len(sent) != 0 {
+		t.Errorf("dry run sent %d emails, want none", len(sent))
+	}
+
+	server.config.DryRun = false
+	_, response = unsubscribe(ids)
+	want = map[string]string{
+		"notifications.github.com": "oneClick unsubscribed",
+		"updates.docker.com":       "mailto sent",
+	}
+	if got := statuses(response); !reflect.DeepEqual(got, want) || response["success"] != true {
+		t.Errorf("handleUnsubscribe() results = %v, want %v", got, want)
+	}
+	if sent := mock.SentEmails(); len(sent) != 1 || sent[0].To != "unsubscribe@docker.com" {
+		t.Errorf("sent = %+v, want one email to unsubscribe@docker.com", sent)
+	}
+
+	w = httptest.NewRecorder()
+	server.handleUnsubscribeHistory(w, httptest.NewRequest("GET", "/api/unsubscribe?limit=2", nil))
+	var history []map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&history); err != nil {
+		t.Fatalf("handleUnsubscribeHistory() failed to decode response: %v", err)
+	}
+	if len(history) != 2 || history[0]["status"] != "sent" {
+		t.Errorf("handleUnsubscribeHistory() = %v, want the two latest results", history)
+	}
+}
+
+func TestHandleUnsubscribe_BadRequests(t *testing.T) {
+	server := setupTestServer(t)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"invalid body", `{`, http.StatusBadRequest},
+		{"no emails", `{"emailIds": []}`, http.StatusBadRequest},
+		{"unknown emails", `{"emailIds": ["missing"]}`, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			server.handleUnsubscribe(w, httptest.NewRequest("POST", "/api/unsubscribe", strings.NewReader(tt.body)))
+			if w.Code != tt.wantStatus {
+				t.Errorf("handleUnsubscribe() status = %v, want %v", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestHandleGetGroups_ListMode(t *testing.T) {
+	server := setupTestServer(t)
+
+	req := httptest.NewRequest("POST", "/api/groups", strings.NewReader(`{"mode": "list"}`))
+	w := httptest.NewRecorder()
+	server.handleGetGroups(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("handleGetGroups() status = %v, want %v", w.Code, http.StatusOK)
+	}
+
+	var response GroupsResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("handleGetGroups() failed to decode response: %v", err)
+	}
+	if response.Mode != "list" || len(response.Groups) == 0 {
+		t.Fatalf("handleGetGroups() mode = %q with %d groups, want list groups", response.Mode, len(response.Groups))
+	}
+	for _, group := range response.Groups {
+		if len(group.Scores) != len(group.Emails)-1 {
+			t.Errorf("group %s has %d breakdowns for %d emails", group.Key, len(group.Scores), len(group.Emails))
+		}
+		if group.Template == "" {
+			t.Errorf("group %s has no subject template", group.Key)
+		}
+		for _, email := range group.Emails {
+			if email.ListIdentifier() != group.Key {
+				t.Errorf("group %s has email %s from list %q", group.Key, email.ID, email.ListIdentifier())
+			}
+		}
+	}
+}
+
+func TestHandleFindSimilar_Breakdown(t *testing.T) {
+	server := setupTestServer(t)
+
+	req := httptest.NewRequest("POST", "/api/similar", strings.NewReader(`{"similarityThreshold": 50}`))
+	w := httptest.NewRecorder()
+	server.handleFindSimilar(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("handleFindSimilar() status = %v, want %v", w.Code, http.StatusOK)
+	}
+
+	var response []struct {
+		ID        string                `json:"id"`
+		Breakdown *similarity.Breakdown `json:"breakdown"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("handleFindSimilar() failed to decode response: %v", err)
+	}
+	if len(response) < 2 {
+		t.Fatalf("handleFindSimilar() returned %d emails, want a group", len(response))
+	}
+
+	if response[0].Breakdown != nil {
+		t.Errorf("email %s, the one the group is built around, has a breakdown", response[0].ID)
+	}
+	for _, email := range response[1:] {
+		if email.Breakdown == nil || len(email.Breakdown.Features) == 0 {
+			t.Errorf("email %s breakdown = %+v, want one score per feature", email.ID, email.Breakdown)
+		} else if email.Breakdown.Score < 0.5 {
+			t.Errorf("email %s scored %v, below the threshold", email.ID, email.Breakdown.Score)
+		}
+	}
+}
+
+func TestHandleArchive_Learn(t *testing.T) {
+	server := setupTestServer(t)
+
+	// The user archives the shipping notifications of a group and leaves
+	// out the emails of other kinds
+	archive := ArchiveRequest{
+		EmailIDs:    []string{"email-2-0", "email-2-1", "email-2-2"},
+		RejectedIDs: []string{"email-0-0", "email-1-0", "email-3-0", "email-4-0", "email-5-0", "email-6-0", "email-7-0"},
+		Learn:       true,
+	}
+	post := func() map[string]json.RawMessage {
+		body, _ := json.Marshal(archive)
+		w := httptest.NewRecorder()
+		server.handleArchive(w, httptest.NewRequest("POST", "/api/archive", bytes.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("handleArchive() status = %v, want %v", w.Code, http.StatusOK)
+		}
+		var response map[string]json.RawMessage
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("handleArchive() failed to decode response: %v", err)
+		}
+		return response
+	}
+	weights := func(method string) WeightsResponse {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/api/weights", nil)
+		if method == "DELETE" {
+			server.handleResetWeights(w, req)
+		} else {
+			server.handleWeights(w, req)
+		}
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s /api/weights status = %v, want %v", method, w.Code, http.StatusOK)
+		}
+		var response WeightsResponse
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("%s /api/weights failed to decode response: %v", method, err)
+		}
+		return response
+	}
+
+	// Dry runs teach nothing
+	if response := post(); string(response["learning"]) != "false" {
+		t.Errorf("dry run handleArchive() learning = %s, want false", response["learning"])
+	}
+	server.learning.Wait()
+	if got := weights("GET"); got.Learned || got.Accepted+got.Rejected != 0 {
+		t.Errorf("GET /api/weights after a dry run = %+v, want nothing learned", got)
+	}
+
+	server.config.DryRun = false
+	client := &inboxCountingClient{JMAPClient: server.jmapClient}
+	server.jmapClient = client
+	if response := post(); string(response["learning"]) != "true" {
+		t.Errorf("handleArchive() learning = %s, want true", response["learning"])
+	}
+	server.learning.Wait()
+	if client.inboxReads != 0 || client.detailReads != 0 {
+		t.Errorf("learning read the inbox %d times and %d email details, want only the listed group",
+			client.inboxReads, client.detailReads)
+	}
+	if client.listedReads != 1 {
+		t.Errorf("learning read the listed group %d times, want 1", client.listedReads)
+	}
+
+	learned := weights("GET")
+	if !learned.Learned || learned.Accepted != 3 || learned.Rejected != 7 {
+		t.Fatalf("GET /api/weights after learning = %+v, want 3 accepted, 7 rejected and learned weights", learned)
+	}
+
+	// The next scan uses the learned weights unless the request names some
+	opts, err := server.groupingOptions("", "", "", 75, nil)
+	if err != nil {
+		t.Fatalf("groupingOptions() error = %v", err)
+	}
+	if used := opts.Scorer.(*similarity.LevenshteinScorer).Weights(); used != learned.Weights {
+		t.Errorf("groupingOptions() weights = %+v, want the learned %+v", used, learned.Weights)
+	}
+
+	if got := weights("DELETE"); got.Learned || got.Weights != similarity.DefaultWeights || got.Accepted != 0 {
+		t.Errorf("DELETE /api/weights = %+v, want the default weights", got)
+	}
+
+	// Groups scored with TF-IDF are learned from with the words of the
+	// inbox they were found in
+	archive = ArchiveRequest{
+		EmailIDs:    []string{"email-3-0", "email-3-1", "email-3-2"},
+		RejectedIDs: []string{"email-0-0", "email-1-0", "email-4-0", "email-5-0", "email-6-0", "email-7-0", "email-8-0"},
+		Learn:       true,
+		BodyScoring: string(similarity.BodyTFIDF),
+	}
+	post()
+	server.learning.Wait()
+	if client.inboxReads != 1 {
+		t.Errorf("TF-IDF learning read the inbox %d times, want 1", client.inboxReads)
+	}
+	if got := weights("GET"); got.Accepted != 3 || got.Rejected != 7 {
+		t.Errorf("GET /api/weights after TF-IDF learning = %+v, want 3 accepted and 7 rejected", got)
+	}
+}
+
+// inboxCountingClient counts the reads of the inbox listing and of emails
+type inboxCountingClient struct {
+	jmap.JMAPClient
+	inboxReads  int
+	detailReads int
+	listedReads int
+}
+
+func (c *inboxCountingClient) GetEmails(ctx context.Context, ids []string) ([]jmap.Email, error) {
+	c.detailReads++
+	return c.JMAPClient.GetEmails(ctx, ids)
+}
+
+func (c *inboxCountingClient) GetListedEmails(ctx context.Context, ids []string) ([]jmap.Email, error) {
+	c.listedReads++
+	return c.JMAPClient.GetListedEmails(ctx, ids)
+}
+
+func (c *inboxCountingClient) GetInboxEmails(ctx context.Context, limit int) ([]jmap.Email, error) {
+	c.inboxReads++
+	return c.JMAPClient.GetInboxEmails(ctx, limit)
+}
@@ -0,0 +1,253 @@
+package similarity
+
+import (
+	"mailboxzero/internal/jmap"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Fuzzy grouping scores an email only against its candidates: the emails
+// whose subjects or bodies look alike under MinHash, found with
+// locality-sensitive hashing (LSH) instead of comparing every pair.
+//
+// Each feature is cut into shingles (character trigrams of the subject, words
+// of the body, with numbers masked) and summarised by lshBands*lshRows MinHash
+// values. Two emails are candidates if all values of any one band agree,
+// which for shingle sets with Jaccard similarity J happens with probability
+// 1-(1-J^rows)^bands: about 0.87 at J=0.5, 0.99 at J=0.6 and 0.003 at J=0.1.
+const (
+	lshBands = 32
+	lshRows  = 4
+
+	// exhaustiveLimit is the number of emails up to which every pair is
+	// scored: candidate generation does not pay off for small inboxes
+	exhaustiveLimit = 500
+
+	// missedSimilarity is how similar subjects or bodies may be and still
+	// be unlikely to collide. Thresholds at or below it are scored
+	// exhaustively.
+	missedSimilarity = 0.3
+)
+
+// weighted is implemented by scorers that combine subject, sender and body
+// with known weights, which candidate generation needs to know what to index
+type weighted interface {
+	Weights() Weights
+}
+
+// minHashSeeds are the seeds of the MinHash functions, fixed so that
+// grouping is deterministic
+var minHashSeeds = func() []uint64 {
+	seeds := make([]uint64, lshBands*lshRows)
+	state := uint64(0x6d61696c626f787a) // "mailboxz"
+	for i := range seeds {
+		state += 0x9e3779b97f4a7c15
+		seeds[i] = mix64(state) | 1
+	}
+	return seeds
+}()
+
+// candidateIndex finds the emails that may be similar enough to an email to
+// be grouped with it. Buckets hold email indexes in ascending order.
+type candidateIndex struct {
+	buckets      [][]int
+	emailBuckets [][]int
+	seen         []int
+}
+
+// newCandidateIndex indexes emails for grouping at threshold, or returns nil
+// when every pair should be scored: for small inboxes, low thresholds and
+// scorers whose features are unknown.
+func newCandidateIndex(emails []jmap.Email, threshold float64, scorer Scorer) *candidateIndex {
+	if len(emails) <= exhaustiveLimit || threshold <= missedSimilarity {
+		return nil
+	}
+	ws, ok := scorer.(weighted)
+	if !ok {
+		return nil
+	}
+	weights := ws.Weights().normalized()
+
+	index := &candidateIndex{
+		emailBuckets: make([][]int, len(emails)),
+		seen:         make([]int, len(emails)),
+	}
+	keys := make(map[uint64]int)
+	add := func(i int, key uint64) {
+		bucket, ok := keys[key]
+		if !ok {
+			bucket = len(index.buckets)
+			keys[key] = bucket
+			index.buckets = append(index.buckets, nil)
+		}
+		index.buckets[bucket] = append(index.buckets[bucket], i)
+		index.emailBuckets[i] = append(index.emailBuckets[i], bucket)
+	}
+
+	// Emails with dissimilar subjects and bodies only reach the threshold
+	// if the sender weighs enough, in which case the same sender or list
+	// makes them candidates too
+	bySender := weights.Sender > 0 &&
+		weights.Sender+(weights.Subject+weights.Body)*missedSimilarity >= threshold
+
+	signature := make([]uint64, lshBands*lshRows)
+	for i, email := range emails {
+		if weights.Subject > 0 {
+			if minHash(subjectShingles(email.Subject), signature) {
+				for band := 0; band < lshBands; band++ {
+					add(i, bandKey('s', band, signature[band*lshRows:(band+1)*lshRows]))
+				}
+			}
+		}
+		if weights.Body > 0 {
+			if minHash(bodyShingles(extractEmailBody(email)), signature) {
+				for band := 0; band < lshBands; band++ {
+					add(i, bandKey('b', band, signature[band*lshRows:(band+1)*lshRows]))
+				}
+			}
+		}
+		if bySender {
+			key := email.ListIdentifier()
+			if key == "" {
+				key = senderAddress(email)
+			}
+			if key != "" {
+				add(i, hashString('f', key))
+			}
+		}
+	}
+
+	return index
+}
+
+// candidates returns the emails after i that share a bucket with it and are
+// not done yet, in ascending order. Emails are grouped in index order, so
+// done emails and those up to i are dropped from the buckets for good.
+func (x *candidateIndex) candidates(i int, done func(j int) bool) []int {
+	var found []int
+	for _, bucket := range x.emailBuckets[i] {
+		members := x.buckets[bucket]
+		kept := members[:0]
+		for _, j := range members {
+			if j <= i || done(j) {
+				continue
+			}
+			kept = append(kept, j)
+			if x.seen[j] != i+1 {
+				x.seen[j] = i + 1
+				found = append(found, j)
+			}
+		}
+		x.buckets[bucket] = kept
+	}
+
+	sort.Ints(found)
+	return found
+}
+
+// subjectShingles are the character trigrams of the normalized subject. Empty
+// subjects are the same as each other, so they share a single shingle.
+func subjectShingles(subject string) []string {
+	runes := []rune(strings.Join(shingleWords(subject), " "))
+	if len(runes) < 3 {
+		return []string{string(runes)}
+	}
+
+	shingles := make([]string, 0, len(runes)-2)
+	for i := 0; i+3 <= len(runes); i++ {
+		shingles = append(shingles, string(runes[i:i+3]))
+	}
+	return shingles
+}
+
+// bodyShingles are the words of the normalized body. Emails without a body
+// never match on it, so they have no shingles.
+func bodyShingles(body string) []string {
+	return shingleWords(body)
+}
+
+// shingleWords are the words of the normalized text without placeholders,
+// which unrelated emails share as much as related ones
+func shingleWords(s string) []string {
+	words := strings.Fields(maskNumbers(normalizeString(s)))
+	kept := words[:0]
+	for _, word := range words {
+		if placeholderAt(word) != word {
+			kept = append(kept, word)
+		}
+	}
+	return kept
+}
+
+// maskNumbers replaces every run of digits with a single 0, so that emails
+// sent from one template with different order numbers, dates or amounts
+// have the same shingles
+func maskNumbers(s string) string {
+	var masked strings.Builder
+	inNumber := false
+	for _, r := range s {
+		if unicode.IsDigit(r) {
+			if !inNumber {
+				masked.WriteByte('0')
+			}
+			inNumber = true
+			continue
+		}
+		inNumber = false
+		masked.WriteRune(r)
+	}
+	return masked.String()
+}
+
+// minHash fills signature with the MinHash of the shingles and reports
+// whether there were any
+func minHash(shingles []string, signature []uint64) bool {
+	if len(shingles) == 0 {
+		return false
+	}
+
+	for k := range signature {
+		signature[k] = ^uint64(0)
+	}
+	for _, shingle := range shingles {
+		h := hashString(0, shingle)
+		for k, seed := range minHashSeeds {
+			if v := mix64(h ^ seed); v < signature[k] {
+				signature[k] = v
+			}
+		}
+	}
+	return true
+}
+
+// bandKey identifies the bucket of one band of a feature's signature
+func bandKey(feature byte, band int, rows []uint64) uint64 {
+	h := mix64(uint64(feature)<<32 | uint64(band))
+	for _, v := range rows {
+		h = mix64(h ^ v)
+	}
+	return h
+}
+
+// hashString is 64-bit FNV-1a of s, prefixed with a tag
+func hashString(tag byte, s string) uint64 {
+	const prime = 1099511628211
+	h := uint64(14695981039346656037)
+	h = (h ^ uint64(tag)) * prime
+	for i := 0; i < len(s); i++ {
+		h = (h ^ uint64(s[i])) * prime
+	}
+	return h
+}
+
+// mix64 is the SplitMix64 finalizer, which spreads every input bit over the
+// whole output
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
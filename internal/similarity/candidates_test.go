@@ -0,0 +1,160 @@
+package similarity
+
+import (
+	"mailboxzero/internal/jmap"
+	"sort"
+	"testing"
+)
+
+func TestNewCandidateIndex_Exhaustive(t *testing.T) {
+	large := syntheticInbox(exhaustiveLimit + 1)
+
+	tests := []struct {
+		name      string
+		emails    []jmap.Email
+		threshold float64
+		scorer    Scorer
+		wantIndex bool
+	}{
+		{name: "large inbox", emails: large, threshold: 0.75, scorer: DefaultScorer(), wantIndex: true},
+		{name: "small inbox", emails: large[:exhaustiveLimit], threshold: 0.75, scorer: DefaultScorer()},
+		{name: "low threshold", emails: large, threshold: missedSimilarity, scorer: DefaultScorer()},
+		{name: "unknown features", emails: large, threshold: 0.75, scorer: struct{ Scorer }{DefaultScorer()}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index := newCandidateIndex(tt.emails, tt.threshold, tt.scorer)
+			if (index != nil) != tt.wantIndex {
+				t.Errorf("newCandidateIndex() = %v, want index %v", index, tt.wantIndex)
+			}
+		})
+	}
+}
+
+func TestCandidateIndex_Candidates(t *testing.T) {
+	emails := syntheticInbox(2000)
+	index := newCandidateIndex(emails, 0.75, DefaultScorer())
+
+	// Emails of one sender share a template and must always be candidates;
+	// other pairs rarely should be
+	var missed, unrelated, related int
+	for i := range emails {
+		candidates := index.candidates(i, func(int) bool { return false })
+		if !sort.IntsAreSorted(candidates) {
+			t.Fatalf("candidates(%d) = %v, want ascending order", i, candidates)
+		}
+
+		found := make(map[int]bool)
+		for _, j := range candidates {
+			if j <= i {
+				t.Fatalf("candidates(%d) includes earlier email %d", i, j)
+			}
+			found[j] = true
+		}
+		for j := i + 1; j < len(emails); j++ {
+			sameSender := emails[i].From[0].Email == emails[j].From[0].Email
+			switch {
+			case sameSender && !found[j]:
+				missed++
+			case sameSender:
+				related++
+			case found[j]:
+				unrelated++
+			}
+		}
+	}
+
+	if related == 0 || missed > 0 {
+		t.Errorf("%d of %d pairs from the same sender are not candidates", missed, missed+related)
+	}
+	if unrelated > len(emails) {
+		t.Errorf("%d unrelated pairs are candidates, want at most one per email", unrelated)
+	}
+}
+
+func TestCandidateIndex_SkipsDone(t *testing.T) {
+	emails := syntheticInbox(exhaustiveLimit + 1)
+	index := newCandidateIndex(emails, 0.75, DefaultScorer())
+
+	first := index.candidates(0, func(int) bool { return false })
+	if len(first) < 2 {
+		t.Fatalf("candidates(0) = %v, want at least 2", first)
+	}
+
+	// Once done, an email is never a candidate again
+	done := first[0]
+	for i := 1; i < done; i++ {
+		for _, j := range index.candidates(i, func(j int) bool { return j == done }) {
+			if j == done {
+				t.Fatalf("candidates(%d) includes done email %d", i, done)
+			}
+		}
+	}
+	for _, j := range index.candidates(0, func(int) bool { return false }) {
+		if j == done {
+			t.Fatalf("candidates(0) includes done email %d after it was dropped", done)
+		}
+	}
+}
+
+func TestMaskNumbers(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"order 12345 shipped", "order 0 shipped"},
+		{"issue 7 of 2024", "issue 0 of 0"},
+		{"no numbers", "no numbers"},
+		{"v2 3", "v0 0"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := maskNumbers(tt.input); got != tt.want {
+			t.Errorf("maskNumbers(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestSubjectShingles(t *testing.T) {
+	a := subjectShingles("Order #1234 shipped")
+	b := subjectShingles("Order #98 shipped")
+	if len(a) == 0 || len(a) != len(b) {
+		t.Fatalf("subjectShingles() = %v and %v, want the same shingles for one template", a, b)
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			t.Errorf("shingle %d = %q and %q, want the same", i, a[i], b[i])
+		}
+	}
+
+	if got := subjectShingles(""); len(got) != 1 {
+		t.Errorf("subjectShingles(\"\") = %v, want a single shingle", got)
+	}
+}
+
+func TestFindEmailGroups_LargeInbox(t *testing.T) {
+	emails := syntheticInbox(1000)
+
+	perSender := make(map[string]int)
+	for _, email := range emails {
+		perSender[email.From[0].Email]++
+	}
+	var wantGroups int
+	for _, count := range perSender {
+		if count > 1 {
+			wantGroups++
+		}
+	}
+
+	groups := FindEmailGroups(emails, 0.75)
+	if len(groups) != wantGroups {
+		t.Errorf("FindEmailGroups() returned %d groups, want one for each of the %d repeat senders", len(groups), wantGroups)
+	}
+	for _, group := range groups {
+		if len(group.Emails) != perSender[group.Sender] {
+			t.Errorf("group of %s has %d emails, want %d", group.Sender, len(group.Emails), perSender[group.Sender])
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package similarity
+
+import (
+	"container/heap"
+	"fmt"
+	"mailboxzero/internal/jmap"
+	"sort"
+)
+
+// Clustering is how fuzzy grouping turns similar pairs into groups
+type Clustering string
+
+const (
+	// ClusterGreedy groups every email with the later emails similar to it,
+	// in inbox order. It is the fastest, but a chain of similar emails
+	// A~B~C may be split depending on the order.
+	ClusterGreedy Clustering = "greedy"
+	// ClusterConnected groups emails linked by a chain of similar pairs, the
+	// connected components found with union-find
+	ClusterConnected Clustering = "connected"
+	// ClusterAverage keeps merging the two clusters with the highest average
+	// pairwise similarity while it reaches the threshold (average-linkage
+	// hierarchical clustering). Unlike connected clustering, one link does
+	// not pull two dissimilar clusters together.
+	ClusterAverage Clustering = "average"
+)
+
+// Clusterings lists every clustering algorithm, greedy first
+var Clusterings = []Clustering{ClusterGreedy, ClusterConnected, ClusterAverage}
+
+// ParseClustering returns the clustering with the given name. An empty name
+// is greedy clustering, the default.
+func ParseClustering(name string) (Clustering, error) {
+	if name == "" {
+		return ClusterGreedy, nil
+	}
+	for _, clustering := range Clusterings {
+		if string(clustering) == name {
+			return clustering, nil
+		}
+	}
+	return "", fmt.Errorf("unknown clustering %q", name)
+}
+
+// canonicalOrder sorts a copy of emails newest first, then by ID, so that the
+// order-independent clusterings see the same inbox however it was listed
+func canonicalOrder(emails []jmap.Email) []jmap.Email {
+	sorted := append([]jmap.Email(nil), emails...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if !sorted[i].ReceivedAt.Equal(sorted[j].ReceivedAt) {
+			return sorted[i].ReceivedAt.After(sorted[j].ReceivedAt)
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+	return sorted
+}
+
+// pairsAfter returns the emails after i that are scored against it: every one
+// of them, or only its candidates if there is an index
+func pairsAfter(index *candidateIndex, i, n int) []int {
+	if index != nil {
+		return index.candidates(i, func(int) bool { return false })
+	}
+	others := make([]int, 0, n-i-1)
+	for j := i + 1; j < n; j++ {
+		others = append(others, j)
+	}
+	return others
+}
+
+// clusterConnected groups the emails connected by pairs scoring at least
+// threshold
+func clusterConnected(emails []jmap.Email, threshold float64, scorer Scorer, workers int) []EmailGroup {
+	emails = canonicalOrder(emails)
+	index := newCandidateIndex(emails, threshold, scorer)
+
+	parent := make([]int, len(emails))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for i := range emails {
+		// Pairs already connected cannot change the components
+		var others []int
+		for _, j := range pairsAfter(index, i, len(emails)) {
+			if find(i) != find(j) {
+				others = append(others, j)
+			}
+		}
+
+		scores := scoreAll(scorer, emails[i], emails, others, workers)
+		for k, j := range others {
+			if scores[k] >= threshold {
+				// The root is the earliest email of the component
+				if a, b := find(i), find(j); a < b {
+					parent[b] = a
+				} else if b < a {
+					parent[a] = b
+				}
+			}
+		}
+	}
+
+	var roots []int
+	members := make(map[int][]jmap.Email)
+	for i, email := range emails {
+		root := find(i)
+		if _, ok := members[root]; !ok {
+			roots = append(roots, root)
+		}
+		members[root] = append(members[root], email)
+	}
+
+	var clusters [][]jmap.Email
+	for _, root := range roots {
+		if len(members[root]) > 1 {
+			clusters = append(clusters, members[root])
+		}
+	}
+	return newEmailGroups(clusters, scorer, workers)
+}
+
+// clusterAverage merges clusters by average linkage until no two clusters
+// average at least threshold. Pairs that are not scored because they are
+// not candidates count as sharing nothing.
+func clusterAverage(emails []jmap.Email, threshold float64, scorer Scorer, workers int) []EmailGroup {
+	emails = canonicalOrder(emails)
+	index := newCandidateIndex(emails, threshold, scorer)
+
+	// Clusters are named after their first email. links[a][b] is the sum of
+	// the scores of every pair across clusters a and b.
+	links := make([]map[int]float64, len(emails))
+	members := make([][]int, len(emails))
+	for i := range emails {
+		links[i] = make(map[int]float64)
+		members[i] = []int{i}
+	}
+
+	for i := range emails {
+		others := pairsAfter(index, i, len(emails))
+		scores := scoreAll(scorer, emails[i], emails, others, workers)
+		for k, j := range others {
+			links[i][j] = scores[k]
+			links[j][i] = scores[k]
+		}
+	}
+
+	version := make([]int, len(emails))
+	merges := &mergeQueue{}
+	push := func(a, b int) {
+		if a > b {
+			a, b = b, a
+		}
+		average := links[a][b] / float64(len(members[a])*len(members[b]))
+		if average >= threshold {
+			heap.Push(merges, merge{a: a, b: b, average: average, versionA: version[a], versionB: version[b]})
+		}
+	}
+	for a := range links {
+		for b := range links[a] {
+			if a < b {
+				push(a, b)
+			}
+		}
+	}
+
+	for merges.Len() > 0 {
+		m := heap.Pop(merges).(merge)
+		if members[m.a] == nil || members[m.b] == nil || version[m.a] != m.versionA || version[m.b] != m.versionB {
+			continue
+		}
+
+		// Merge b into a, the cluster with the earlier first email
+		a, b := m.a, m.b
+		for c, sum := range links[b] {
+			delete(links[c], b)
+			if c == a {
+				continue
+			}
+			links[a][c] += sum
+			links[c][a] = links[a][c]
+		}
+		delete(links[a], b)
+		members[a] = append(members[a], members[b]...)
+		members[b], links[b] = nil, nil
+		version[a]++
+
+		for c := range links[a] {
+			push(a, c)
+		}
+	}
+
+	var clusters [][]jmap.Email
+	for _, indexes := range members {
+		if len(indexes) < 2 {
+			continue
+		}
+		sort.Ints(indexes)
+		cluster := make([]jmap.Email, len(indexes))
+		for k, i := range indexes {
+			cluster[k] = emails[i]
+		}
+		clusters = append(clusters, cluster)
+	}
+	return newEmailGroups(clusters, scorer, workers)
+}
+
+// newEmailGroups builds a group for every cluster, in the same order
+func newEmailGroups(clusters [][]jmap.Email, scorer Scorer, workers int) []EmailGroup {
+	groups := make([]EmailGroup, len(clusters))
+	forEach(len(clusters), workers, func(k int) {
+		groups[k] = newEmailGroup(clusters[k], calculateGroupSimilarity(clusters[k], scorer))
+	})
+	return groups
+}
+
+// merge is a candidate merge of clusters a < b, valid while neither has
+// changed since it was queued
+type merge struct {
+	a, b               int
+	average            float64
+	versionA, versionB int
+}
+
+// mergeQueue pops the merge with the highest average first, breaking ties by
+// the clusters' first emails so the order is fully determined
+type mergeQueue []merge
+
+func (q mergeQueue) Len() int { return len(q) }
+
+func (q mergeQueue) Less(i, j int) bool {
+	if q[i].average != q[j].average {
+		return q[i].average > q[j].average
+	}
+	if q[i].a != q[j].a {
+		return q[i].a < q[j].a
+	}
+	return q[i].b < q[j].b
+}
+
+func (q mergeQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *mergeQueue) Push(x interface{}) { *q = append(*q, x.(merge)) }
+
+func (q *mergeQueue) Pop() interface{} {
+	old := *q
+	m := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return m
+}
@@ -0,0 +1,140 @@
+package similarity
+
+import (
+	"mailboxzero/internal/jmap"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// pairScorer scores the listed pairs of email IDs, in either order, and
+// every other pair 0
+type pairScorer map[[2]string]float64
+
+func (p pairScorer) Score(email1, email2 jmap.Email) float64 {
+	if score, ok := p[[2]string{email1.ID, email2.ID}]; ok {
+		return score
+	}
+	return p[[2]string{email2.ID, email1.ID}]
+}
+
+// newestFirst returns emails with the given IDs, received in reverse order so
+// that the inbox lists them as given
+func newestFirst(ids ...string) []jmap.Email {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	emails := make([]jmap.Email, len(ids))
+	for i, id := range ids {
+		emails[i] = jmap.Email{ID: id, ReceivedAt: start.Add(-time.Duration(i) * time.Hour)}
+	}
+	return emails
+}
+
+func TestParseClustering(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Clustering
+		wantErr bool
+	}{
+		{name: "", want: ClusterGreedy},
+		{name: "greedy", want: ClusterGreedy},
+		{name: "connected", want: ClusterConnected},
+		{name: "average", want: ClusterAverage},
+		{name: "single", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseClustering(tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseClustering(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("ParseClustering(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestClustering_Chain(t *testing.T) {
+	// A~B and B~C, but A and C have little in common
+	scorer := pairScorer{{"A", "B"}: 0.9, {"B", "C"}: 0.9, {"A", "C"}: 0.1}
+
+	tests := []struct {
+		name       string
+		clustering Clustering
+		order      []string
+		want       [][]string
+	}{
+		{name: "greedy from A", clustering: ClusterGreedy, order: []string{"A", "B", "C"}, want: [][]string{{"A", "B"}}},
+		{name: "greedy from B", clustering: ClusterGreedy, order: []string{"B", "A", "C"}, want: [][]string{{"B", "A", "C"}}},
+		{name: "connected from A", clustering: ClusterConnected, order: []string{"A", "B", "C"}, want: [][]string{{"A", "B", "C"}}},
+		{name: "connected from B", clustering: ClusterConnected, order: []string{"B", "A", "C"}, want: [][]string{{"A", "B", "C"}}},
+		{name: "average from A", clustering: ClusterAverage, order: []string{"A", "B", "C"}, want: [][]string{{"A", "B"}}},
+		{name: "average from B", clustering: ClusterAverage, order: []string{"B", "A", "C"}, want: [][]string{{"A", "B"}}},
+	}
+
+	emails := make(map[string]jmap.Email)
+	for _, email := range newestFirst("A", "B", "C") {
+		emails[email.ID] = email
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var inbox []jmap.Email
+			for _, id := range tt.order {
+				inbox = append(inbox, emails[id])
+			}
+
+			groups := FindEmailGroupsWith(inbox, Options{Threshold: 0.75, Scorer: scorer, Clustering: tt.clustering})
+			if got := groupIDs(groups); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("groups = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClusterAverage_WeakLink(t *testing.T) {
+	// Two tight pairs joined by a single similar pair
+	scorer := pairScorer{{"A", "B"}: 0.9, {"C", "D"}: 0.9, {"B", "C"}: 0.9}
+	emails := newestFirst("A", "B", "C", "D")
+
+	connected := FindEmailGroupsWith(emails, Options{Threshold: 0.75, Scorer: scorer, Clustering: ClusterConnected})
+	if got, want := groupIDs(connected), [][]string{{"A", "B", "C", "D"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("connected groups = %v, want %v", got, want)
+	}
+
+	average := FindEmailGroupsWith(emails, Options{Threshold: 0.75, Scorer: scorer, Clustering: ClusterAverage})
+	if got, want := groupIDs(average), [][]string{{"A", "B"}, {"C", "D"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("average groups = %v, want %v", got, want)
+	}
+}
+
+func TestClustering_OrderIndependent(t *testing.T) {
+	inboxes := map[string][]jmap.Email{
+		"exhaustive": append(syntheticInbox(20), scaledMockInbox(40)...),
+		"candidates": append(syntheticInbox(20), scaledMockInbox(exhaustiveLimit)...),
+	}
+
+	for name, emails := range inboxes {
+		for _, clustering := range []Clustering{ClusterConnected, ClusterAverage} {
+			t.Run(name+"/"+string(clustering), func(t *testing.T) {
+				opts := Options{Threshold: 0.75, Clustering: clustering}
+				want := FindEmailGroupsWith(emails, opts)
+				if len(want) == 0 {
+					t.Fatal("FindEmailGroupsWith() found no groups")
+				}
+
+				rng := rand.New(rand.NewSource(1))
+				for round := 0; round < 2; round++ {
+					shuffled := append([]jmap.Email(nil), emails...)
+					rng.Shuffle(len(shuffled), func(i, j int) {
+						shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+					})
+
+					if got := FindEmailGroupsWith(shuffled, opts); !reflect.DeepEqual(got, want) {
+						t.Errorf("round %d: groups of the shuffled inbox differ", round)
+					}
+				}
+			})
+		}
+	}
+}
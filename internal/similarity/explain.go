@@ -0,0 +1,136 @@
+package similarity
+
+import "mailboxzero/internal/jmap"
+
+// Names of the features the built-in scorers compare
+const (
+	FeatureSubject = "subject"
+	FeatureSender  = "sender"
+	FeatureBody    = "body"
+)
+
+// FeatureScore is the similarity of one feature of two emails. Score includes
+// Bonus, the common-words bonus, and is weighted by Weight in the total.
+type FeatureScore struct {
+	Name   string  `json:"name"`
+	Score  float64 `json:"score"`
+	Bonus  float64 `json:"bonus"`
+	Weight float64 `json:"weight"`
+	// Note explains a score that was not computed the usual way
+	Note string `json:"note,omitempty"`
+}
+
+// Breakdown explains a similarity score feature by feature. Score is the
+// weighted sum of the feature scores.
+type Breakdown struct {
+	Features []FeatureScore `json:"features"`
+	Score    float64        `json:"score"`
+	// Against is the ID of the group member the score is against, when
+	// members are not all compared with the first
+	Against string `json:"against,omitempty"`
+}
+
+func newBreakdown(features ...FeatureScore) Breakdown {
+	breakdown := Breakdown{Features: features}
+	for _, f := range features {
+		breakdown.Score += f.Score * f.Weight
+	}
+	return breakdown
+}
+
+// Explainer is implemented by scorers that can break their score down.
+// Explain(a, b).Score must equal Score(a, b).
+type Explainer interface {
+	Explain(email1, email2 jmap.Email) Breakdown
+}
+
+// ScoredEmail is an email with the breakdown of its similarity to the email it
+// was matched against. Breakdown is nil for the email the others were matched
+// against and when the scorer cannot explain its scores.
+type ScoredEmail struct {
+	jmap.Email
+	Breakdown *Breakdown `json:"breakdown,omitempty"`
+}
+
+// explain returns the breakdown of the similarity of email to anchor, or nil
+// if the scorer is not an Explainer
+func explain(scorer Scorer, anchor, email jmap.Email) *Breakdown {
+	explainer, ok := scorer.(Explainer)
+	if !ok {
+		return nil
+	}
+	breakdown := explainer.Explain(anchor, email)
+	return &breakdown
+}
+
+// explainSample is how many other members each member of a group is
+// compared with to find the one it is most similar to
+const explainSample = 50
+
+// explainGroup records how the members of the group compare. Greedy groups
+// are built around their first email, so every other member is explained
+// against it. Members of connected and average clusters need not resemble
+// the first email, so each is explained against the member it is most
+// similar to.
+func explainGroup(group *EmailGroup, scorer Scorer, clustering Clustering) {
+	if _, ok := scorer.(Explainer); !ok || len(group.Emails) == 0 {
+		return
+	}
+
+	if clustering != ClusterConnected && clustering != ClusterAverage {
+		anchor := group.Emails[0]
+		group.Scores = make(map[string]*Breakdown, len(group.Emails)-1)
+		for _, email := range group.Emails[1:] {
+			group.Scores[email.ID] = explain(scorer, anchor, email)
+		}
+		return
+	}
+
+	// One more than the sample, as a member may be among the sampled
+	sample := spread(group.Emails, explainSample+1)
+	group.Scores = make(map[string]*Breakdown, len(group.Emails))
+	for _, email := range group.Emails {
+		var closest *jmap.Email
+		best := -1.0
+		for k := range sample {
+			if sample[k].ID == email.ID {
+				continue
+			}
+			if score := scorer.Score(sample[k], email); score > best {
+				closest, best = &sample[k], score
+			}
+		}
+		if closest == nil {
+			continue
+		}
+		breakdown := explain(scorer, *closest, email)
+		breakdown.Against = closest.ID
+		group.Scores[email.ID] = breakdown
+	}
+}
+
+// ScoredEmails returns the group members with their breakdowns
+func (g EmailGroup) ScoredEmails() []ScoredEmail {
+	scored := make([]ScoredEmail, len(g.Emails))
+	for i, email := range g.Emails {
+		scored[i] = ScoredEmail{Email: email, Breakdown: g.Scores[email.ID]}
+	}
+	return scored
+}
+
+// ExplainSimilarToEmail is FindSimilarToEmailWith with the breakdown of each
+// match against the target
+func ExplainSimilarToEmail(targetEmail jmap.Email, emails []jmap.Email, opts Options) []ScoredEmail {
+	opts = opts.fit(emails)
+	similar := FindSimilarToEmailWith(targetEmail, emails, opts)
+	scorer := opts.scorer()
+
+	scored := make([]ScoredEmail, len(similar))
+	forEach(len(similar), opts.workers(), func(i int) {
+		scored[i] = ScoredEmail{Email: similar[i]}
+		if i > 0 {
+			scored[i].Breakdown = explain(scorer, targetEmail, similar[i])
+		}
+	})
+	return scored
+}
@@ -0,0 +1,171 @@
+package similarity
+
+import (
+	"encoding/json"
+	"mailboxzero/internal/jmap"
+	"math"
+	"testing"
+)
+
+// constantScorer rates every pair the same and cannot explain itself
+type constantScorer float64
+
+func (c constantScorer) Score(email1, email2 jmap.Email) float64 {
+	return float64(c)
+}
+
+func TestStringSimilarityWithBonus(t *testing.T) {
+	tests := []struct {
+		name      string
+		s1, s2    string
+		wantBonus float64
+	}{
+		{name: "identical", s1: "weekly report", s2: "weekly report", wantBonus: 0},
+		{name: "no common words", s1: "invoice", s2: "shipping", wantBonus: 0},
+		{name: "common words", s1: "weekly sales report march", s2: "weekly sales report april", wantBonus: 0.1},
+		{name: "bonus capped at 1", s1: "weekly sales report a", s2: "weekly sales report b", wantBonus: 1.0 / 21},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			similarity, bonus := stringSimilarityWithBonus(tt.s1, tt.s2)
+			if math.Abs(bonus-tt.wantBonus) > 1e-9 {
+				t.Errorf("bonus = %v, want %v", bonus, tt.wantBonus)
+			}
+			if similarity > 1.0 || similarity != stringSimilarity(tt.s1, tt.s2) {
+				t.Errorf("similarity = %v, want stringSimilarity() %v", similarity, stringSimilarity(tt.s1, tt.s2))
+			}
+		})
+	}
+}
+
+func TestLevenshteinScorer_Explain(t *testing.T) {
+	email1 := jmap.Email{
+		Subject: "Weekly sales report March",
+		From:    []jmap.EmailAddress{{Email: "reports@example.com"}},
+		ListID:  "Reports <reports.example.com>",
+	}
+	email2 := jmap.Email{
+		Subject: "Weekly sales report April",
+		From:    []jmap.EmailAddress{{Email: "noreply@example.com"}},
+		ListID:  "Reports <reports.example.com>",
+		Preview: "This week in sales",
+	}
+
+	scorer := DefaultScorer().(*LevenshteinScorer)
+	breakdown := scorer.Explain(email1, email2)
+
+	if breakdown.Score != scorer.Score(email1, email2) {
+		t.Errorf("Explain().Score = %v, want Score() %v", breakdown.Score, scorer.Score(email1, email2))
+	}
+
+	features := make(map[string]FeatureScore)
+	var sum float64
+	for _, f := range breakdown.Features {
+		features[f.Name] = f
+		sum += f.Score * f.Weight
+	}
+	if math.Abs(sum-breakdown.Score) > 1e-9 {
+		t.Errorf("weighted feature scores sum to %v, want %v", sum, breakdown.Score)
+	}
+
+	if f := features[FeatureSubject]; f.Bonus != 0.1 || f.Weight != 0.4 {
+		t.Errorf("subject = %+v, want the common-words bonus and weight 0.4", f)
+	}
+	if f := features[FeatureSender]; f.Score != 1.0 || f.Note != "same mailing list" {
+		t.Errorf("sender = %+v, want 1 for the same list", f)
+	}
+	if f := features[FeatureBody]; f.Score != 0 || f.Note == "" {
+		t.Errorf("body = %+v, want 0 with a note, only one email has a body", f)
+	}
+}
+
+func TestFindEmailGroupsWith_Scores(t *testing.T) {
+	emails := []jmap.Email{
+		{ID: "a1", Subject: "Newsletter A", From: []jmap.EmailAddress{{Email: "a@example.com"}}},
+		{ID: "a2", Subject: "Newsletter A", From: []jmap.EmailAddress{{Email: "a@example.com"}}},
+		{ID: "a3", Subject: "Newsletter A!", From: []jmap.EmailAddress{{Email: "a@example.com"}}},
+	}
+
+	groups := FindEmailGroupsWith(emails, Options{Threshold: 0.5})
+	if len(groups) != 1 {
+		t.Fatalf("FindEmailGroupsWith() returned %d groups, want 1", len(groups))
+	}
+
+	group := groups[0]
+	if len(group.Scores) != 2 || group.Scores["a1"] != nil {
+		t.Fatalf("Scores = %v, want breakdowns for every member but the first", group.Scores)
+	}
+	for _, email := range group.ScoredEmails()[1:] {
+		if email.Breakdown == nil || email.Breakdown.Score < 0.5 {
+			t.Errorf("member %s breakdown = %+v, want a score above the threshold", email.ID, email.Breakdown)
+		}
+	}
+
+	groups = FindEmailGroupsWith(emails, Options{Threshold: 0.5, Scorer: constantScorer(1)})
+	if groups[0].Scores != nil {
+		t.Errorf("Scores = %v, want none from a scorer that cannot explain", groups[0].Scores)
+	}
+}
+
+// explainingPairScorer is a pairScorer that explains its scores as a single
+// feature
+type explainingPairScorer struct{ pairScorer }
+
+func (p explainingPairScorer) Explain(email1, email2 jmap.Email) Breakdown {
+	return newBreakdown(FeatureScore{Name: "pair", Score: p.Score(email1, email2), Weight: 1})
+}
+
+func TestFindEmailGroupsWith_ScoresAgainstClosestMember(t *testing.T) {
+	// c is only grouped with a through b, which it is similar to
+	scorer := explainingPairScorer{pairScorer{
+		{"a", "b"}: 0.9,
+		{"b", "c"}: 0.8,
+		{"a", "c"}: 0.1,
+	}}
+	opts := Options{Threshold: 0.7, Clustering: ClusterConnected, Scorer: scorer}
+
+	groups := FindEmailGroupsWith(newestFirst("a", "b", "c"), opts)
+	if len(groups) != 1 || groups[0].Size != 3 {
+		t.Fatalf("FindEmailGroupsWith() = %+v, want a, b and c grouped", groups)
+	}
+
+	want := map[string]string{"a": "b", "b": "a", "c": "b"}
+	for id, against := range want {
+		breakdown := groups[0].Scores[id]
+		if breakdown == nil || breakdown.Against != against || breakdown.Score < opts.Threshold {
+			t.Errorf("Scores[%s] = %+v, want a score above the threshold against %s", id, breakdown, against)
+		}
+	}
+}
+
+func TestExplainSimilarToEmail(t *testing.T) {
+	target := jmap.Email{ID: "t", Subject: "Order shipped", From: []jmap.EmailAddress{{Email: "shop@example.com"}}, Preview: "On its way"}
+	emails := []jmap.Email{
+		target,
+		{ID: "m", Subject: "Order shipped", From: []jmap.EmailAddress{{Email: "shop@example.com"}}, Preview: "On its way"},
+		{ID: "x", Subject: "Lunch?", From: []jmap.EmailAddress{{Email: "friend@example.org"}}},
+	}
+
+	scored := ExplainSimilarToEmail(target, emails, Options{Threshold: 0.7})
+	if len(scored) != 2 || scored[0].ID != "t" || scored[1].ID != "m" {
+		t.Fatalf("ExplainSimilarToEmail() = %+v, want the target and one match", scored)
+	}
+	if scored[0].Breakdown != nil {
+		t.Error("the target should not have a breakdown")
+	}
+	if scored[1].Breakdown == nil || scored[1].Breakdown.Score != 1.0 {
+		t.Errorf("match breakdown = %+v, want score 1", scored[1].Breakdown)
+	}
+
+	// Encoded, a scored email is the email with an extra breakdown field
+	data, err := json.Marshal(scored[1])
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	var fields map[string]interface{}
+	json.Unmarshal(data, &fields)
+	if fields["id"] != "m" || fields["subject"] != "Order shipped" || fields["breakdown"] == nil {
+		t.Errorf("encoded scored email = %s, want email fields and breakdown", data)
+	}
+}
@@ -0,0 +1,165 @@
+package similarity
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// MaxDecisions is how many of a user's newest decisions are kept and
+// learned from
+const MaxDecisions = 1000
+
+// Feedback keeps the archive decisions of every user and the weights learned
+// from them. When opened with a path it is persisted as JSON after every
+// change so it survives restarts.
+type Feedback struct {
+	path string
+
+	mu    sync.Mutex
+	users map[string]*userFeedback
+}
+
+type userFeedback struct {
+	Decisions []Decision `json:"decisions"`
+	// Weights are learned from Decisions, nil until there are enough
+	Weights *Weights `json:"weights,omitempty"`
+}
+
+// FeedbackSummary reports what has been learned for a user. Weights is nil
+// while the default or configured weights apply.
+type FeedbackSummary struct {
+	Accepted int      `json:"accepted"`
+	Rejected int      `json:"rejected"`
+	Weights  *Weights `json:"weights,omitempty"`
+}
+
+// NewMemoryFeedback creates feedback that is not persisted
+func NewMemoryFeedback() *Feedback {
+	return &Feedback{users: make(map[string]*userFeedback)}
+}
+
+// OpenFeedback loads the feedback stored at path, or starts with none if the
+// file does not exist yet
+func OpenFeedback(path string) (*Feedback, error) {
+	f := NewMemoryFeedback()
+	f.path = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read feedback: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &f.users); err != nil {
+		return nil, fmt.Errorf("failed to parse feedback: %w", err)
+	}
+	if f.users == nil {
+		f.users = make(map[string]*userFeedback)
+	}
+	return f, nil
+}
+
+// Record adds decisions of a user, keeping the newest MaxDecisions, and
+// learns the user's weights again from them
+func (f *Feedback) Record(user string, decisions []Decision) (FeedbackSummary, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	u := f.users[user]
+	if u == nil {
+		u = &userFeedback{}
+		f.users[user] = u
+	}
+	u.Decisions = append(u.Decisions, decisions...)
+	if len(u.Decisions) > MaxDecisions {
+		u.Decisions = append([]Decision(nil), u.Decisions[len(u.Decisions)-MaxDecisions:]...)
+	}
+
+	u.Weights = nil
+	if weights, err := Train(u.Decisions); err == nil {
+		u.Weights = &weights
+	}
+
+	return u.summary(), f.save()
+}
+
+// Weights returns the weights learned for a user, if any
+func (f *Feedback) Weights(user string) (Weights, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if u := f.users[user]; u != nil && u.Weights != nil {
+		return *u.Weights, true
+	}
+	return Weights{}, false
+}
+
+// Summary reports the decisions recorded and weights learned for a user
+func (f *Feedback) Summary(user string) FeedbackSummary {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if u := f.users[user]; u != nil {
+		return u.summary()
+	}
+	return FeedbackSummary{}
+}
+
+// Reset forgets the decisions and learned weights of a user, so the default
+// or configured weights apply again
+func (f *Feedback) Reset(user string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.users, user)
+	return f.save()
+}
+
+func (u *userFeedback) summary() FeedbackSummary {
+	summary := FeedbackSummary{Weights: u.Weights}
+	for _, d := range u.Decisions {
+		if d.Accepted {
+			summary.Accepted++
+		} else {
+			summary.Rejected++
+		}
+	}
+	return summary
+}
+
+// save writes the feedback atomically so a crash never leaves a torn file
+func (f *Feedback) save() error {
+	if f.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(f.users, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode feedback: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), ".feedback-*")
+	if err != nil {
+		return fmt.Errorf("failed to write feedback: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write feedback: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write feedback: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return fmt.Errorf("failed to write feedback: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package similarity
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// senderDecisions are decisions of a user who archives by sender
+func senderDecisions(n int) []Decision {
+	var decisions []Decision
+	for i := 0; i < n; i++ {
+		decisions = append(decisions,
+			Decision{Subject: 0.5, Sender: 1, Body: 0.4, Accepted: true},
+			Decision{Subject: 0.5, Sender: 0.1, Body: 0.4, Accepted: false},
+		)
+	}
+	return decisions
+}
+
+func TestFeedback(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "feedback.json")
+	feedback, err := OpenFeedback(path)
+	if err != nil {
+		t.Fatalf("OpenFeedback() error = %v", err)
+	}
+
+	summary, err := feedback.Record("alice", senderDecisions(2))
+	if err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+	if summary.Accepted != 2 || summary.Rejected != 2 || summary.Weights != nil {
+		t.Errorf("Record() = %+v, want 2 accepted, 2 rejected and no weights yet", summary)
+	}
+	if _, ok := feedback.Weights("alice"); ok {
+		t.Error("Weights() learned from too few decisions")
+	}
+
+	if _, err := feedback.Record("alice", senderDecisions(5)); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+	learned, ok := feedback.Weights("alice")
+	if !ok || learned.Sender <= learned.Subject {
+		t.Errorf("Weights() = %+v, %v, want the sender weighed most", learned, ok)
+	}
+	if _, ok := feedback.Weights("bob"); ok {
+		t.Error("Weights() of another user were learned from alice's decisions")
+	}
+
+	// The decisions and weights survive a restart
+	reopened, err := OpenFeedback(path)
+	if err != nil {
+		t.Fatalf("OpenFeedback() error = %v", err)
+	}
+	if got, ok := reopened.Weights("alice"); !ok || got != learned {
+		t.Errorf("reopened Weights() = %+v, %v, want %+v", got, ok, learned)
+	}
+	if got := reopened.Summary("alice"); got.Accepted != 7 || got.Rejected != 7 {
+		t.Errorf("reopened Summary() = %+v, want 7 accepted and 7 rejected", got)
+	}
+
+	if err := reopened.Reset("alice"); err != nil {
+		t.Fatalf("Reset() error = %v", err)
+	}
+	if _, ok := reopened.Weights("alice"); ok {
+		t.Error("Weights() after Reset() are still learned")
+	}
+	if got := reopened.Summary("alice"); got != (FeedbackSummary{}) {
+		t.Errorf("Summary() after Reset() = %+v, want none", got)
+	}
+	if again, _ := OpenFeedback(path); again.Summary("alice") != (FeedbackSummary{}) {
+		t.Error("Reset() was not saved")
+	}
+}
+
+func TestFeedback_KeepsNewestDecisions(t *testing.T) {
+	feedback := NewMemoryFeedback()
+	feedback.Record("alice", senderDecisions(MaxDecisions))
+	summary, _ := feedback.Record("alice", []Decision{{Accepted: true}})
+
+	if total := summary.Accepted + summary.Rejected; total != MaxDecisions {
+		t.Errorf("Record() kept %d decisions, want %d", total, MaxDecisions)
+	}
+	// The oldest decision, an accepted one, made way for the new one
+	if summary.Accepted != MaxDecisions/2 {
+		t.Errorf("Record() kept %d accepted decisions, want %d", summary.Accepted, MaxDecisions/2)
+	}
+}
+
+func TestOpenFeedback_Corrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "feedback.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0644); err != nil {
+		t.Fatalf("failed to write feedback: %v", err)
+	}
+
+	if _, err := OpenFeedback(path); err == nil {
+		t.Error("OpenFeedback() of a corrupt file succeeded")
+	}
+}
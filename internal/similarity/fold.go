@@ -0,0 +1,62 @@
+package similarity
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// foldCompatible replaces the compatibility characters marketing emails dress
+// their text up with by the characters they stand for (NFKC): full-width and
+// half-width forms, ligatures, superscript and circled digits, and the bold,
+// italic and script letters of the mathematical alphanumerics.
+func foldCompatible(s string) string {
+	return norm.NFKC.String(s)
+}
+
+// foldCase lowercases s by Unicode case folding, so "ß" becomes "ss", and
+// removes the diacritics of Latin, Greek and Cyrillic letters, the
+// nonspacing marks decomposing it (NFD) leaves after them, so "Café" and
+// "Müller" compare equal to "Cafe" and "Muller". The marks of other scripts
+// are part of their letters, such as the sound marks of kana and the vowel
+// signs of Indic scripts, and are kept. The rest is composed again (NFC) so
+// Hangul keeps its syllables.
+func foldCase(s string) string {
+	if isASCII(s) {
+		return strings.ToLower(s)
+	}
+	s = norm.NFD.String(cases.Fold().String(s))
+
+	var folded strings.Builder
+	folded.Grow(len(s))
+	diacritics := false
+	for _, r := range s {
+		if !unicode.Is(unicode.Mn, r) {
+			diacritics = unicode.In(r, unicode.Latin, unicode.Greek, unicode.Cyrillic)
+		} else if diacritics {
+			continue
+		}
+		folded.WriteRune(r)
+	}
+	return norm.NFC.String(folded.String())
+}
+
+// isWordRune reports the runes words are made of. Marks belong to the letter
+// before them and are only part of a word after one.
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// isASCII reports whether s has no characters to decompose or fold beyond
+// ASCII lowercasing
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
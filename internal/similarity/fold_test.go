@@ -0,0 +1,118 @@
+package similarity
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFoldCompatible(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "ascii", input: "Your order #42", want: "Your order #42"},
+		{name: "full-width", input: "ＳＡＬＥ　５０％ ＯＦＦ", want: "SALE 50% OFF"},
+		{name: "half-width katakana", input: "ｶﾞｲﾄﾞ ﾊﾟｽﾜｰﾄﾞ", want: "ガイド パスワード"},
+		{name: "stray sound mark", input: "ｱﾞ", want: "ア\u3099"},
+		{name: "ligatures", input: "ﬁnal oﬀer", want: "final offer"},
+		{name: "mathematical bold", input: "𝐁𝐈𝐆 𝐒𝐀𝐋𝐄 𝟓𝟎", want: "BIG SALE 50"},
+		{name: "mathematical script", input: "𝓢𝓹𝓮𝓬𝓲𝓪𝓵 ℴ𝒻𝒻ℯ𝓇", want: "Special offer"},
+		{name: "circled", input: "① ⑫ ⓢⓐⓛⓔ", want: "1 12 sale"},
+		{name: "superscripts", input: "m² and H₂O™", want: "m2 and H2OTM"},
+		{name: "no-break spaces", input: "50\u00a0%\u202foff", want: "50 % off"},
+		{name: "cjk compatibility ideographs", input: "\uf900\uf91d", want: "\u8c48\u6b04"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := foldCompatible(tt.input); got != tt.want {
+				t.Errorf("foldCompatible(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeString_Unicode(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		// Finnish
+		{name: "finnish", input: "Tilauksesi on lähetetty!", want: "tilauksesi on lahetetty"},
+		{name: "finnish capitals", input: "ÄÄNESTÄ NYT – KYSELY PÄÄTTYY", want: "aanesta nyt kysely paattyy"},
+		{name: "swedish ring", input: "Återställ lösenord", want: "aterstall losenord"},
+
+		// German
+		{name: "german umlauts", input: "Bestätigung Ihrer Bestellung für Müller", want: "bestatigung ihrer bestellung fur muller"},
+		{name: "german sharp s", input: "Größe: Straße", want: "grosse strasse"},
+		{name: "decomposed", input: "Mu\u0308ller Cafe\u0301", want: "muller cafe"},
+
+		// Other Latin alphabets
+		{name: "french", input: "Café crème à emporter", want: "cafe creme a emporter"},
+		// Letters with a stroke are letters of their own, not marked ones
+		{name: "polish", input: "Łódź zażółć", want: "łodz zazołc"},
+		{name: "vietnamese", input: "Cảm ơn, hệ thống", want: "cam on he thong"},
+		{name: "stacked diacritics", input: "ǘ ǖ", want: "u u"},
+		{name: "turkish dotted capital", input: "İstanbul", want: "istanbul"},
+
+		// CJK, whose kana keep their sound marks
+		{name: "japanese", input: "【重要】ご注文の確認", want: "重要 ご注文の確認"},
+		{name: "full-width digits", input: "注文番号：１２３４５", want: "注文番号 <n>"},
+		{name: "half-width katakana", input: "ﾊﾟｽﾜｰﾄﾞのﾘｾｯﾄ", want: "パスワードのリセット"},
+		{name: "katakana", input: "パスワードのリセット", want: "パスワードのリセット"},
+		{name: "decomposed kana", input: "がいど", want: "がいど"},
+		{name: "chinese", input: "您的订单已发货！", want: "您的订单已发货"},
+		{name: "korean", input: "주문이 확인되었습니다.", want: "주문이 확인되었습니다"},
+
+		// Scripts with vowel signs keep them, spacing or not
+		{name: "devanagari", input: "नमस्ते दुनिया", want: "नमस्ते दुनिया"},
+		{name: "tamil", input: "வணக்கம்!", want: "வணக்கம்"},
+
+		// Greek and Cyrillic lose their diacritics like Latin
+		{name: "greek", input: "Καλημέρα", want: "καλημερα"},
+		{name: "cyrillic", input: "Ёлка", want: "елка"},
+
+		// Emoji
+		{name: "emoji around", input: "🔥🔥 Big Sale 🔥", want: "big sale"},
+		{name: "emoji between", input: "Sale👍🏽today", want: "sale today"},
+		{name: "zwj sequence", input: "👨\u200d👩\u200d👧 Family plan", want: "family plan"},
+		{name: "variation selector", input: "❤\ufe0f Favourites", want: "favourites"},
+		{name: "keycap", input: "1\ufe0f\u20e3 day left", want: "<n> day left"},
+		{name: "flag", input: "🇫🇮 Suomi", want: "suomi"},
+		{name: "only emoji", input: "🎉🎉", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeString(tt.input); got != tt.want {
+				t.Errorf("normalizeString(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStringSimilarity_Unicode(t *testing.T) {
+	tests := []struct {
+		name   string
+		s1, s2 string
+		want   float64
+	}{
+		{name: "diacritics", s1: "Café", s2: "Cafe", want: 1},
+		{name: "sharp s", s1: "Größe", s2: "Grosse", want: 1},
+		{name: "full-width", s1: "ＳＡＬＥ", s2: "sale", want: 1},
+		{name: "emoji", s1: "🎉 Flash sale ends tonight 🎉", s2: "Flash sale ends tonight", want: 1},
+		// One of four characters differs, whatever their encoded length
+		{name: "cjk", s1: "注文確認", s2: "注文確定", want: 0.75},
+		{name: "finnish", s1: "Kuitti", s2: "Kuittiä", want: 1 - 1.0/7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stringSimilarity(tt.s1, tt.s2); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("stringSimilarity(%q, %q) = %v, want %v", tt.s1, tt.s2, got, tt.want)
+			}
+		})
+	}
+}
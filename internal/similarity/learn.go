@@ -0,0 +1,168 @@
+package similarity
+
+import (
+	"errors"
+	"mailboxzero/internal/jmap"
+	"math"
+)
+
+// Decision is a member of a group the user archived (accepted) or left out
+// of the archive (rejected), with its feature scores against the members
+// that were archived. Decisions are the examples weights are learned from.
+type Decision struct {
+	Subject  float64 `json:"subject"`
+	Sender   float64 `json:"sender"`
+	Body     float64 `json:"body"`
+	Accepted bool    `json:"accepted"`
+}
+
+// decisionSample is how many of each kind of member are turned into
+// decisions, and how many archived members each is compared with, so large
+// groups neither take long to record nor outweigh the others
+const decisionSample = 10
+
+// Decisions turns the archive of the accepted members of a group, leaving
+// out the rejected ones, into decisions. Each member is scored against the
+// other accepted members. None are returned when there is nothing to compare
+// with or the scorer cannot explain its scores.
+func Decisions(accepted, rejected []jmap.Email, opts Options) []Decision {
+	all := append(append([]jmap.Email(nil), accepted...), rejected...)
+	explainer, ok := opts.fit(all).scorer().(Explainer)
+	if !ok {
+		return nil
+	}
+
+	anchors := spread(accepted, decisionSample)
+	decide := func(email jmap.Email, isAccepted bool) (Decision, bool) {
+		decision := Decision{Accepted: isAccepted}
+		count := 0
+		for _, anchor := range anchors {
+			if anchor.ID == email.ID {
+				continue
+			}
+			for _, f := range explainer.Explain(anchor, email).Features {
+				switch f.Name {
+				case FeatureSubject:
+					decision.Subject += f.Score
+				case FeatureSender:
+					decision.Sender += f.Score
+				case FeatureBody:
+					decision.Body += f.Score
+				}
+			}
+			count++
+		}
+		if count == 0 {
+			return Decision{}, false
+		}
+		decision.Subject /= float64(count)
+		decision.Sender /= float64(count)
+		decision.Body /= float64(count)
+		return decision, true
+	}
+
+	var decisions []Decision
+	for _, email := range spread(accepted, decisionSample) {
+		if d, ok := decide(email, true); ok {
+			decisions = append(decisions, d)
+		}
+	}
+	for _, email := range spread(rejected, decisionSample) {
+		if d, ok := decide(email, false); ok {
+			decisions = append(decisions, d)
+		}
+	}
+	return decisions
+}
+
+// spread returns n evenly spaced emails, or all of them if there are no more
+func spread(emails []jmap.Email, n int) []jmap.Email {
+	if len(emails) <= n {
+		return emails
+	}
+	sample := make([]jmap.Email, n)
+	for k := range sample {
+		sample[k] = emails[k*(len(emails)-1)/(n-1)]
+	}
+	return sample
+}
+
+// MinDecisions is how many decisions Train needs, of which at least one
+// accepted and one rejected
+const MinDecisions = 10
+
+// ErrNotEnoughDecisions is returned by Train when there are too few
+// decisions, or only accepted or only rejected ones, to learn from
+var ErrNotEnoughDecisions = errors.New("not enough decisions to learn weights from")
+
+const (
+	trainIterations   = 2000
+	trainLearningRate = 0.5
+	// trainPenalty keeps the weights small so that features the decisions
+	// say little about do not get extreme weights
+	trainPenalty = 0.01
+)
+
+// Train fits feature weights to decisions by logistic regression on the
+// feature scores, so that accepted members score higher than rejected ones.
+// Weights cannot be negative, so a feature that only tells rejected members
+// apart is left out. Both kinds of decision count as much in total however
+// many there are of each.
+//
+// Only the ratios of the fitted weights are kept: the bias of the fit is
+// dropped and the weights are scaled to sum to 1, so scores stay between 0
+// and 1 and the user's threshold still decides what is grouped. The learned
+// weights change which members reach the threshold, not the threshold.
+func Train(decisions []Decision) (Weights, error) {
+	var accepted, rejected int
+	for _, d := range decisions {
+		if d.Accepted {
+			accepted++
+		} else {
+			rejected++
+		}
+	}
+	if len(decisions) < MinDecisions || accepted == 0 || rejected == 0 {
+		return Weights{}, ErrNotEnoughDecisions
+	}
+
+	// Start from the defaults, which fit no decisions in particular
+	w := [3]float64{DefaultWeights.Subject, DefaultWeights.Sender, DefaultWeights.Body}
+	var bias float64
+	for iteration := 0; iteration < trainIterations; iteration++ {
+		var gradient [3]float64
+		var biasGradient float64
+		for _, d := range decisions {
+			x := [3]float64{d.Subject, d.Sender, d.Body}
+			label, share := 0.0, 0.5/float64(rejected)
+			if d.Accepted {
+				label, share = 1.0, 0.5/float64(accepted)
+			}
+
+			z := bias
+			for k := range w {
+				z += w[k] * x[k]
+			}
+			residual := (sigmoid(z) - label) * share
+			for k := range gradient {
+				gradient[k] += residual * x[k]
+			}
+			biasGradient += residual
+		}
+
+		for k := range w {
+			w[k] = math.Max(w[k]-trainLearningRate*(gradient[k]+trainPenalty*w[k]), 0)
+		}
+		bias -= trainLearningRate * biasGradient
+	}
+
+	weights := Weights{Subject: w[0], Sender: w[1], Body: w[2]}
+	if weights.Validate() != nil {
+		return Weights{}, errors.New("no feature scores accepted members higher than rejected ones")
+	}
+	return weights.normalized(), nil
+}
+
+func sigmoid(z float64) float64 {
+	return 1 / (1 + math.Exp(-z))
+}
@@ -0,0 +1,173 @@
+package similarity
+
+import (
+	"errors"
+	"fmt"
+	"mailboxzero/internal/jmap"
+	"testing"
+)
+
+func TestDecisions(t *testing.T) {
+	email := func(id, subject, from, body string) jmap.Email {
+		return jmap.Email{ID: id, Subject: subject, From: []jmap.EmailAddress{{Email: from}}, Preview: body}
+	}
+	accepted := []jmap.Email{
+		email("1", "Your order has shipped", "shop@store.example", "Your parcel is on its way"),
+		email("2", "Your order has shipped", "shop@store.example", "Your parcel is on its way"),
+		email("3", "Your order has shipped", "shop@store.example", "Your parcel is on the way"),
+	}
+	rejected := []jmap.Email{
+		email("4", "Your order has shipped", "noreply@other.example", "Track the delivery of your books"),
+	}
+
+	decisions := Decisions(accepted, rejected, Options{})
+	if len(decisions) != 4 {
+		t.Fatalf("Decisions() = %d decisions, want 4", len(decisions))
+	}
+	for i, d := range decisions {
+		if d.Accepted != (i < 3) {
+			t.Errorf("decision %d accepted = %v, want %v", i, d.Accepted, i < 3)
+		}
+		if d.Subject != 1 {
+			t.Errorf("decision %d subject = %v, want 1", i, d.Subject)
+		}
+	}
+	if accepted, rejected := decisions[0], decisions[3]; rejected.Sender >= accepted.Sender || rejected.Body >= accepted.Body {
+		t.Errorf("rejected decision %+v does not score lower than accepted %+v", rejected, accepted)
+	}
+
+	if got := Decisions(accepted[:1], nil, Options{}); len(got) != 0 {
+		t.Errorf("Decisions() of a single archived email = %+v, want none", got)
+	}
+	if got := Decisions(nil, rejected, Options{}); len(got) != 0 {
+		t.Errorf("Decisions() without archived emails = %+v, want none", got)
+	}
+}
+
+func TestDecisions_LargeGroup(t *testing.T) {
+	var accepted []jmap.Email
+	for i := 0; i < 100; i++ {
+		accepted = append(accepted, jmap.Email{ID: fmt.Sprint(i), Subject: "Weekly digest"})
+	}
+
+	if got := Decisions(accepted, nil, Options{}); len(got) != decisionSample {
+		t.Errorf("Decisions() = %d decisions, want %d", len(got), decisionSample)
+	}
+}
+
+func TestTrain(t *testing.T) {
+	// The user archives emails from the same sender whatever their subject
+	// and body, and leaves out those from other senders
+	var bySender []Decision
+	for i := 0; i < 20; i++ {
+		subject := float64(i%5) / 5
+		bySender = append(bySender,
+			Decision{Subject: subject, Sender: 0.95, Body: 0.3, Accepted: true},
+			Decision{Subject: subject, Sender: 0.2, Body: 0.3, Accepted: false},
+		)
+	}
+
+	tests := []struct {
+		name      string
+		decisions []Decision
+		check     func(Weights) bool
+		wantErr   error
+	}{
+		{
+			name:      "too few",
+			decisions: bySender[:MinDecisions-1],
+			wantErr:   ErrNotEnoughDecisions,
+		},
+		{
+			name:      "only accepted",
+			decisions: filter(bySender, true),
+			wantErr:   ErrNotEnoughDecisions,
+		},
+		{
+			name:      "sender decides",
+			decisions: bySender,
+			check:     func(w Weights) bool { return w.Sender > 0.6 && w.Sender > w.Subject && w.Sender > w.Body },
+		},
+		{
+			name: "unbalanced",
+			// Many more accepted than rejected decisions still learn the
+			// sender
+			decisions: append(append([]Decision(nil), bySender[:2]...), filter(bySender, true)...),
+			check:     func(w Weights) bool { return w.Sender > w.Subject && w.Sender > w.Body },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Train(tt.decisions)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Train() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Train() error = %v", err)
+			}
+			if err := got.Validate(); err != nil {
+				t.Errorf("Train() = %+v, invalid: %v", got, err)
+			}
+			if sum := got.Subject + got.Sender + got.Body; sum < 0.999 || sum > 1.001 {
+				t.Errorf("Train() = %+v, sums to %v, want 1", got, sum)
+			}
+			if !tt.check(got) {
+				t.Errorf("Train() = %+v", got)
+			}
+
+			again, _ := Train(tt.decisions)
+			if again != got {
+				t.Errorf("Train() = %+v, then %+v, want the same", got, again)
+			}
+		})
+	}
+}
+
+func TestTrain_SeparatesAtThreshold(t *testing.T) {
+	// At a 60% threshold the deals of other stores are grouped with those
+	// of the user's shop, which the user leaves out when archiving
+	const threshold = 0.6
+	items := []string{"shoes", "jackets", "garden tools", "kitchen knives", "board games", "headphones", "running gear", "desk lamps", "winter coats", "camping stoves"}
+	var accepted, rejected []jmap.Email
+	for i, item := range items {
+		subject, preview := "This week only: "+item, "New offers on "+item+" picked for you"
+		accepted = append(accepted, jmap.Email{ID: fmt.Sprint("a", i), Subject: subject, From: []jmap.EmailAddress{{Email: "deals@shop.example"}}, Preview: preview})
+		rejected = append(rejected, jmap.Email{ID: fmt.Sprint("r", i), Subject: subject, From: []jmap.EmailAddress{{Email: fmt.Sprintf("promo@store%d.example", i)}}, Preview: preview})
+	}
+	decisions := Decisions(accepted, rejected, Options{})
+
+	separates := func(w Weights) bool {
+		for _, d := range decisions {
+			score := w.Subject*d.Subject + w.Sender*d.Sender + w.Body*d.Body
+			if (score >= threshold) != d.Accepted {
+				return false
+			}
+		}
+		return true
+	}
+	if separates(DefaultWeights) {
+		t.Fatal("the default weights already separate the decisions, nothing to learn")
+	}
+
+	learned, err := Train(decisions)
+	if err != nil {
+		t.Fatalf("Train() error = %v", err)
+	}
+	if !separates(learned) {
+		t.Errorf("Train() = %+v, does not separate accepted from rejected members at %v", learned, threshold)
+	}
+}
+
+func filter(decisions []Decision, accepted bool) []Decision {
+	var kept []Decision
+	for _, d := range decisions {
+		if d.Accepted == accepted {
+			kept = append(kept, d)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,95 @@
+package similarity
+
+import (
+	"fmt"
+	"mailboxzero/internal/jmap"
+	"strings"
+)
+
+// Mode is the lens emails are grouped through
+type Mode string
+
+const (
+	// ModeFuzzy groups emails by weighted subject, sender and body similarity
+	ModeFuzzy Mode = "fuzzy"
+	// ModeSender groups emails with the same From address
+	ModeSender Mode = "sender"
+	// ModeDomain groups emails whose From addresses share a domain
+	ModeDomain Mode = "domain"
+	// ModeList groups emails that came through the same mailing list
+	ModeList Mode = "list"
+	// ModeThread groups emails of the same thread
+	ModeThread Mode = "thread"
+)
+
+// Modes lists every grouping mode, fuzzy first
+var Modes = []Mode{ModeFuzzy, ModeSender, ModeDomain, ModeList, ModeThread}
+
+// ParseMode returns the mode with the given name. An empty name is fuzzy
+// matching, the default.
+func ParseMode(name string) (Mode, error) {
+	if name == "" {
+		return ModeFuzzy, nil
+	}
+	for _, mode := range Modes {
+		if string(mode) == name {
+			return mode, nil
+		}
+	}
+	return "", fmt.Errorf("unknown grouping mode %q", name)
+}
+
+// key returns what emails must share to be grouped under an exact mode. An
+// empty key keeps the email out of every group.
+func (m Mode) key(email jmap.Email) string {
+	switch m {
+	case ModeSender:
+		return senderAddress(email)
+	case ModeDomain:
+		address := senderAddress(email)
+		if i := strings.LastIndex(address, "@"); i >= 0 {
+			return address[i+1:]
+		}
+		return ""
+	case ModeList:
+		return email.ListIdentifier()
+	case ModeThread:
+		return email.ThreadID
+	}
+	return ""
+}
+
+func senderAddress(email jmap.Email) string {
+	if len(email.From) == 0 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(email.From[0].Email))
+}
+
+// groupByKey puts emails with the same key into one group, in order of first
+// appearance. Every member matches exactly, so groups have similarity 1.
+func groupByKey(emails []jmap.Email, mode Mode) []EmailGroup {
+	var keys []string
+	members := make(map[string][]jmap.Email)
+
+	for _, email := range emails {
+		key := mode.key(email)
+		if key == "" {
+			continue
+		}
+		if _, ok := members[key]; !ok {
+			keys = append(keys, key)
+		}
+		members[key] = append(members[key], email)
+	}
+
+	var groups []EmailGroup
+	for _, key := range keys {
+		if len(members[key]) > 1 {
+			group := newEmailGroup(members[key], 1.0)
+			group.Key = key
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
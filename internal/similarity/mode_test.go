@@ -0,0 +1,143 @@
+package similarity
+
+import (
+	"mailboxzero/internal/jmap"
+	"reflect"
+	"testing"
+)
+
+// modeEmails has emails that group differently under every mode
+func modeEmails() []jmap.Email {
+	from := func(address string) []jmap.EmailAddress {
+		return []jmap.EmailAddress{{Email: address}}
+	}
+	return []jmap.Email{
+		{ID: "o1", Subject: "Your order has shipped", From: from("orders@shop.example"), ThreadID: "t-order"},
+		{ID: "p1", Subject: "Spring sale", From: from("promo@shop.example"), ListID: "Deals <deals.shop.example>"},
+		{ID: "o2", Subject: "Your order was delivered", From: from("Orders@Shop.example"), ThreadID: "t-order"},
+		{ID: "p2", Subject: "Summer sale", From: from("bounce-1@news.shop.example"), ListID: "Deals <deals.shop.example>"},
+		{ID: "f1", Subject: "Lunch?", From: from("friend@mail.example"), ThreadID: "t-lunch"},
+		{ID: "n1", Subject: "No sender"},
+	}
+}
+
+func groupIDs(groups []EmailGroup) [][]string {
+	var ids [][]string
+	for _, group := range groups {
+		var members []string
+		for _, email := range group.Emails {
+			members = append(members, email.ID)
+		}
+		ids = append(ids, members)
+	}
+	return ids
+}
+
+func TestFindEmailGroupsWith_Modes(t *testing.T) {
+	tests := []struct {
+		mode     Mode
+		want     [][]string
+		wantKeys []string
+	}{
+		{
+			mode:     ModeSender,
+			want:     [][]string{{"o1", "o2"}},
+			wantKeys: []string{"orders@shop.example"},
+		},
+		{
+			mode:     ModeDomain,
+			want:     [][]string{{"o1", "p1", "o2"}},
+			wantKeys: []string{"shop.example"},
+		},
+		{
+			mode:     ModeList,
+			want:     [][]string{{"p1", "p2"}},
+			wantKeys: []string{"deals.shop.example"},
+		},
+		{
+			mode:     ModeThread,
+			want:     [][]string{{"o1", "o2"}},
+			wantKeys: []string{"t-order"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			groups := FindEmailGroupsWith(modeEmails(), Options{Mode: tt.mode, Threshold: 0.99})
+			if got := groupIDs(groups); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("FindEmailGroupsWith(%s) = %v, want %v", tt.mode, got, tt.want)
+			}
+			for i, group := range groups {
+				if group.Key != tt.wantKeys[i] || group.Similarity != 1.0 || group.Size != len(tt.want[i]) {
+					t.Errorf("group %d = key %q, similarity %v, size %d", i, group.Key, group.Similarity, group.Size)
+				}
+			}
+		})
+	}
+}
+
+func TestFindEmailGroupsWith_Fuzzy(t *testing.T) {
+	emails := modeEmails()
+	fuzzy := FindEmailGroupsWith(emails, Options{Mode: ModeFuzzy, Threshold: 0.5})
+	if !reflect.DeepEqual(groupIDs(fuzzy), groupIDs(FindEmailGroups(emails, 0.5))) {
+		t.Error("FindEmailGroupsWith(fuzzy) should match FindEmailGroups")
+	}
+	for _, group := range fuzzy {
+		if group.Key != "" {
+			t.Errorf("fuzzy group key = %q, want none", group.Key)
+		}
+	}
+}
+
+func TestFindEmailGroupsWith_Ranking(t *testing.T) {
+	emails := append(modeEmails(), jmap.Email{
+		ID: "f2", From: []jmap.EmailAddress{{Email: "friend@mail.example"}},
+	}, jmap.Email{
+		ID: "f3", From: []jmap.EmailAddress{{Email: "friend@mail.example"}},
+	})
+
+	groups := FindEmailGroupsWith(emails, Options{Mode: ModeSender, Threshold: 0})
+	want := [][]string{{"f1", "f2", "f3"}, {"o1", "o2"}}
+	if got := groupIDs(groups); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindEmailGroupsWith(sender) = %v, want largest group first %v", got, want)
+	}
+}
+
+func TestFindSimilarToEmailWith_Modes(t *testing.T) {
+	emails := modeEmails()
+
+	got := FindSimilarToEmailWith(emails[0], emails, Options{Mode: ModeDomain, Threshold: 0.99})
+	if ids := groupIDs([]EmailGroup{{Emails: got}}); !reflect.DeepEqual(ids[0], []string{"o1", "p1", "o2"}) {
+		t.Errorf("FindSimilarToEmailWith(domain) = %v, want o1, p1, o2", ids[0])
+	}
+
+	// Without a list header the target matches nothing under the list mode
+	got = FindSimilarToEmailWith(emails[0], emails, Options{Mode: ModeList, Threshold: 0})
+	if len(got) != 1 || got[0].ID != "o1" {
+		t.Errorf("FindSimilarToEmailWith(list) = %d emails, want only the target", len(got))
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Mode
+		wantErr bool
+	}{
+		{name: "", want: ModeFuzzy},
+		{name: "fuzzy", want: ModeFuzzy},
+		{name: "sender", want: ModeSender},
+		{name: "domain", want: ModeDomain},
+		{name: "list", want: ModeList},
+		{name: "thread", want: ModeThread},
+		{name: "Sender", wantErr: true},
+		{name: "subject", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseMode(tt.name)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseMode(%q) = %q, %v, want %q, error %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
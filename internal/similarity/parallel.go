@@ -0,0 +1,65 @@
+package similarity
+
+import (
+	"mailboxzero/internal/jmap"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// minParallelScores is the fewest scores worth fanning out: for fewer,
+// starting the workers costs more than the scoring
+const minParallelScores = 16
+
+// workers returns how many goroutines may score at once
+func (o Options) workers() int {
+	if o.Workers > 0 {
+		return o.Workers
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// forEach calls fn for every index below n on at most workers goroutines and
+// returns once all calls are done. Calls must only write to their own index.
+func forEach(n, workers int, fn func(i int)) {
+	if workers > n {
+		workers = n
+	}
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+		return
+	}
+
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(next.Add(1) - 1)
+				if i >= n {
+					return
+				}
+				fn(i)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// scoreAll scores anchor against emails[j] for every j in others, in the
+// order of others
+func scoreAll(scorer Scorer, anchor jmap.Email, emails []jmap.Email, others []int, workers int) []float64 {
+	if len(others) < minParallelScores {
+		workers = 1
+	}
+
+	scores := make([]float64, len(others))
+	forEach(len(others), workers, func(k int) {
+		scores[k] = scorer.Score(anchor, emails[others[k]])
+	})
+	return scores
+}
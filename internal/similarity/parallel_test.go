@@ -0,0 +1,70 @@
+package similarity
+
+import (
+	"mailboxzero/internal/jmap"
+	"reflect"
+	"runtime"
+	"sync/atomic"
+	"testing"
+)
+
+func TestForEach(t *testing.T) {
+	for _, workers := range []int{1, 3, 16} {
+		for _, n := range []int{0, 1, 100} {
+			calls := make([]int32, n)
+			forEach(n, workers, func(i int) {
+				atomic.AddInt32(&calls[i], 1)
+			})
+			for i, c := range calls {
+				if c != 1 {
+					t.Errorf("forEach(%d, %d) called index %d %d times, want once", n, workers, i, c)
+				}
+			}
+		}
+	}
+}
+
+func TestOptions_Workers(t *testing.T) {
+	if got := (Options{}).workers(); got != runtime.GOMAXPROCS(0) {
+		t.Errorf("workers() = %d, want GOMAXPROCS %d", got, runtime.GOMAXPROCS(0))
+	}
+	if got := (Options{Workers: 3}).workers(); got != 3 {
+		t.Errorf("workers() = %d, want 3", got)
+	}
+}
+
+func TestFindEmailGroupsWith_Workers(t *testing.T) {
+	inboxes := map[string][]jmap.Email{
+		"exhaustive": append(syntheticInbox(60), scaledMockInbox(60)...),
+		"candidates": append(syntheticInbox(300), scaledMockInbox(exhaustiveLimit)...),
+	}
+
+	for name, emails := range inboxes {
+		t.Run(name, func(t *testing.T) {
+			want := FindEmailGroupsWith(emails, Options{Threshold: 0.75, Workers: 1})
+			if len(want) == 0 {
+				t.Fatal("FindEmailGroupsWith() found no groups")
+			}
+			for _, workers := range []int{2, 8} {
+				got := FindEmailGroupsWith(emails, Options{Threshold: 0.75, Workers: workers})
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("FindEmailGroupsWith() with %d workers differs from one worker", workers)
+				}
+			}
+		})
+	}
+}
+
+func TestFindSimilarToEmailWith_Workers(t *testing.T) {
+	emails := scaledMockInbox(200)
+	target := emails[0]
+
+	want := ExplainSimilarToEmail(target, emails, Options{Threshold: 0.75, Workers: 1})
+	if len(want) < 2 {
+		t.Fatalf("ExplainSimilarToEmail() = %d emails, want matches", len(want))
+	}
+	got := ExplainSimilarToEmail(target, emails, Options{Threshold: 0.75, Workers: 8})
+	if !reflect.DeepEqual(got, want) {
+		t.Error("ExplainSimilarToEmail() with 8 workers differs from one worker")
+	}
+}
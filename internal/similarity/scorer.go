@@ -0,0 +1,138 @@
+package similarity
+
+import (
+	"fmt"
+	"mailboxzero/internal/jmap"
+	"math"
+)
+
+// Scorer rates how similar two emails are, from 0 (nothing in common) to 1
+// (the same). Implementations must be symmetric and safe for concurrent use.
+type Scorer interface {
+	Score(email1, email2 jmap.Email) float64
+}
+
+// Weights is how much each feature contributes to the similarity of two
+// emails. Only the ratios matter: weights are scaled to sum to 1.
+type Weights struct {
+	Subject float64 `json:"subject" yaml:"subject"`
+	Sender  float64 `json:"sender" yaml:"sender"`
+	Body    float64 `json:"body" yaml:"body"`
+}
+
+// DefaultWeights favour subject and sender over the body, which often
+// differs in details even between emails of the same kind
+var DefaultWeights = Weights{Subject: 0.4, Sender: 0.4, Body: 0.2}
+
+// Validate reports weights that cannot be used: negative or non-finite
+// weights, or all weights zero
+func (w Weights) Validate() error {
+	features := []struct {
+		name   string
+		weight float64
+	}{
+		{"subject", w.Subject},
+		{"sender", w.Sender},
+		{"body", w.Body},
+	}
+
+	for _, f := range features {
+		if math.IsNaN(f.weight) || math.IsInf(f.weight, 0) {
+			return fmt.Errorf("%s weight must be a finite number", f.name)
+		}
+		if f.weight < 0 {
+			return fmt.Errorf("%s weight must not be negative, got %v", f.name, f.weight)
+		}
+	}
+
+	if w.Subject+w.Sender+w.Body == 0 {
+		return fmt.Errorf("at least one weight must be positive")
+	}
+	return nil
+}
+
+// normalized scales the weights to sum to 1
+func (w Weights) normalized() Weights {
+	total := w.Subject + w.Sender + w.Body
+	return Weights{
+		Subject: w.Subject / total,
+		Sender:  w.Sender / total,
+		Body:    w.Body / total,
+	}
+}
+
+// LevenshteinScorer compares subject, sender and body by edit distance and
+// combines them with configurable weights. Emails from the same mailing
+// list count as the same sender. Bodies can be compared by TF-IDF instead,
+// see WithTFIDF.
+type LevenshteinScorer struct {
+	weights Weights
+	tfidf   *TFIDF
+}
+
+// NewLevenshteinScorer creates a scorer with the given weights
+func NewLevenshteinScorer(weights Weights) (*LevenshteinScorer, error) {
+	if err := weights.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid weights: %w", err)
+	}
+	return &LevenshteinScorer{weights: weights.normalized()}, nil
+}
+
+var defaultScorer = &LevenshteinScorer{weights: DefaultWeights.normalized()}
+
+// DefaultScorer returns the Levenshtein scorer with the default weights
+func DefaultScorer() Scorer {
+	return defaultScorer
+}
+
+// Weights returns the weights the scorer uses, scaled to sum to 1
+func (s *LevenshteinScorer) Weights() Weights {
+	return s.weights
+}
+
+// WithTFIDF returns a copy of the scorer that compares bodies by their
+// cosine similarity under the model
+func (s *LevenshteinScorer) WithTFIDF(model *TFIDF) *LevenshteinScorer {
+	return &LevenshteinScorer{weights: s.weights, tfidf: model}
+}
+
+func (s *LevenshteinScorer) Score(email1, email2 jmap.Email) float64 {
+	subject, sender, body := s.features(email1, email2)
+	return subject.Score*subject.Weight + sender.Score*sender.Weight + body.Score*body.Weight
+}
+
+// Explain scores subject, sender and body separately and combines them
+func (s *LevenshteinScorer) Explain(email1, email2 jmap.Email) Breakdown {
+	subject, sender, body := s.features(email1, email2)
+	return newBreakdown(subject, sender, body)
+}
+
+func (s *LevenshteinScorer) features(email1, email2 jmap.Email) (subject, sender, body FeatureScore) {
+	subject = FeatureScore{Name: FeatureSubject, Weight: s.weights.Subject}
+	subject.Score, subject.Bonus = stringSimilarityWithBonus(email1.Subject, email2.Subject)
+
+	sender = FeatureScore{Name: FeatureSender, Weight: s.weights.Sender}
+	if list := email1.ListIdentifier(); list != "" && list == email2.ListIdentifier() {
+		// The same list is the same sender, even when the From address
+		// varies per message
+		sender.Score = 1.0
+		sender.Note = "same mailing list"
+	} else if len(email1.From) > 0 && len(email2.From) > 0 {
+		sender.Score, sender.Bonus = stringSimilarityWithBonus(email1.From[0].Email, email2.From[0].Email)
+	}
+
+	body = FeatureScore{Name: FeatureBody, Weight: s.weights.Body}
+	body1 := extractEmailBody(email1)
+	body2 := extractEmailBody(email2)
+	switch {
+	case body1 == "" || body2 == "":
+		body.Note = "no body to compare"
+	case s.tfidf != nil:
+		body.Score = s.tfidf.Similarity(email1, email2)
+		body.Note = "TF-IDF cosine similarity"
+	default:
+		body.Score, body.Bonus = stringSimilarityWithBonus(body1, body2)
+	}
+
+	return subject, sender, body
+}
@@ -0,0 +1,97 @@
+package similarity
+
+import (
+	"mailboxzero/internal/jmap"
+	"math"
+	"testing"
+)
+
+func TestWeights_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights Weights
+		wantErr bool
+	}{
+		{name: "defaults", weights: DefaultWeights},
+		{name: "single feature", weights: Weights{Sender: 1}},
+		{name: "unnormalized", weights: Weights{Subject: 2, Sender: 2, Body: 1}},
+		{name: "all zero", weights: Weights{}, wantErr: true},
+		{name: "negative", weights: Weights{Subject: 1, Body: -0.1}, wantErr: true},
+		{name: "NaN", weights: Weights{Subject: math.NaN(), Sender: 1}, wantErr: true},
+		{name: "infinite", weights: Weights{Sender: math.Inf(1)}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.weights.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			_, err = NewLevenshteinScorer(tt.weights)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewLevenshteinScorer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewLevenshteinScorer_Normalizes(t *testing.T) {
+	scorer, err := NewLevenshteinScorer(Weights{Subject: 2, Sender: 2, Body: 1})
+	if err != nil {
+		t.Fatalf("NewLevenshteinScorer() unexpected error = %v", err)
+	}
+
+	want := Weights{Subject: 0.4, Sender: 0.4, Body: 0.2}
+	got := scorer.Weights()
+	if math.Abs(got.Subject-want.Subject) > 1e-9 || math.Abs(got.Sender-want.Sender) > 1e-9 || math.Abs(got.Body-want.Body) > 1e-9 {
+		t.Errorf("Weights() = %+v, want %+v", got, want)
+	}
+}
+
+func TestLevenshteinScorer_Weights(t *testing.T) {
+	// Same sender, unrelated subjects and bodies: a receipt and a newsletter
+	// from one shop
+	email1 := jmap.Email{
+		Subject: "Your receipt",
+		From:    []jmap.EmailAddress{{Email: "hello@shop.example"}},
+		Preview: "Thanks for your order",
+	}
+	email2 := jmap.Email{
+		Subject: "Spring collection is here",
+		From:    []jmap.EmailAddress{{Email: "hello@shop.example"}},
+		Preview: "New arrivals this week",
+	}
+
+	senderOnly, _ := NewLevenshteinScorer(Weights{Sender: 1})
+	subjectOnly, _ := NewLevenshteinScorer(Weights{Subject: 1})
+
+	if got := senderOnly.Score(email1, email2); got != 1.0 {
+		t.Errorf("sender-only Score() = %v, want 1", got)
+	}
+	if got := subjectOnly.Score(email1, email2); got >= 0.5 {
+		t.Errorf("subject-only Score() = %v, want low for unrelated subjects", got)
+	}
+
+	defaults, _ := NewLevenshteinScorer(DefaultWeights)
+	if got, want := defaults.Score(email1, email2), DefaultScorer().Score(email1, email2); got != want {
+		t.Errorf("Score() with DefaultWeights = %v, want DefaultScorer() %v", got, want)
+	}
+}
+
+func TestFindEmailGroupsWith_Scorer(t *testing.T) {
+	emails := []jmap.Email{
+		{ID: "1", Subject: "Your receipt", From: []jmap.EmailAddress{{Email: "hello@shop.example"}}},
+		{ID: "2", Subject: "Spring collection", From: []jmap.EmailAddress{{Email: "hello@shop.example"}}},
+	}
+
+	if groups := FindEmailGroupsWith(emails, Options{Threshold: 0.9}); len(groups) != 0 {
+		t.Errorf("default scorer found %d groups, want none", len(groups))
+	}
+
+	senderOnly, _ := NewLevenshteinScorer(Weights{Sender: 1})
+	groups := FindEmailGroupsWith(emails, Options{Threshold: 0.9, Scorer: senderOnly})
+	if len(groups) != 1 || groups[0].Size != 2 {
+		t.Errorf("sender-only scorer found %d groups, want one with both emails", len(groups))
+	}
+}
@@ -1,58 +1,185 @@
 package similarity
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
+	"mailboxzero/internal/htmltext"
 	"mailboxzero/internal/jmap"
 	"sort"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
+// EmailGroup is a cluster of similar emails. ID is derived from the member
+// email IDs so the same cluster gets the same ID across scans.
 type EmailGroup struct {
-	Emails     []jmap.Email
-	Similarity float64
+	ID         string       `json:"id"`
+	Emails     []jmap.Email `json:"emails"`
+	Similarity float64      `json:"similarity"`
+	Size       int          `json:"size"`
+	Subject    string       `json:"subject"`
+	Sender     string       `json:"sender"`
+	// Template is the subject most members share with numbers, dates and
+	// other variable parts replaced by placeholders
+	Template string `json:"template"`
+	// ListID is the mailing list all members came through, if they share one
+	ListID string `json:"listId,omitempty"`
+	// Bulk is set when every member is newsletter or other bulk traffic
+	Bulk bool `json:"bulk"`
+	// Key is what every member shares under an exact grouping mode, e.g.
+	// the sender domain
+	Key string `json:"key,omitempty"`
+	// Scores explains, by member ID, how each member compares to the first,
+	// or under connected and average clustering to its most similar member
+	Scores map[string]*Breakdown `json:"scores,omitempty"`
+}
+
+// Options control how emails are grouped. The zero value groups by fuzzy
+// similarity with the default scorer, greedy clustering and a threshold of 0.
+type Options struct {
+	Mode      Mode
+	Threshold float64
+	// Clustering turns similar pairs into groups; empty is greedy
+	Clustering Clustering
+	// Body is how bodies are compared; empty is Levenshtein. TF-IDF is
+	// fitted to the emails being grouped and needs a LevenshteinScorer.
+	Body BodyScoring
+	// Scorer rates fuzzy similarity; nil uses DefaultScorer
+	Scorer Scorer
+	// Workers is how many goroutines score emails at once; 0 uses
+	// GOMAXPROCS. The results do not depend on it.
+	Workers int
+}
+
+func (o Options) scorer() Scorer {
+	if o.Scorer == nil {
+		return DefaultScorer()
+	}
+	return o.Scorer
+}
+
+// fit returns the options with the scorer ready to compare the emails: with
+// TF-IDF body scoring, bodies are weighed against the emails' vocabulary
+func (o Options) fit(emails []jmap.Email) Options {
+	if o.Body != BodyTFIDF {
+		return o
+	}
+	if scorer, ok := o.scorer().(*LevenshteinScorer); ok && scorer.tfidf == nil {
+		o.Scorer = scorer.WithTFIDF(NewTFIDF(emails))
+	}
+	return o
 }
 
 func FindSimilarEmails(emails []jmap.Email, threshold float64) []jmap.Email {
-	if len(emails) == 0 {
+	return FindSimilarEmailsWith(emails, Options{Threshold: threshold})
+}
+
+// FindSimilarEmailsWith returns the largest group found with the given options
+func FindSimilarEmailsWith(emails []jmap.Email, opts Options) []jmap.Email {
+	groups := FindEmailGroupsWith(emails, opts)
+
+	if len(groups) == 0 {
 		return nil
 	}
 
-	groups := groupSimilarEmails(emails, threshold)
+	return groups[0].Emails
+}
+
+// FindEmailGroups returns every cluster of similar emails, ranked by size and
+// then by average similarity.
+func FindEmailGroups(emails []jmap.Email, threshold float64) []EmailGroup {
+	return FindEmailGroupsWith(emails, Options{Threshold: threshold})
+}
 
-	if len(groups) == 0 {
+// FindEmailGroupsWith returns every group found with the given options,
+// ranked like FindEmailGroups. The threshold, scorer and clustering only
+// apply to fuzzy matching.
+func FindEmailGroupsWith(emails []jmap.Email, opts Options) []EmailGroup {
+	if len(emails) == 0 {
 		return nil
 	}
 
-	sort.Slice(groups, func(i, j int) bool {
-		return len(groups[i].Emails) > len(groups[j].Emails)
+	opts = opts.fit(emails)
+	scorer := opts.scorer()
+	workers := opts.workers()
+
+	var groups []EmailGroup
+	clustering := opts.Clustering
+	switch {
+	case opts.Mode != ModeFuzzy && opts.Mode != "":
+		groups = groupByKey(emails, opts.Mode)
+		clustering = ClusterGreedy
+	case opts.Clustering == ClusterConnected:
+		groups = clusterConnected(emails, opts.Threshold, scorer, workers)
+	case opts.Clustering == ClusterAverage:
+		groups = clusterAverage(emails, opts.Threshold, scorer, workers)
+	default:
+		groups = groupSimilarEmails(emails, opts.Threshold, scorer, workers)
+	}
+	forEach(len(groups), workers, func(i int) {
+		explainGroup(&groups[i], scorer, clustering)
+	})
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		if len(groups[i].Emails) != len(groups[j].Emails) {
+			return len(groups[i].Emails) > len(groups[j].Emails)
+		}
+		return groups[i].Similarity > groups[j].Similarity
 	})
 
-	return groups[0].Emails
+	return groups
 }
 
 func FindSimilarToEmail(targetEmail jmap.Email, emails []jmap.Email, threshold float64) []jmap.Email {
+	return FindSimilarToEmailWith(targetEmail, emails, Options{Threshold: threshold})
+}
+
+// FindSimilarToEmailWith returns the target followed by the emails that would
+// be grouped with it under the given options
+func FindSimilarToEmailWith(targetEmail jmap.Email, emails []jmap.Email, opts Options) []jmap.Email {
+	opts = opts.fit(emails)
 	var similarEmails []jmap.Email
 
 	// Always include the target email itself as the first result
 	similarEmails = append(similarEmails, targetEmail)
 
-	for _, email := range emails {
-		if email.ID == targetEmail.ID {
-			continue
+	var others []int
+	for i, email := range emails {
+		if email.ID != targetEmail.ID {
+			others = append(others, i)
 		}
+	}
+
+	if opts.Mode != ModeFuzzy && opts.Mode != "" {
+		key := opts.Mode.key(targetEmail)
+		for _, i := range others {
+			if key != "" && key == opts.Mode.key(emails[i]) {
+				similarEmails = append(similarEmails, emails[i])
+			}
+		}
+		return similarEmails
+	}
 
-		similarity := calculateEmailSimilarity(targetEmail, email)
-		if similarity >= threshold {
-			similarEmails = append(similarEmails, email)
+	scores := scoreAll(opts.scorer(), targetEmail, emails, others, opts.workers())
+	for k, i := range others {
+		if scores[k] >= opts.Threshold {
+			similarEmails = append(similarEmails, emails[i])
 		}
 	}
 
 	return similarEmails
 }
 
-func groupSimilarEmails(emails []jmap.Email, threshold float64) []EmailGroup {
-	var groups []EmailGroup
+// groupSimilarEmails groups every email with the later ones that score at
+// least threshold against it. Large inboxes only score candidate pairs.
+// Scores only depend on the pair, so each email's comparisons are spread
+// over the workers and applied in order afterwards.
+func groupSimilarEmails(emails []jmap.Email, threshold float64, scorer Scorer, workers int) []EmailGroup {
+	var members [][]jmap.Email
 	processed := make(map[string]bool)
+	index := newCandidateIndex(emails, threshold, scorer)
+	done := func(j int) bool { return processed[emails[j].ID] }
 
 	for i, email1 := range emails {
 		if processed[email1.ID] {
@@ -63,62 +190,102 @@ func groupSimilarEmails(emails []jmap.Email, threshold float64) []EmailGroup {
 		group = append(group, email1)
 		processed[email1.ID] = true
 
-		for j := i + 1; j < len(emails); j++ {
+		var others []int
+		if index == nil {
+			for j := i + 1; j < len(emails); j++ {
+				if !done(j) {
+					others = append(others, j)
+				}
+			}
+		} else {
+			others = index.candidates(i, done)
+		}
+
+		scores := scoreAll(scorer, email1, emails, others, workers)
+		for k, j := range others {
 			email2 := emails[j]
 			if processed[email2.ID] {
 				continue
 			}
 
-			similarity := calculateEmailSimilarity(email1, email2)
-			if similarity >= threshold {
+			if scores[k] >= threshold {
 				group = append(group, email2)
 				processed[email2.ID] = true
 			}
 		}
 
 		if len(group) > 1 {
-			avgSimilarity := calculateGroupSimilarity(group)
-			groups = append(groups, EmailGroup{
-				Emails:     group,
-				Similarity: avgSimilarity,
-			})
+			members = append(members, group)
 		}
 	}
 
+	groups := make([]EmailGroup, len(members))
+	forEach(len(members), workers, func(k int) {
+		groups[k] = newEmailGroup(members[k], calculateGroupSimilarity(members[k], scorer))
+	})
 	return groups
 }
 
-func calculateEmailSimilarity(email1, email2 jmap.Email) float64 {
-	subjectSim := stringSimilarity(email1.Subject, email2.Subject)
+func newEmailGroup(emails []jmap.Email, similarity float64) EmailGroup {
+	group := EmailGroup{
+		ID:         groupID(emails),
+		Emails:     emails,
+		Similarity: similarity,
+		Size:       len(emails),
+		Subject:    emails[0].Subject,
+		Template:   groupTemplate(emails),
+	}
 
-	var senderSim float64
-	if len(email1.From) > 0 && len(email2.From) > 0 {
-		senderSim = stringSimilarity(email1.From[0].Email, email2.From[0].Email)
+	if len(emails[0].From) > 0 {
+		group.Sender = emails[0].From[0].Email
 	}
 
-	var bodySim float64
-	body1 := extractEmailBody(email1)
-	body2 := extractEmailBody(email2)
-	if body1 != "" && body2 != "" {
-		bodySim = stringSimilarity(body1, body2)
+	group.ListID = emails[0].ListIdentifier()
+	group.Bulk = true
+	for _, email := range emails {
+		if email.ListIdentifier() != group.ListID {
+			group.ListID = ""
+		}
+		if !email.IsBulk() {
+			group.Bulk = false
+		}
 	}
 
-	weightedSimilarity := (subjectSim*0.4 + senderSim*0.4 + bodySim*0.2)
+	return group
+}
+
+// groupID hashes the sorted member IDs so the ID does not depend on the order
+// in which the inbox was scanned.
+func groupID(emails []jmap.Email) string {
+	ids := make([]string, len(emails))
+	for i, email := range emails {
+		ids[i] = email.ID
+	}
+	sort.Strings(ids)
 
-	return weightedSimilarity
+	sum := sha1.Sum([]byte(strings.Join(ids, "\x00")))
+	return "g-" + hex.EncodeToString(sum[:6])
 }
 
-func calculateGroupSimilarity(emails []jmap.Email) float64 {
+// groupSimilaritySample is the number of members whose pairs are averaged
+// for the similarity of a group, so groups are not scored all over again
+const groupSimilaritySample = 10
+
+// calculateGroupSimilarity is the average similarity of the pairs in the
+// group, estimated from evenly spaced members in large groups
+func calculateGroupSimilarity(emails []jmap.Email, scorer Scorer) float64 {
 	if len(emails) <= 1 {
 		return 0.0
 	}
 
+	emails = spread(emails, groupSimilaritySample)
+
 	var totalSimilarity float64
 	var count int
 
 	for i := 0; i < len(emails); i++ {
 		for j := i + 1; j < len(emails); j++ {
-			similarity := calculateEmailSimilarity(emails[i], emails[j])
+			similarity := scorer.Score(emails[i], emails[j])
 			totalSimilarity += similarity
 			count++
 		}
@@ -132,50 +299,87 @@ func calculateGroupSimilarity(emails []jmap.Email) float64 {
 }
 
 func stringSimilarity(s1, s2 string) float64 {
+	similarity, _ := stringSimilarityWithBonus(s1, s2)
+	return similarity
+}
+
+// commonWordsBonus is added to the similarity of strings sharing at least two
+// words, capped so the result stays at most 1
+const commonWordsBonus = 0.1
+
+// stringSimilarityWithBonus returns the similarity of two strings and how much
+// of it is the common-words bonus
+func stringSimilarityWithBonus(s1, s2 string) (similarity, bonus float64) {
 	s1 = normalizeString(s1)
 	s2 = normalizeString(s2)
 
 	if s1 == s2 {
-		return 1.0
+		return 1.0, 0
 	}
 
 	if s1 == "" || s2 == "" {
-		return 0.0
+		return 0.0, 0
 	}
 
 	distance := levenshteinDistance(s1, s2)
-	maxLen := max(len(s1), len(s2))
+	maxLen := max(utf8.RuneCountInString(s1), utf8.RuneCountInString(s2))
 
 	if maxLen == 0 {
-		return 1.0
+		return 1.0, 0
 	}
 
-	similarity := 1.0 - (float64(distance) / float64(maxLen))
+	similarity = 1.0 - (float64(distance) / float64(maxLen))
 
 	if containsCommonWords(s1, s2) {
-		similarity += 0.1
-	}
-
-	if similarity > 1.0 {
-		similarity = 1.0
+		bonus = commonWordsBonus
+		if similarity+bonus > 1.0 {
+			bonus = 1.0 - similarity
+		}
+		similarity += bonus
 	}
 
-	return similarity
+	return similarity, bonus
 }
 
+// normalizeString folds s to the words that tell emails apart: compatibility
+// characters are replaced as NFKC does, numbers and dates templated, letters
+// case folded and stripped of diacritics, and emoji, symbols and punctuation
+// other than the placeholders turned into single spaces
 func normalizeString(s string) string {
-	s = strings.ToLower(s)
+	s = foldCase(Template(foldCompatible(s)))
 
 	var result strings.Builder
-	for _, r := range s {
-		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsSpace(r) {
+	gap, inWord := false, false
+	separate := func() {
+		if gap && result.Len() > 0 {
+			result.WriteByte(' ')
+		}
+		gap = false
+	}
+	for i := 0; i < len(s); {
+		if p := placeholderAt(s[i:]); p != "" {
+			separate()
+			result.WriteString(p)
+			i += len(p)
+			inWord = false
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		switch {
+		case isWordRune(r):
+			separate()
 			result.WriteRune(r)
-		} else {
-			result.WriteRune(' ')
+			inWord = true
+		case inWord && unicode.Is(unicode.M, r):
+			result.WriteRune(r)
+		default:
+			gap, inWord = true, false
 		}
 	}
 
-	return strings.TrimSpace(result.String())
+	return result.String()
 }
 
 func containsCommonWords(s1, s2 string) bool {
@@ -184,7 +388,7 @@ func containsCommonWords(s1, s2 string) bool {
 
 	commonWords := 0
 	for _, word1 := range words1 {
-		if len(word1) < 3 {
+		if utf8.RuneCountInString(word1) < 3 {
 			continue
 		}
 		for _, word2 := range words2 {
@@ -200,6 +404,16 @@ func containsCommonWords(s1, s2 string) bool {
 
 func levenshteinDistance(s1, s2 string) int {
 	r1, r2 := []rune(s1), []rune(s2)
+
+	// Emails of a template differ in a few places, so skip the common start
+	// and end, which do not change the distance
+	for len(r1) > 0 && len(r2) > 0 && r1[0] == r2[0] {
+		r1, r2 = r1[1:], r2[1:]
+	}
+	for len(r1) > 0 && len(r2) > 0 && r1[len(r1)-1] == r2[len(r2)-1] {
+		r1, r2 = r1[:len(r1)-1], r2[:len(r2)-1]
+	}
+
 	column := make([]int, len(r1)+1)
 
 	for y := 1; y <= len(r1); y++ {
@@ -224,18 +438,55 @@ func levenshteinDistance(s1, s2 string) int {
 	return column[len(r1)]
 }
 
-func extractEmailBody(email jmap.Email) string {
-	if email.Preview != "" {
-		return email.Preview
+// shownText is the plain text of the email's body, or its preview if no body
+// values were fetched
+func shownText(email jmap.Email) string {
+	if text := email.PlainText(); text != "" {
+		return text
 	}
+	return email.Preview
+}
+
+// emailText is the text of the email that is compared: its shown text
+// without links, which are mostly tracking URLs that differ in every email
+func emailText(email jmap.Email) string {
+	return htmltext.StripLinks(shownText(email))
+}
+
+// bodyCompareLength is how many characters of a body are compared by edit
+// distance, which takes time quadratic in the length. It is the length of
+// JMAP previews.
+const bodyCompareLength = 256
+
+// bodyScanLength is how many bytes of the shown text are searched for links
+// to find the characters compared, as every pair of emails compared does so
+const bodyScanLength = 4 * bodyCompareLength
 
-	for _, bodyValue := range email.BodyValues {
-		if bodyValue.Value != "" {
-			return normalizeString(bodyValue.Value)
+// extractEmailBody is the start of the email's text compared by edit distance
+func extractEmailBody(email jmap.Email) string {
+	text := shownText(email)
+	if len(text) > bodyScanLength {
+		end := bodyScanLength
+		for end > 0 && !utf8.RuneStart(text[end]) {
+			end--
 		}
+		text = text[:end]
+	}
+	if htmltext.HasLinks(text) {
+		text = htmltext.StripLinks(text)
+	}
+	if len(text) <= bodyCompareLength {
+		return text
 	}
 
-	return ""
+	count := 0
+	for i := range text {
+		if count == bodyCompareLength {
+			return text[:i]
+		}
+		count++
+	}
+	return text
 }
 
 func min(a, b, c int) int {
@@ -1,7 +1,11 @@
 package similarity
 
 import (
+	"context"
+	"fmt"
 	"mailboxzero/internal/jmap"
+	"math/rand"
+	"runtime"
 	"strings"
 	"testing"
 	"time"
@@ -82,17 +86,27 @@ func TestNormalizeString(t *testing.T) {
 		{
 			name:  "punctuation removal",
 			input: "Hello, World!",
-			want:  "hello  world", // Punctuation becomes spaces, not collapsed
+			want:  "hello world", // Punctuation becomes a space
 		},
 		{
 			name:  "multiple spaces",
 			input: "Hello    World",
-			want:  "hello    world", // Multiple spaces preserved
+			want:  "hello world", // Runs of spaces are collapsed
 		},
 		{
 			name:  "special characters",
 			input: "Hello@World#2023",
-			want:  "hello world 2023",
+			want:  "hello world <n>",
+		},
+		{
+			name:  "templated",
+			input: "Your order #83921 of $12.99 ships 2026-09-15",
+			want:  "your order <n> of <amount> ships <date>",
+		},
+		{
+			name:  "already normalized",
+			input: "your order <n> has shipped",
+			want:  "your order <n> has shipped",
 		},
 		{
 			name:  "empty string",
@@ -275,9 +289,9 @@ func TestCalculateEmailSimilarity(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := calculateEmailSimilarity(tt.email1, tt.email2)
+			got := DefaultScorer().Score(tt.email1, tt.email2)
 			if got < tt.wantRange[0] || got > tt.wantRange[1] {
-				t.Errorf("calculateEmailSimilarity() = %v, want between %v and %v",
+				t.Errorf("DefaultScorer().Score() = %v, want between %v and %v",
 					got, tt.wantRange[0], tt.wantRange[1])
 			}
 		})
@@ -305,7 +319,7 @@ func TestExtractEmailBody(t *testing.T) {
 					"1": {Value: "Test body content"},
 				},
 			},
-			want: "test body content",
+			want: "Test body content",
 		},
 		{
 			name: "both preview and body values",
@@ -315,7 +329,41 @@ func TestExtractEmailBody(t *testing.T) {
 					"1": {Value: "Test body content"},
 				},
 			},
-			want: "Test preview", // Preview takes precedence
+			want: "Test body content", // The full body takes precedence
+		},
+		{
+			name: "html body",
+			email: jmap.Email{
+				Preview: "Test preview",
+				BodyValues: map[string]jmap.BodyValue{
+					"1": {Value: "<p>Test <a href=\"https://t.example/c\">body</a></p><img src=\"https://t.example/o\" width=\"1\">"},
+				},
+				HTMLBody: []jmap.BodyPart{{PartID: "1", Type: "text/html"}},
+			},
+			want: "Test body",
+		},
+		{
+			name: "long body",
+			email: jmap.Email{
+				BodyValues: map[string]jmap.BodyValue{
+					"1": {Value: strings.Repeat("é", bodyCompareLength+10)},
+				},
+			},
+			want: strings.Repeat("é", bodyCompareLength),
+		},
+		{
+			name: "links are not compared",
+			email: jmap.Email{
+				BodyValues: map[string]jmap.BodyValue{
+					"1": {Value: "Track your parcel at https://t.example/c?id=8812 today"},
+				},
+			},
+			want: "Track your parcel at today",
+		},
+		{
+			name:  "preview links are not compared",
+			email: jmap.Email{Preview: "Read online: <https://t.example/v/77> Weekly news"},
+			want:  "Read online: Weekly news",
 		},
 		{
 			name:  "no content",
@@ -541,7 +589,7 @@ func TestGroupSimilarEmails(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := groupSimilarEmails(tt.emails, tt.threshold)
+			got := groupSimilarEmails(tt.emails, tt.threshold, DefaultScorer(), 4)
 			if len(got) < tt.wantMinGroups {
 				t.Errorf("groupSimilarEmails() returned %d groups, want at least %d",
 					len(got), tt.wantMinGroups)
@@ -595,7 +643,7 @@ func TestCalculateGroupSimilarity(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := calculateGroupSimilarity(tt.emails)
+			got := calculateGroupSimilarity(tt.emails, DefaultScorer())
 			if got != tt.want {
 				t.Errorf("calculateGroupSimilarity() = %v, want %v", got, tt.want)
 			}
@@ -677,7 +725,132 @@ func BenchmarkCalculateEmailSimilarity(b *testing.B) {
 	}
 
 	for i := 0; i < b.N; i++ {
-		calculateEmailSimilarity(email1, email2)
+		DefaultScorer().Score(email1, email2)
+	}
+}
+
+// syntheticInbox returns n emails shaped like a real inbox: most come from
+// senders that mail the same kind of message over and over with changing
+// details, the rest are one-offs. The same n always gives the same emails.
+func syntheticInbox(n int) []jmap.Email {
+	rng := rand.New(rand.NewSource(1))
+	consonants, vowels := "bcdfghjklmnprstvwz", "aeiou"
+	word := func() string {
+		var w strings.Builder
+		for k := 2 + rng.Intn(3); k > 0; k-- {
+			w.WriteByte(consonants[rng.Intn(len(consonants))])
+			w.WriteByte(vowels[rng.Intn(len(vowels))])
+		}
+		return w.String()
+	}
+	phrase := func(k int) string {
+		words := make([]string, k)
+		for i := range words {
+			words[i] = word()
+		}
+		return strings.Join(words, " ")
+	}
+
+	// Every sender has a subject and body of its own, filled in with a
+	// different number and a few different words each time
+	type sender struct{ address, subject, body string }
+	senders := make([]sender, n/40+1)
+	for i := range senders {
+		senders[i] = sender{
+			address: fmt.Sprintf("news@%s.example", word()),
+			subject: phrase(3),
+			body:    phrase(8),
+		}
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	emails := make([]jmap.Email, n)
+	for i := range emails {
+		email := jmap.Email{
+			ID:         fmt.Sprintf("m%d", i),
+			ReceivedAt: start.Add(time.Duration(i) * time.Minute),
+		}
+		if rng.Intn(10) < 7 {
+			s := senders[rng.Intn(len(senders))]
+			email.From = []jmap.EmailAddress{{Email: s.address}}
+			email.Subject = fmt.Sprintf("%s #%d", s.subject, rng.Intn(10000))
+			email.Preview = fmt.Sprintf("%s %s", s.body, phrase(2))
+		} else {
+			email.From = []jmap.EmailAddress{{Email: fmt.Sprintf("%s%d@mail.example", word(), i)}}
+			email.Subject = phrase(4)
+			email.Preview = phrase(10)
+		}
+		emails[i] = email
+	}
+	return emails
+}
+
+// scaledMockInbox returns n emails made by repeating the mock client's
+// sample inbox, each copy with its own IDs and a day later than the last
+func scaledMockInbox(n int) []jmap.Email {
+	sample, err := jmap.NewMockClient().GetInboxEmails(context.Background(), 1000)
+	if err != nil {
+		panic(err)
+	}
+
+	emails := make([]jmap.Email, n)
+	for i := range emails {
+		round := i / len(sample)
+		email := sample[i%len(sample)]
+		email.ID = fmt.Sprintf("%s-%d", email.ID, round)
+		email.ReceivedAt = email.ReceivedAt.AddDate(0, 0, round)
+		emails[i] = email
+	}
+	return emails
+}
+
+// The worker benchmarks score the scaled mock inbox with one worker and with
+// GOMAXPROCS, e.g. go test -bench Workers -cpu 1,4,8
+func BenchmarkFindEmailGroups_Workers(b *testing.B) {
+	emails := scaledMockInbox(5000)
+	for _, workers := range []int{1, runtime.GOMAXPROCS(0)} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				FindEmailGroupsWith(emails, Options{Threshold: 0.75, Workers: workers})
+			}
+		})
+	}
+}
+
+func BenchmarkFindSimilarToEmail_Workers(b *testing.B) {
+	emails := scaledMockInbox(5000)
+	for _, workers := range []int{1, runtime.GOMAXPROCS(0)} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				FindSimilarToEmailWith(emails[0], emails, Options{Threshold: 0.75, Workers: workers})
+			}
+		})
+	}
+}
+
+func BenchmarkFindEmailGroups(b *testing.B) {
+	for _, n := range []int{1000, 5000, 10000, 50000} {
+		emails := syntheticInbox(n)
+		b.Run(fmt.Sprintf("emails=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				FindEmailGroups(emails, 0.75)
+			}
+		})
+	}
+}
+
+// BenchmarkFindEmailGroups_Exhaustive scores every pair, the baseline the
+// candidate generation is measured against. It takes over a minute at 5000
+// emails.
+func BenchmarkFindEmailGroups_Exhaustive(b *testing.B) {
+	scorer := struct{ Scorer }{DefaultScorer()}
+	for _, n := range []int{1000} {
+		emails := syntheticInbox(n)
+		b.Run(fmt.Sprintf("emails=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				FindEmailGroupsWith(emails, Options{Threshold: 0.75, Scorer: scorer})
+			}
+		})
 	}
 }
 
@@ -761,6 +934,101 @@ func TestFindSimilarEmails_NilInput(t *testing.T) {
 	}
 }
 
+func TestFindEmailGroups(t *testing.T) {
+	emails := []jmap.Email{
+		{ID: "a1", Subject: "Newsletter A", From: []jmap.EmailAddress{{Email: "a@example.com"}}},
+		{ID: "b1", Subject: "Receipt B", From: []jmap.EmailAddress{{Email: "b@example.com"}}},
+		{ID: "a2", Subject: "Newsletter A", From: []jmap.EmailAddress{{Email: "a@example.com"}}},
+		{ID: "b2", Subject: "Receipt B", From: []jmap.EmailAddress{{Email: "b@example.com"}}},
+		{ID: "a3", Subject: "Newsletter A", From: []jmap.EmailAddress{{Email: "a@example.com"}}},
+	}
+
+	groups := FindEmailGroups(emails, 0.8)
+	if len(groups) != 2 {
+		t.Fatalf("FindEmailGroups() returned %d groups, want 2", len(groups))
+	}
+
+	if groups[0].Size != 3 || len(groups[0].Emails) != 3 {
+		t.Errorf("FindEmailGroups() first group size = %d, want 3", groups[0].Size)
+	}
+	if groups[1].Size != 2 {
+		t.Errorf("FindEmailGroups() second group size = %d, want 2", groups[1].Size)
+	}
+
+	if groups[0].Subject != "Newsletter A" || groups[0].Sender != "a@example.com" {
+		t.Errorf("FindEmailGroups() first group representative = %q/%q", groups[0].Subject, groups[0].Sender)
+	}
+
+	if groups[0].ID == "" || groups[0].ID == groups[1].ID {
+		t.Errorf("FindEmailGroups() group IDs not unique: %q, %q", groups[0].ID, groups[1].ID)
+	}
+
+	// Reversing the input must not change the group IDs
+	reversed := make([]jmap.Email, len(emails))
+	for i, email := range emails {
+		reversed[len(emails)-1-i] = email
+	}
+	again := FindEmailGroups(reversed, 0.8)
+	if len(again) != 2 || again[0].ID != groups[0].ID || again[1].ID != groups[1].ID {
+		t.Errorf("FindEmailGroups() group IDs not stable across input order")
+	}
+
+	if got := FindEmailGroups(nil, 0.5); got != nil {
+		t.Errorf("FindEmailGroups(nil) = %v, want nil", got)
+	}
+}
+
+func TestCalculateEmailSimilarity_SameList(t *testing.T) {
+	email1 := jmap.Email{
+		ID:      "1",
+		Subject: "Issue 41",
+		From:    []jmap.EmailAddress{{Email: "bounce-8f2a@mail.example.com"}},
+		ListID:  "Example Weekly <weekly.example.com>",
+	}
+	email2 := jmap.Email{
+		ID:      "2",
+		Subject: "Issue 42",
+		From:    []jmap.EmailAddress{{Email: "bounce-1c9d@mail.example.com"}},
+		ListID:  "example weekly <Weekly.Example.com>",
+	}
+
+	withList := DefaultScorer().Score(email1, email2)
+
+	email1.ListID, email2.ListID = "", ""
+	withoutList := DefaultScorer().Score(email1, email2)
+
+	if withList <= withoutList {
+		t.Errorf("DefaultScorer().Score() with shared list = %v, want more than %v", withList, withoutList)
+	}
+}
+
+func TestFindEmailGroups_ListHeaders(t *testing.T) {
+	emails := []jmap.Email{
+		{ID: "n1", Subject: "Newsletter", From: []jmap.EmailAddress{{Email: "a@example.com"}}, ListID: "News <news.example.com>"},
+		{ID: "n2", Subject: "Newsletter", From: []jmap.EmailAddress{{Email: "a@example.com"}}, ListID: "News <news.example.com>"},
+		{ID: "r1", Subject: "Receipt", From: []jmap.EmailAddress{{Email: "b@example.com"}}, Precedence: "bulk"},
+		{ID: "r2", Subject: "Receipt", From: []jmap.EmailAddress{{Email: "b@example.com"}}},
+	}
+
+	groups := FindEmailGroups(emails, 0.8)
+	if len(groups) != 2 {
+		t.Fatalf("FindEmailGroups() returned %d groups, want 2", len(groups))
+	}
+
+	for _, group := range groups {
+		switch group.Subject {
+		case "Newsletter":
+			if group.ListID != "news.example.com" || !group.Bulk {
+				t.Errorf("newsletter group listId = %q, bulk = %v", group.ListID, group.Bulk)
+			}
+		case "Receipt":
+			if group.ListID != "" || group.Bulk {
+				t.Errorf("receipt group listId = %q, bulk = %v, want neither", group.ListID, group.Bulk)
+			}
+		}
+	}
+}
+
 func TestGroupSimilarEmails_SingleGroup(t *testing.T) {
 	// All emails very similar
 	emails := []jmap.Email{
@@ -784,7 +1052,7 @@ func TestGroupSimilarEmails_SingleGroup(t *testing.T) {
 		},
 	}
 
-	groups := groupSimilarEmails(emails, 0.8)
+	groups := groupSimilarEmails(emails, 0.8, DefaultScorer(), 4)
 
 	if len(groups) == 0 {
 		t.Error("groupSimilarEmails() should find at least one group")
@@ -812,11 +1080,11 @@ func TestCalculateEmailSimilarity_NoFrom(t *testing.T) {
 		Preview: "Content",
 	}
 
-	similarity := calculateEmailSimilarity(email1, email2)
+	similarity := DefaultScorer().Score(email1, email2)
 
 	// Should still calculate similarity based on subject and body
 	if similarity < 0.0 || similarity > 1.0 {
-		t.Errorf("calculateEmailSimilarity() = %v, want between 0.0 and 1.0", similarity)
+		t.Errorf("DefaultScorer().Score() = %v, want between 0.0 and 1.0", similarity)
 	}
 }
 
@@ -835,11 +1103,11 @@ func TestCalculateEmailSimilarity_NoBody(t *testing.T) {
 		Preview: "", // No preview
 	}
 
-	similarity := calculateEmailSimilarity(email1, email2)
+	similarity := DefaultScorer().Score(email1, email2)
 
 	// Should calculate based on subject and sender only (0.4 + 0.4 + 0.0)
 	if similarity < 0.7 || similarity > 0.9 {
-		t.Errorf("calculateEmailSimilarity() without body = %v, want ~0.8", similarity)
+		t.Errorf("DefaultScorer().Score() without body = %v, want ~0.8", similarity)
 	}
 }
 
@@ -862,7 +1130,7 @@ func TestCalculateGroupSimilarity_MultipleEmails(t *testing.T) {
 		},
 	}
 
-	similarity := calculateGroupSimilarity(emails)
+	similarity := calculateGroupSimilarity(emails, DefaultScorer())
 
 	// Should average all pairwise similarities
 	if similarity < 0.0 || similarity > 1.0 {
@@ -874,3 +1142,30 @@ func TestCalculateGroupSimilarity_MultipleEmails(t *testing.T) {
 		t.Errorf("calculateGroupSimilarity() for identical emails = %v, want > 0.7", similarity)
 	}
 }
+
+// countingScorer gives every pair the same score and counts the pairs scored
+type countingScorer struct {
+	score float64
+	calls int
+}
+
+func (c *countingScorer) Score(email1, email2 jmap.Email) float64 {
+	c.calls++
+	return c.score
+}
+
+func TestCalculateGroupSimilarity_LargeGroup(t *testing.T) {
+	scorer := &countingScorer{score: 0.8}
+
+	emails := make([]jmap.Email, 200)
+	for i := range emails {
+		emails[i] = jmap.Email{ID: fmt.Sprintf("m%d", i)}
+	}
+
+	if got := calculateGroupSimilarity(emails, scorer); got < 0.8-1e-9 || got > 0.8+1e-9 {
+		t.Errorf("calculateGroupSimilarity() = %v, want 0.8", got)
+	}
+	if want := groupSimilaritySample * (groupSimilaritySample - 1) / 2; scorer.calls != want {
+		t.Errorf("scored %d pairs, want %d from the sample", scorer.calls, want)
+	}
+}
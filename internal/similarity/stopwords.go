@@ -0,0 +1,68 @@
+package similarity
+
+import "strings"
+
+// stopWordLists are the most common words of the languages inboxes are
+// usually written in, which say nothing about what a body is about
+var stopWordLists = []struct {
+	language string
+	words    string
+}{
+	{"en", `a about above after again against all also am an and any are as at be because been before being
+		below between both but by can could did do does doing down during each few for from further had has
+		have having he her here hers herself him himself his how i if in into is it its itself just ll me
+		more most my myself no nor not now of off on once only or other our ours ourselves out over own re
+		same she should so some such than that the their theirs them themselves then there these they this
+		those through to too under until up ve very was we were what when where which while who whom why
+		will with would you your yours yourself yourselves`},
+	{"de", `aber alle allem allen aller alles als also am an andere anderen auch auf aus bei bin bis bist
+		da damit dann das dass dem den denn der des dich die dies diese diesem diesen dieser dir doch dort
+		du durch ein eine einem einen einer es für gegen hat hatte haben hier hin ich ihm ihn ihnen ihr
+		ihre im in ist ja jede jedem jeden jeder jetzt kann kein keine man mein meine mich mir mit muss
+		nach nicht noch nun nur ob oder ohne sehr sein seine sich sie sind so über um und uns unser unter
+		vom von vor war waren was weil wenn wer werden wie wieder wir wird zu zum zur`},
+	{"fr", `à au aux avec ce ces cette dans de des du elle elles en est et été être eu il ils je la le les
+		leur leurs lui ma mais me même mes moi mon ne nos notre nous on ont ou où par pas plus pour qu que
+		qui sa sans se ses si son sont sur ta te tes toi ton tu un une vos votre vous`},
+	{"es", `al algo algunos ante antes como con contra cual cuando de del desde donde durante el ella
+		ellas ellos en entre era es esa ese eso esta está estas este esto estos fue ha hay la las le les lo
+		los más me mi mis muy nada ni no nos nosotros o os otra otros para pero poco por porque que quien
+		se sea ser si sin sobre son su sus también te tiene todo todos tu tus un una uno unos usted y ya yo`},
+	{"fi", `ei eivät emme en et ette että he hän häntä hänen itse ja jo joka jos jotka kanssa koska kuin
+		kun me meidän mikä minä minun mitä mutta myös ne niin noin nyt ole olen olet oli olla olivat on
+		ovat se sekä sen siitä sinä sinun tai te teidän tämä tämän tässä vaan vai voi yli`},
+}
+
+// stopWords are the stop word sets by language, normalized like the bodies
+// they are looked up in
+var stopWords = func() map[string]map[string]bool {
+	sets := make(map[string]map[string]bool, len(stopWordLists))
+	for _, list := range stopWordLists {
+		set := make(map[string]bool)
+		for _, word := range strings.Fields(list.words) {
+			set[normalizeString(word)] = true
+		}
+		sets[list.language] = set
+	}
+	return sets
+}()
+
+// stopWordsFor returns the stop words of the language most of the words are
+// stop words of, English on a tie, or nil if none are
+func stopWordsFor(words []string) map[string]bool {
+	var best map[string]bool
+	var bestHits int
+	for _, list := range stopWordLists {
+		set := stopWords[list.language]
+		hits := 0
+		for _, word := range words {
+			if set[word] {
+				hits++
+			}
+		}
+		if hits > bestHits {
+			best, bestHits = set, hits
+		}
+	}
+	return best
+}
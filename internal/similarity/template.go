@@ -0,0 +1,184 @@
+package similarity
+
+import (
+	"mailboxzero/internal/jmap"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Placeholders stand in for the parts of automated emails that change from
+// one message to the next
+const (
+	PlaceholderNumber = "<N>"
+	PlaceholderDate   = "<DATE>"
+	PlaceholderAmount = "<AMOUNT>"
+	PlaceholderUUID   = "<UUID>"
+	PlaceholderCode   = "<CODE>"
+)
+
+// placeholders are the placeholders as normalizeString keeps them
+var placeholders = []string{
+	strings.ToLower(PlaceholderNumber),
+	strings.ToLower(PlaceholderDate),
+	strings.ToLower(PlaceholderAmount),
+	strings.ToLower(PlaceholderUUID),
+	strings.ToLower(PlaceholderCode),
+}
+
+const (
+	month    = `(?:jan(?:uary)?|feb(?:ruary)?|mar(?:ch)?|apr(?:il)?|may|june?|july?|aug(?:ust)?|sep(?:t(?:ember)?)?|oct(?:ober)?|nov(?:ember)?|dec(?:ember)?)\.?`
+	ordinal  = `(?:st|nd|rd|th)?`
+	number   = `\d+(?:[.,]\d+)*`
+	currency = `(?:usd|eur|gbp|jpy|chf|cad|aud|sek|nok|dkk)`
+)
+
+// templatePatterns are tried in order, so that e.g. the digits of a date are
+// not taken for numbers. Every pattern needs a digit to match.
+var templatePatterns = []struct {
+	pattern     *regexp.Regexp
+	placeholder string
+}{
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`), PlaceholderUUID},
+	// 2026-09-15, 2026-09 and 2026-09-15T10:30:00
+	{regexp.MustCompile(`\b(?:19|20)\d{2}-\d{1,2}(?:-\d{1,2}(?:[T ]\d{1,2}:\d{2}(?::\d{2})?)?)?\b`), PlaceholderDate},
+	// 2026/09/15, 15/09/2026, 9/15/26 and 15.09.2026
+	{regexp.MustCompile(`\b(?:19|20)\d{2}/\d{1,2}/\d{1,2}\b`), PlaceholderDate},
+	{regexp.MustCompile(`\b\d{1,2}[./]\d{1,2}[./](?:\d{4}|\d{2})\b`), PlaceholderDate},
+	// 15 September 2026, 15th Sep, September 15, 2026 and Sep 2026
+	{regexp.MustCompile(`(?i)\b\d{1,2}` + ordinal + `\s+` + month + `(?:,?\s+\d{4})?\b`), PlaceholderDate},
+	{regexp.MustCompile(`(?i)\b` + month + `\s+\d{1,2}` + ordinal + `(?:,?\s+\d{4})?\b`), PlaceholderDate},
+	{regexp.MustCompile(`(?i)\b` + month + `\s+\d{4}\b`), PlaceholderDate},
+	// $12.99, 12,99 €, EUR 5 and 10.00 USD
+	{regexp.MustCompile(`[$€£¥₹]\s?` + number), PlaceholderAmount},
+	{regexp.MustCompile(`\b` + number + `\s?[$€£¥₹]`), PlaceholderAmount},
+	{regexp.MustCompile(`(?i)\b` + currency + `\s?` + number), PlaceholderAmount},
+	{regexp.MustCompile(`(?i)\b` + number + `\s?` + currency + `\b`), PlaceholderAmount},
+	// Tracking codes and references such as 1Z999AA10123456784 and
+	// INV-2026-0042, checked by isCode
+	{regexp.MustCompile(`\b[A-Z0-9]+(?:-[A-Z0-9]+)*\b`), PlaceholderCode},
+	{regexp.MustCompile(`\b` + number + `\b`), PlaceholderNumber},
+}
+
+// minCodeLength is the fewest letters and digits a tracking code has, so
+// that product names like MP3 or RTX4090 stay as they are
+const minCodeLength = 8
+
+// Template returns s with the parts that vary between emails sent from one
+// template replaced by placeholders: "Your order #83921 has shipped" becomes
+// "Your order #<N> has shipped" and "Invoice 2026-09" becomes
+// "Invoice <DATE>".
+func Template(s string) string {
+	if strings.IndexFunc(s, isDigit) < 0 {
+		return s
+	}
+
+	if len(s) > templateCacheMaxLength {
+		return applyTemplatePatterns(s)
+	}
+
+	templateCache.RLock()
+	template, ok := templateCache.templates[s]
+	templateCache.RUnlock()
+	if ok {
+		return template
+	}
+
+	template = applyTemplatePatterns(s)
+
+	templateCache.Lock()
+	if templateCache.bytes >= templateCacheBytes {
+		templateCache.templates = make(map[string]string)
+		templateCache.bytes = 0
+	}
+	if _, ok := templateCache.templates[s]; !ok {
+		templateCache.templates[s] = template
+		templateCache.bytes += len(s) + len(template)
+	}
+	templateCache.Unlock()
+	return template
+}
+
+// Every email is compared with many others, and templating costs more than a
+// comparison, so the templates of subjects and compared body starts are
+// remembered. Whole bodies are templated once per email and not remembered.
+const (
+	// templateCacheMaxLength is the longest string, in bytes, whose template
+	// is remembered: bodyCompareLength characters of any script
+	templateCacheMaxLength = 4 * bodyCompareLength
+	// templateCacheBytes is how many bytes of strings and templates are
+	// remembered before the cache is emptied
+	templateCacheBytes = 16 << 20
+)
+
+// templateCache maps strings to their templates. It is emptied when full.
+var templateCache = struct {
+	sync.RWMutex
+	templates map[string]string
+	bytes     int
+}{templates: make(map[string]string)}
+
+// applyTemplatePatterns replaces what every template pattern matches in s
+func applyTemplatePatterns(s string) string {
+	for _, p := range templatePatterns {
+		if p.placeholder == PlaceholderCode {
+			s = p.pattern.ReplaceAllStringFunc(s, func(token string) string {
+				if isCode(token) {
+					return PlaceholderCode
+				}
+				return token
+			})
+			continue
+		}
+		s = p.pattern.ReplaceAllLiteralString(s, p.placeholder)
+	}
+	return s
+}
+
+// isCode reports whether an uppercase token is long enough and mixes letters
+// and digits like a tracking code
+func isCode(token string) bool {
+	var letters, digits int
+	for _, r := range token {
+		switch {
+		case isDigit(r):
+			digits++
+		case unicode.IsLetter(r):
+			letters++
+		}
+	}
+	return letters > 0 && digits > 0 && letters+digits >= minCodeLength
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+// placeholderAt returns the lowercase placeholder s starts with, if any
+func placeholderAt(s string) string {
+	if !strings.HasPrefix(s, "<") {
+		return ""
+	}
+	for _, p := range placeholders {
+		if strings.HasPrefix(s, p) {
+			return p
+		}
+	}
+	return ""
+}
+
+// groupTemplate is the subject template most members share, the first to
+// get there on a tie
+func groupTemplate(emails []jmap.Email) string {
+	var best string
+	counts := make(map[string]int)
+	for _, email := range emails {
+		template := Template(email.Subject)
+		counts[template]++
+		if counts[template] > counts[best] {
+			best = template
+		}
+	}
+	return best
+}
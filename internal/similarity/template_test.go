@@ -0,0 +1,97 @@
+package similarity
+
+import (
+	"mailboxzero/internal/jmap"
+	"strings"
+	"testing"
+)
+
+func TestTemplate(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "no digits", input: "Weekly newsletter", want: "Weekly newsletter"},
+		{name: "order number", input: "Your order #83921 has shipped", want: "Your order #<N> has shipped"},
+		{name: "grouped number", input: "1,250 new followers", want: "<N> new followers"},
+		{name: "year and month", input: "Invoice 2026-09", want: "Invoice <DATE>"},
+		{name: "iso date and time", input: "Backup 2026-09-15T03:00:00 done", want: "Backup <DATE> done"},
+		{name: "slashed date", input: "Statement for 15/09/2026", want: "Statement for <DATE>"},
+		{name: "dotted date", input: "Termin am 15.09.2026", want: "Termin am <DATE>"},
+		{name: "day and month", input: "Your trip on 15th Sep", want: "Your trip on <DATE>"},
+		{name: "month day and year", input: "Receipt for September 15, 2026", want: "Receipt for <DATE>"},
+		{name: "month and year", input: "Your Sep 2026 statement", want: "Your <DATE> statement"},
+		{name: "month without digits", input: "Our May sale", want: "Our May sale"},
+		{name: "dollar amount", input: "You paid $12.99", want: "You paid <AMOUNT>"},
+		{name: "euro amount", input: "Ihre Rechnung über 12,99 €", want: "Ihre Rechnung über <AMOUNT>"},
+		{name: "currency code", input: "Refund of 10.00 USD issued", want: "Refund of <AMOUNT> issued"},
+		{name: "uuid", input: "Request 3f2b8c1e-9d4a-4e6b-8a7c-1b2c3d4e5f60 received", want: "Request <UUID> received"},
+		{name: "tracking code", input: "Package 1Z999AA10123456784 is on its way", want: "Package <CODE> is on its way"},
+		{name: "reference", input: "Ticket INV-2026-0042 updated", want: "Ticket <CODE> updated"},
+		{name: "product name", input: "The new MP3 player", want: "The new MP3 player"},
+		{name: "digits inside a word", input: "Set up 2FA on Windows11", want: "Set up 2FA on Windows11"},
+		{name: "percentage", input: "50% off everything", want: "<N>% off everything"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Template(tt.input); got != tt.want {
+				t.Errorf("Template(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplate_Cache(t *testing.T) {
+	body := strings.Repeat("Order 42 shipped. ", 1000)
+	want := strings.Repeat("Order <N> shipped. ", 1000)
+	if got := Template(body); got != want {
+		t.Errorf("Template() of a long body = %q...", got[:40])
+	}
+
+	templateCache.RLock()
+	_, cached := templateCache.templates[body]
+	bytes := templateCache.bytes
+	templateCache.RUnlock()
+	if cached {
+		t.Error("Template() remembered the template of a whole body")
+	}
+	if bytes > templateCacheBytes+2*templateCacheMaxLength {
+		t.Errorf("template cache holds %d bytes, more than its budget of %d", bytes, templateCacheBytes)
+	}
+}
+
+func TestGroupTemplate(t *testing.T) {
+	emails := []jmap.Email{
+		{Subject: "Your order #1 has shipped"},
+		{Subject: "Your order was delivered"},
+		{Subject: "Your order #2 has shipped"},
+		{Subject: "Your order was delivered"},
+		{Subject: "Your order #3 has shipped"},
+	}
+	if got, want := groupTemplate(emails), "Your order #<N> has shipped"; got != want {
+		t.Errorf("groupTemplate() = %q, want %q", got, want)
+	}
+
+	if got, want := groupTemplate(emails[1:4]), "Your order was delivered"; got != want {
+		t.Errorf("groupTemplate() = %q, want %q", got, want)
+	}
+}
+
+func TestFindEmailGroups_Template(t *testing.T) {
+	from := []jmap.EmailAddress{{Email: "orders@shop.example"}}
+	emails := []jmap.Email{
+		{ID: "1", Subject: "Your order #83921 has shipped", From: from, Preview: "Track your package"},
+		{ID: "2", Subject: "Your order #7 has shipped", From: from, Preview: "Track your package"},
+		{ID: "3", Subject: "Your order #120455 has shipped", From: from, Preview: "Track your package"},
+	}
+
+	groups := FindEmailGroups(emails, 0.99)
+	if len(groups) != 1 || groups[0].Size != 3 {
+		t.Fatalf("FindEmailGroups() = %v, want one group of 3 emails differing only in order number", groupIDs(groups))
+	}
+	if got, want := groups[0].Template, "Your order #<N> has shipped"; got != want {
+		t.Errorf("Template = %q, want %q", got, want)
+	}
+}
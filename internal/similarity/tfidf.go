@@ -0,0 +1,161 @@
+package similarity
+
+import (
+	"fmt"
+	"mailboxzero/internal/jmap"
+	"math"
+	"sort"
+	"strings"
+)
+
+// BodyScoring is how the bodies of two emails are compared
+type BodyScoring string
+
+const (
+	// BodyLevenshtein compares bodies by edit distance, like subjects
+	BodyLevenshtein BodyScoring = "levenshtein"
+	// BodyTFIDF compares bodies by the cosine similarity of their TF-IDF
+	// vectors over the emails being grouped, leaving out stop words. It is
+	// faster on long bodies and better at telling what they are about.
+	BodyTFIDF BodyScoring = "tfidf"
+)
+
+// BodyScorings lists every way of comparing bodies, Levenshtein first
+var BodyScorings = []BodyScoring{BodyLevenshtein, BodyTFIDF}
+
+// ParseBodyScoring returns the body scoring with the given name. An empty
+// name is Levenshtein, the default.
+func ParseBodyScoring(name string) (BodyScoring, error) {
+	if name == "" {
+		return BodyLevenshtein, nil
+	}
+	for _, scoring := range BodyScorings {
+		if string(scoring) == name {
+			return scoring, nil
+		}
+	}
+	return "", fmt.Errorf("unknown body scoring %q", name)
+}
+
+// TFIDF weighs the words of email bodies by how often they occur in a body
+// (term frequency) and how few bodies of an inbox they occur in (inverse
+// document frequency), so that two bodies are similar when they share the
+// words that set them apart from the rest of the inbox
+type TFIDF struct {
+	documents int
+	frequency map[string]int
+	vectors   map[string]termVector
+}
+
+// termWeight is the TF-IDF weight of one term of a body
+type termWeight struct {
+	term   string
+	weight float64
+}
+
+// termVector is a body's terms in ascending order, with weights scaled to a
+// Euclidean length of 1
+type termVector []termWeight
+
+// NewTFIDF builds the TF-IDF model of the emails' bodies
+func NewTFIDF(emails []jmap.Email) *TFIDF {
+	t := &TFIDF{
+		frequency: make(map[string]int),
+		vectors:   make(map[string]termVector, len(emails)),
+	}
+
+	counts := make([]map[string]int, len(emails))
+	for i, email := range emails {
+		counts[i] = termCounts(bodyTerms(emailText(email)))
+		for term := range counts[i] {
+			t.frequency[term]++
+		}
+	}
+	t.documents = len(emails)
+
+	for i, email := range emails {
+		t.vectors[email.ID] = t.vectorOf(counts[i])
+	}
+	return t
+}
+
+// Similarity is the cosine similarity of the emails' bodies, 0 if either has
+// no words other than stop words. Emails the model was not built from are
+// weighed with its document frequencies.
+func (t *TFIDF) Similarity(email1, email2 jmap.Email) float64 {
+	return math.Min(t.vector(email1).dot(t.vector(email2)), 1.0)
+}
+
+func (t *TFIDF) vector(email jmap.Email) termVector {
+	if v, ok := t.vectors[email.ID]; ok {
+		return v
+	}
+	return t.vectorOf(termCounts(bodyTerms(emailText(email))))
+}
+
+// vectorOf weighs term counts by the sublinear term frequency 1+ln(count)
+// and the smoothed inverse document frequency ln((1+n)/(1+df))+1
+func (t *TFIDF) vectorOf(counts map[string]int) termVector {
+	v := make(termVector, 0, len(counts))
+	var norm float64
+	for term, count := range counts {
+		idf := math.Log(float64(1+t.documents)/float64(1+t.frequency[term])) + 1
+		weight := (1 + math.Log(float64(count))) * idf
+		v = append(v, termWeight{term: term, weight: weight})
+		norm += weight * weight
+	}
+
+	norm = math.Sqrt(norm)
+	for i := range v {
+		v[i].weight /= norm
+	}
+	sort.Slice(v, func(i, j int) bool { return v[i].term < v[j].term })
+	return v
+}
+
+// dot is the sum of the products of the weights of the terms in both vectors
+func (v termVector) dot(other termVector) float64 {
+	var sum float64
+	for i, j := 0, 0; i < len(v) && j < len(other); {
+		switch {
+		case v[i].term < other[j].term:
+			i++
+		case v[i].term > other[j].term:
+			j++
+		default:
+			sum += v[i].weight * other[j].weight
+			i++
+			j++
+		}
+	}
+	return sum
+}
+
+func termCounts(terms []string) map[string]int {
+	counts := make(map[string]int, len(terms))
+	for _, term := range terms {
+		counts[term]++
+	}
+	return counts
+}
+
+// bodyTerms are the words of a body that say what it is about: the
+// normalized words without placeholders, single letters and the stop words of
+// the body's language
+func bodyTerms(body string) []string {
+	var words []string
+	for _, word := range strings.Fields(normalizeString(body)) {
+		if len([]rune(word)) > 1 && placeholderAt(word) != word {
+			words = append(words, word)
+		}
+	}
+
+	stop := stopWordsFor(words)
+	terms := words[:0]
+	for _, word := range words {
+		if !stop[word] {
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
@@ -0,0 +1,218 @@
+package similarity
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"mailboxzero/internal/jmap"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func TestParseBodyScoring(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    BodyScoring
+		wantErr bool
+	}{
+		{name: "", want: BodyLevenshtein},
+		{name: "levenshtein", want: BodyLevenshtein},
+		{name: "tfidf", want: BodyTFIDF},
+		{name: "bm25", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseBodyScoring(tt.name)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseBodyScoring(%q) = %q, %v, want %q (error %v)", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestBodyTerms(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{
+			name: "english",
+			body: "Your invoice for the month is ready to download.",
+			want: []string{"invoice", "month", "ready", "download"},
+		},
+		{
+			name: "german",
+			body: "Ihre Rechnung für den Monat ist da und wartet auf Sie",
+			want: []string{"rechnung", "monat", "wartet"},
+		},
+		{
+			name: "finnish",
+			body: "Tilauksesi on lähetetty ja se on perillä pian",
+			want: []string{"tilauksesi", "lahetetty", "perilla", "pian"},
+		},
+		{
+			name: "placeholders and single letters",
+			body: "Order #83921: 3 x T-shirt for $12.99",
+			want: []string{"order", "shirt"},
+		},
+		{
+			name: "only stop words",
+			body: "It is what it is.",
+			want: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := bodyTerms(tt.body)
+			if got == nil {
+				got = []string{}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("bodyTerms(%q) = %q, want %q", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTFIDF_Similarity(t *testing.T) {
+	body := func(id, text string) jmap.Email {
+		return jmap.Email{ID: id, Preview: text}
+	}
+	emails := []jmap.Email{
+		body("a", "Your invoice from the hosting provider"),
+		body("b", "Your invoice from the hosting provider"),
+		body("c", "Your invoice from the bakery"),
+		body("d", "Weekly digest of kubernetes news"),
+		body("e", "Weekly digest of gardening news"),
+		body("f", "The the the and of"),
+	}
+	model := NewTFIDF(emails)
+
+	tests := []struct {
+		name   string
+		e1, e2 jmap.Email
+		want   func(float64) bool
+	}{
+		{name: "identical", e1: emails[0], e2: emails[1], want: func(s float64) bool { return math.Abs(s-1) < 1e-9 }},
+		{name: "nothing shared", e1: emails[0], e2: emails[3], want: func(s float64) bool { return s == 0 }},
+		{name: "only stop words", e1: emails[0], e2: emails[5], want: func(s float64) bool { return s == 0 }},
+		{name: "partly shared", e1: emails[0], e2: emails[2], want: func(s float64) bool { return s > 0 && s < 1 }},
+		{
+			name: "not in the model",
+			e1:   emails[3],
+			e2:   body("x", "Weekly digest of kubernetes news"),
+			want: func(s float64) bool { return math.Abs(s-1) < 1e-9 },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := model.Similarity(tt.e1, tt.e2)
+			if !tt.want(got) {
+				t.Errorf("Similarity() = %v", got)
+			}
+			if back := model.Similarity(tt.e2, tt.e1); back != got {
+				t.Errorf("Similarity() = %v one way and %v the other", got, back)
+			}
+		})
+	}
+
+	// Sharing the rare "kubernetes" counts for more than sharing "invoice",
+	// which three bodies have
+	rare := model.Similarity(emails[3], body("y", "kubernetes release"))
+	common := model.Similarity(emails[2], body("z", "invoice release"))
+	if rare <= common {
+		t.Errorf("rare shared term scores %v, common shared term %v, want the rare one higher", rare, common)
+	}
+}
+
+func TestFindEmailGroupsWith_TFIDF(t *testing.T) {
+	from := []jmap.EmailAddress{{Email: "billing@host.example"}}
+	emails := []jmap.Email{
+		{ID: "1", Subject: "Invoice", From: from, Preview: "Your invoice for the virtual servers this month is attached"},
+		{ID: "2", Subject: "Invoice", From: from, Preview: "Attached is the month's invoice for your virtual servers"},
+		{ID: "3", Subject: "Invoice", From: from, Preview: "Thanks for shopping, your gift card balance is low"},
+	}
+
+	levenshtein := FindEmailGroupsWith(emails, Options{Threshold: 0.9})
+	tfidf := FindEmailGroupsWith(emails, Options{Threshold: 0.9, Body: BodyTFIDF})
+
+	if got := groupIDs(levenshtein); len(got) != 0 {
+		t.Errorf("Levenshtein groups = %v, want none: the reordered body differs in too many characters", got)
+	}
+	if got, want := groupIDs(tfidf), [][]string{{"1", "2"}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("TF-IDF groups = %v, want %v", got, want)
+	}
+	body := tfidf[0].Scores["2"].Features[2]
+	if body.Name != FeatureBody || body.Note == "" || body.Bonus != 0 {
+		t.Errorf("body feature = %+v, want a TF-IDF score without bonus", body)
+	}
+}
+
+// TestTFIDF_Golden compares the terms, pairwise similarities and groups of
+// three emails of every kind in the mock inbox with
+// testdata/tfidf_mock.golden. Run with -update to rewrite it after intended
+// changes.
+func TestTFIDF_Golden(t *testing.T) {
+	all, err := jmap.NewMockClient().GetInboxEmails(context.Background(), 1000)
+	if err != nil {
+		t.Fatalf("GetInboxEmails() error = %v", err)
+	}
+
+	// The number of emails of each kind is random, the first three are
+	// always there
+	var emails []jmap.Email
+	for _, email := range all {
+		if strings.HasSuffix(email.ID, "-0") || strings.HasSuffix(email.ID, "-1") ||
+			strings.HasSuffix(email.ID, "-2") || strings.HasPrefix(email.ID, "unique-") {
+			emails = append(emails, email)
+		}
+	}
+	sort.Slice(emails, func(i, j int) bool { return emails[i].ID < emails[j].ID })
+
+	model := NewTFIDF(emails)
+	var got strings.Builder
+	for _, email := range emails {
+		fmt.Fprintf(&got, "%s: %s\n", email.ID, strings.Join(bodyTerms(emailText(email)), " "))
+	}
+	// Pairs are listed for the first email of each kind, the others have
+	// the same body
+	first := func(email jmap.Email) bool {
+		return !strings.HasSuffix(email.ID, "-1") && !strings.HasSuffix(email.ID, "-2")
+	}
+	for i := range emails {
+		for j := i + 1; j < len(emails); j++ {
+			if !first(emails[i]) || !first(emails[j]) {
+				continue
+			}
+			if s := model.Similarity(emails[i], emails[j]); s > 0 {
+				fmt.Fprintf(&got, "%s %s %.4f\n", emails[i].ID, emails[j].ID, s)
+			}
+		}
+	}
+	for _, group := range FindEmailGroupsWith(emails, Options{Threshold: 0.7, Body: BodyTFIDF}) {
+		fmt.Fprintf(&got, "group %.4f %q: %s\n", group.Similarity, group.Template, strings.Join(groupIDs([]EmailGroup{group})[0], " "))
+	}
+
+	golden := filepath.Join("testdata", "tfidf_mock.golden")
+	if *update {
+		if err := os.WriteFile(golden, []byte(got.String()), 0644); err != nil {
+			t.Fatalf("failed to update golden file: %v", err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("failed to read golden file: %v", err)
+	}
+	if got.String() != string(want) {
+		t.Errorf("TF-IDF of the mock inbox differs from %s:\n%s", golden, got.String())
+	}
+}
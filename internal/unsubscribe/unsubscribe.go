@@ -0,0 +1,352 @@
+package unsubscribe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mailboxzero/internal/jmap"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultHistorySize is how many results an Unsubscriber keeps
+const DefaultHistorySize = 100
+
+// oneClickBody is the POST body RFC 8058 one-click unsubscribes are sent with
+const oneClickBody = "List-Unsubscribe=One-Click"
+
+// Methods an unsubscribe can be performed with
+const (
+	MethodOneClick = "oneClick" // RFC 8058 HTTPS POST
+	MethodMailto   = "mailto"   // email to the list's unsubscribe address
+	MethodWeb      = "web"      // a link the user has to open themselves
+)
+
+// Outcomes of an unsubscribe
+const (
+	StatusUnsubscribed = "unsubscribed"
+	StatusSent         = "sent"
+	StatusDryRun       = "dryRun"
+	StatusManual       = "manual"
+	StatusUnsupported  = "unsupported"
+	StatusFailed       = "failed"
+)
+
+// Result is the outcome of unsubscribing from one sender. Sender is the list
+// ID for mailing list traffic and the From address otherwise.
+type Result struct {
+	Sender   string    `json:"sender"`
+	ListID   string    `json:"listId,omitempty"`
+	Method   string    `json:"method,omitempty"`
+	Target   string    `json:"target,omitempty"`
+	Status   string    `json:"status"`
+	Error    string    `json:"error,omitempty"`
+	EmailIDs []string  `json:"emailIds"`
+	At       time.Time `json:"at"`
+}
+
+// Unsubscriber unsubscribes from the senders of a group of emails using their
+// List-Unsubscribe headers and remembers the recent results.
+type Unsubscriber struct {
+	httpClient *http.Client
+	mailer     jmap.Mailer
+
+	mu         sync.Mutex
+	history    []Result
+	maxHistory int
+}
+
+// New creates an Unsubscriber that sends one-click requests with httpClient
+// and mailto unsubscribes through mailer. A nil httpClient uses a client with
+// a short timeout that only connects to public addresses; a nil mailer
+// reports mailto links as unsupported.
+func New(httpClient *http.Client, mailer jmap.Mailer) *Unsubscriber {
+	if httpClient == nil {
+		httpClient = newPublicClient()
+	}
+	return &Unsubscriber{
+		httpClient: httpClient,
+		mailer:     mailer,
+		maxHistory: DefaultHistorySize,
+	}
+}
+
+// errNotPublic is returned when a one-click URL leads to an address that is
+// not on the public internet
+var errNotPublic = errors.New("address is not public")
+
+// newPublicClient creates the client one-click requests are sent with. The
+// URLs come from the senders' headers, so it must not reach this machine or
+// the network it is on: it connects directly, never through a proxy, and
+// refuses non-public addresses.
+func newPublicClient() *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Control: publicOnly}
+	return &http.Client{
+		Timeout: 15 * time.Second,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+			ForceAttemptHTTP2:   true,
+		},
+	}
+}
+
+// publicOnly refuses to connect to loopback, private, link-local and
+// unspecified addresses. It runs after the host name is resolved, so names
+// that resolve to such addresses are refused too.
+func publicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("%w: %s", errNotPublic, ip)
+	}
+	return nil
+}
+
+// sender is the emails of one sender in a group, with the newest email whose
+// headers are used
+type sender struct {
+	key    string
+	listID string
+	newest jmap.Email
+	ids    []string
+}
+
+// Unsubscribe unsubscribes once from every sender in emails. With dryRun set
+// nothing is sent and the results say what would have been done.
+func (u *Unsubscriber) Unsubscribe(ctx context.Context, emails []jmap.Email, dryRun bool) []Result {
+	results := make([]Result, 0)
+	for _, s := range groupBySender(emails) {
+		result := Result{
+			Sender:   s.key,
+			ListID:   s.listID,
+			EmailIDs: s.ids,
+		}
+		result.Method, result.Target = chooseMethod(s.newest)
+		u.perform(ctx, &result, dryRun)
+		result.At = time.Now()
+		results = append(results, result)
+	}
+
+	u.record(results)
+	return results
+}
+
+// History returns the most recent results, newest first. A limit of zero or
+// less returns all of them.
+func (u *Unsubscriber) History(limit int) []Result {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	n := len(u.history)
+	if limit > 0 && limit < n {
+		n = limit
+	}
+	recent := make([]Result, 0, n)
+	for i := len(u.history) - 1; i >= 0 && len(recent) < n; i-- {
+		recent = append(recent, u.history[i])
+	}
+	return recent
+}
+
+func (u *Unsubscriber) record(results []Result) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.history = append(u.history, results...)
+	if excess := len(u.history) - u.maxHistory; excess > 0 {
+		u.history = append([]Result(nil), u.history[excess:]...)
+	}
+}
+
+// perform carries out the chosen method and fills in the outcome
+func (u *Unsubscriber) perform(ctx context.Context, result *Result, dryRun bool) {
+	switch result.Method {
+	case "":
+		result.Status = StatusUnsupported
+		result.Error = "no List-Unsubscribe header"
+		return
+	case MethodWeb:
+		// Opening the link may need the user to confirm on the page, so it
+		// is never fetched on their behalf
+		result.Status = StatusManual
+		return
+	case MethodMailto:
+		if u.mailer == nil {
+			result.Status = StatusUnsupported
+			result.Error = "sending email is not supported"
+			return
+		}
+	}
+
+	if dryRun {
+		result.Status = StatusDryRun
+		return
+	}
+
+	var err error
+	if result.Method == MethodOneClick {
+		err = u.oneClick(ctx, result.Target)
+		result.Status = StatusUnsubscribed
+	} else {
+		err = u.sendMailto(ctx, result.Target)
+		result.Status = StatusSent
+	}
+	if err != nil {
+		result.Status = StatusFailed
+		result.Error = err.Error()
+	}
+}
+
+// oneClick sends the RFC 8058 unsubscribe POST. Redirects are not followed
+// and no cookies or credentials are sent.
+func (u *Unsubscriber) oneClick(ctx context.Context, target string) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", target, strings.NewReader(oneClickBody))
+	if err != nil {
+		return fmt.Errorf("failed to create unsubscribe request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	client := *u.httpClient
+	client.Jar = nil
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send unsubscribe request: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unsubscribe request failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// sendMailto sends the email a mailto: unsubscribe link describes
+func (u *Unsubscriber) sendMailto(ctx context.Context, target string) error {
+	msg, err := parseMailto(target)
+	if err != nil {
+		return err
+	}
+	if err := u.mailer.SendEmail(ctx, msg); err != nil {
+		return fmt.Errorf("failed to send unsubscribe email: %w", err)
+	}
+	return nil
+}
+
+// groupBySender splits emails by list, or by From address for emails that
+// did not come through a list, in order of first appearance
+func groupBySender(emails []jmap.Email) []*sender {
+	var senders []*sender
+	byKey := make(map[string]*sender)
+
+	for _, email := range emails {
+		listID := email.ListIdentifier()
+		key := listID
+		if key == "" && len(email.From) > 0 {
+			key = strings.ToLower(email.From[0].Email)
+		}
+		if key == "" {
+			continue
+		}
+
+		s, ok := byKey[key]
+		if !ok {
+			s = &sender{key: key, listID: listID, newest: email}
+			byKey[key] = s
+			senders = append(senders, s)
+		} else if email.ReceivedAt.After(s.newest.ReceivedAt) {
+			s.newest = email
+		}
+		s.ids = append(s.ids, email.ID)
+	}
+	return senders
+}
+
+// chooseMethod picks how to unsubscribe using an email's headers: one-click
+// if the list supports it over HTTPS, then mailto, then a plain web link.
+func chooseMethod(email jmap.Email) (method, target string) {
+	var secure, web, mailto string
+	for _, link := range email.ListUnsubscribe {
+		link = strings.TrimSpace(link)
+		parsed, err := url.Parse(link)
+		if err != nil {
+			continue
+		}
+
+		switch strings.ToLower(parsed.Scheme) {
+		case "https":
+			if secure == "" {
+				secure = link
+			}
+			if web == "" {
+				web = link
+			}
+		case "http":
+			if web == "" {
+				web = link
+			}
+		case "mailto":
+			if mailto == "" {
+				mailto = link
+			}
+		}
+	}
+
+	oneClick := strings.EqualFold(strings.TrimSpace(email.ListUnsubscribePost), oneClickBody)
+	switch {
+	case oneClick && secure != "":
+		return MethodOneClick, secure
+	case mailto != "":
+		return MethodMailto, mailto
+	case web != "":
+		return MethodWeb, web
+	}
+	return "", ""
+}
+
+// parseMailto turns a mailto: URL (RFC 6068) into the email it asks for,
+// defaulting the subject to "unsubscribe"
+func parseMailto(target string) (jmap.OutgoingEmail, error) {
+	parsed, err := url.Parse(target)
+	if err != nil || !strings.EqualFold(parsed.Scheme, "mailto") {
+		return jmap.OutgoingEmail{}, fmt.Errorf("invalid mailto link %q", target)
+	}
+
+	to, err := url.PathUnescape(parsed.Opaque)
+	if err != nil || !strings.Contains(to, "@") {
+		return jmap.OutgoingEmail{}, fmt.Errorf("invalid mailto address in %q", target)
+	}
+	if i := strings.Index(to, ","); i >= 0 {
+		to = to[:i]
+	}
+
+	query := parsed.Query()
+	msg := jmap.OutgoingEmail{
+		To:      strings.TrimSpace(to),
+		Subject: query.Get("subject"),
+		Body:    query.Get("body"),
+	}
+	if msg.Subject == "" {
+		msg.Subject = "unsubscribe"
+	}
+	return msg, nil
+}
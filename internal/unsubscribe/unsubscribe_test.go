@@ -0,0 +1,358 @@
+package unsubscribe
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mailboxzero/internal/jmap"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// listServer is a local stand-in for a list's one-click unsubscribe endpoint
+type listServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   []string
+	status   int
+}
+
+func newListServer(t *testing.T, status int) *listServer {
+	t.Helper()
+
+	l := &listServer{status: status}
+	l.Server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		l.mu.Lock()
+		l.requests = append(l.requests, r)
+		l.bodies = append(l.bodies, string(body))
+		l.mu.Unlock()
+
+		if l.status == http.StatusFound {
+			http.Redirect(w, r, "/confirm", http.StatusFound)
+			return
+		}
+		w.WriteHeader(l.status)
+	}))
+	t.Cleanup(l.Close)
+	return l
+}
+
+// fakeMailer records sent emails and fails with err if set
+type fakeMailer struct {
+	sent []jmap.OutgoingEmail
+	err  error
+}
+
+func (m *fakeMailer) SendEmail(ctx context.Context, msg jmap.OutgoingEmail) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func listEmail(id, listID string, receivedAt time.Time, post string, links ...string) jmap.Email {
+	return jmap.Email{
+		ID:                  id,
+		From:                []jmap.EmailAddress{{Email: "news@example.com"}},
+		ReceivedAt:          receivedAt,
+		ListID:              listID,
+		ListUnsubscribe:     links,
+		ListUnsubscribePost: post,
+	}
+}
+
+func TestChooseMethod(t *testing.T) {
+	tests := []struct {
+		name       string
+		post       string
+		links      []string
+		wantMethod string
+		wantTarget string
+	}{
+		{
+			name:       "one-click",
+			post:       "List-Unsubscribe=One-Click",
+			links:      []string{"mailto:u@example.com", "https://example.com/u/1"},
+			wantMethod: MethodOneClick,
+			wantTarget: "https://example.com/u/1",
+		},
+		{
+			name:       "one-click needs https",
+			post:       "List-Unsubscribe=One-Click",
+			links:      []string{"http://example.com/u/1", "mailto:u@example.com"},
+			wantMethod: MethodMailto,
+			wantTarget: "mailto:u@example.com",
+		},
+		{
+			name:       "mailto without post header",
+			links:      []string{"https://example.com/u/1", "mailto:u@example.com"},
+			wantMethod: MethodMailto,
+			wantTarget: "mailto:u@example.com",
+		},
+		{
+			name:       "web link only",
+			links:      []string{"https://example.com/u/1"},
+			wantMethod: MethodWeb,
+			wantTarget: "https://example.com/u/1",
+		},
+		{
+			name:  "no usable link",
+			links: []string{"ftp://example.com/u"},
+		},
+		{
+			name: "no header",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			email := listEmail("e1", "", time.Time{}, tt.post, tt.links...)
+			method, target := chooseMethod(email)
+			if method != tt.wantMethod || target != tt.wantTarget {
+				t.Errorf("chooseMethod() = %q, %q, want %q, %q", method, target, tt.wantMethod, tt.wantTarget)
+			}
+		})
+	}
+}
+
+func TestParseMailto(t *testing.T) {
+	tests := []struct {
+		target  string
+		want    jmap.OutgoingEmail
+		wantErr bool
+	}{
+		{
+			target: "mailto:leave@example.com",
+			want:   jmap.OutgoingEmail{To: "leave@example.com", Subject: "unsubscribe"},
+		},
+		{
+			target: "mailto:leave%2Bnews@example.com?subject=Remove%20me&body=id%3D42",
+			want:   jmap.OutgoingEmail{To: "leave+news@example.com", Subject: "Remove me", Body: "id=42"},
+		},
+		{
+			target: "mailto:a@example.com,b@example.com",
+			want:   jmap.OutgoingEmail{To: "a@example.com", Subject: "unsubscribe"},
+		},
+		{target: "mailto:?subject=unsubscribe", wantErr: true},
+		{target: "https://example.com/u", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			got, err := parseMailto(tt.target)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseMailto() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseMailto() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnsubscribe_OneClick(t *testing.T) {
+	list := newListServer(t, http.StatusOK)
+	u := New(list.Client(), nil)
+
+	now := time.Now()
+	emails := []jmap.Email{
+		listEmail("old", "News <news.example.com>", now.Add(-time.Hour), "List-Unsubscribe=One-Click", list.URL+"/u/old"),
+		listEmail("new", "News <news.example.com>", now, "List-Unsubscribe=One-Click", list.URL+"/u/new"),
+	}
+
+	results := u.Unsubscribe(context.Background(), emails, false)
+	if len(results) != 1 {
+		t.Fatalf("Unsubscribe() returned %d results, want 1 per sender", len(results))
+	}
+	result := results[0]
+	if result.Status != StatusUnsubscribed || result.Method != MethodOneClick || result.Error != "" {
+		t.Errorf("result = %+v, want a successful one-click unsubscribe", result)
+	}
+	if result.Sender != "news.example.com" || !reflect.DeepEqual(result.EmailIDs, []string{"old", "new"}) {
+		t.Errorf("result sender = %s with %v, want news.example.com with both emails", result.Sender, result.EmailIDs)
+	}
+
+	if len(list.requests) != 1 {
+		t.Fatalf("list server got %d requests, want 1", len(list.requests))
+	}
+	req := list.requests[0]
+	if req.Method != "POST" || req.URL.Path != "/u/new" {
+		t.Errorf("request = %s %s, want POST to the newest email's link", req.Method, req.URL.Path)
+	}
+	if ct := req.Header.Get("Content-Type"); ct != "application/x-www-form-urlencoded" {
+		t.Errorf("Content-Type = %s, want application/x-www-form-urlencoded", ct)
+	}
+	if list.bodies[0] != "List-Unsubscribe=One-Click" {
+		t.Errorf("body = %q, want List-Unsubscribe=One-Click", list.bodies[0])
+	}
+}
+
+func TestUnsubscribe_OneClickFailures(t *testing.T) {
+	for _, status := range []int{http.StatusInternalServerError, http.StatusFound} {
+		list := newListServer(t, status)
+		u := New(list.Client(), nil)
+
+		email := listEmail("e1", "", time.Now(), "List-Unsubscribe=One-Click", list.URL+"/u/1")
+		results := u.Unsubscribe(context.Background(), []jmap.Email{email}, false)
+
+		if results[0].Status != StatusFailed || !strings.Contains(results[0].Error, "status") {
+			t.Errorf("status %d: result = %+v, want failed", status, results[0])
+		}
+		// Redirects are not followed
+		if len(list.requests) != 1 {
+			t.Errorf("status %d: list server got %d requests, want 1", status, len(list.requests))
+		}
+	}
+}
+
+func TestUnsubscribe_OneClickPrivateAddress(t *testing.T) {
+	// The list server listens on loopback, which the default client refuses
+	list := newListServer(t, http.StatusOK)
+	u := New(nil, nil)
+
+	email := listEmail("e1", "", time.Now(), "List-Unsubscribe=One-Click", list.URL+"/u/1")
+	results := u.Unsubscribe(context.Background(), []jmap.Email{email}, false)
+
+	if results[0].Status != StatusFailed || !strings.Contains(results[0].Error, errNotPublic.Error()) {
+		t.Errorf("result = %+v, want refused", results[0])
+	}
+	if len(list.requests) != 0 {
+		t.Errorf("list server got %d requests, want none", len(list.requests))
+	}
+}
+
+func TestPublicOnly(t *testing.T) {
+	tests := []struct {
+		address string
+		allowed bool
+	}{
+		{address: "93.184.215.14:443", allowed: true},
+		{address: "[2606:2800:21f:cb07:6820:80da:af6b:8b2c]:443", allowed: true},
+		{address: "127.0.0.1:443"},
+		{address: "[::1]:443"},
+		{address: "10.1.2.3:443"},
+		{address: "172.16.0.1:443"},
+		{address: "192.168.1.1:443"},
+		{address: "[fd00::1]:443"},
+		{address: "169.254.169.254:80"},
+		{address: "[fe80::1%eth0]:443"},
+		{address: "0.0.0.0:443"},
+		{address: "[::]:443"},
+		{address: "[::ffff:127.0.0.1]:443"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			err := publicOnly("tcp", tt.address, nil)
+			if tt.allowed && err != nil {
+				t.Errorf("publicOnly(%s) error = %v, want allowed", tt.address, err)
+			}
+			if !tt.allowed && !errors.Is(err, errNotPublic) {
+				t.Errorf("publicOnly(%s) error = %v, want %v", tt.address, err, errNotPublic)
+			}
+		})
+	}
+}
+
+func TestUnsubscribe_Mailto(t *testing.T) {
+	mailer := &fakeMailer{}
+	u := New(nil, mailer)
+
+	email := listEmail("e1", "", time.Now(), "", "https://example.com/u/1", "mailto:leave@example.com?subject=stop")
+	results := u.Unsubscribe(context.Background(), []jmap.Email{email}, false)
+
+	if results[0].Status != StatusSent || results[0].Method != MethodMailto {
+		t.Errorf("result = %+v, want a sent mailto unsubscribe", results[0])
+	}
+	want := []jmap.OutgoingEmail{{To: "leave@example.com", Subject: "stop"}}
+	if !reflect.DeepEqual(mailer.sent, want) {
+		t.Errorf("sent = %+v, want %+v", mailer.sent, want)
+	}
+
+	mailer.err = errors.New("forbiddenToSend")
+	results = u.Unsubscribe(context.Background(), []jmap.Email{email}, false)
+	if results[0].Status != StatusFailed || !strings.Contains(results[0].Error, "forbiddenToSend") {
+		t.Errorf("result = %+v, want failed with the mailer error", results[0])
+	}
+}
+
+func TestUnsubscribe_DryRun(t *testing.T) {
+	list := newListServer(t, http.StatusOK)
+	mailer := &fakeMailer{}
+	u := New(list.Client(), mailer)
+
+	emails := []jmap.Email{
+		listEmail("e1", "A <a.example.com>", time.Now(), "List-Unsubscribe=One-Click", list.URL+"/u/1"),
+		listEmail("e2", "B <b.example.com>", time.Now(), "", "mailto:leave@example.com"),
+	}
+	results := u.Unsubscribe(context.Background(), emails, true)
+
+	for _, result := range results {
+		if result.Status != StatusDryRun {
+			t.Errorf("result = %+v, want dry run", result)
+		}
+	}
+	if len(list.requests) != 0 || len(mailer.sent) != 0 {
+		t.Errorf("dry run sent %d requests and %d emails, want none", len(list.requests), len(mailer.sent))
+	}
+}
+
+func TestUnsubscribe_ManualAndUnsupported(t *testing.T) {
+	u := New(nil, nil)
+
+	web := listEmail("e1", "", time.Now(), "", "https://example.com/u/1")
+	mailto := listEmail("e2", "List <l.example.com>", time.Now(), "", "mailto:leave@example.com")
+	plain := jmap.Email{ID: "e3", From: []jmap.EmailAddress{{Email: "Friend@Example.com"}}}
+
+	results := u.Unsubscribe(context.Background(), []jmap.Email{web, mailto, plain}, false)
+
+	want := []struct{ sender, status string }{
+		{"news@example.com", StatusManual},
+		{"l.example.com", StatusUnsupported},
+		{"friend@example.com", StatusUnsupported},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("Unsubscribe() returned %d results, want %d", len(results), len(want))
+	}
+	for i, w := range want {
+		if results[i].Sender != w.sender || results[i].Status != w.status {
+			t.Errorf("results[%d] = %s %s, want %s %s", i, results[i].Sender, results[i].Status, w.sender, w.status)
+		}
+	}
+	if results[0].Target != "https://example.com/u/1" {
+		t.Errorf("manual result target = %s, want the link to open", results[0].Target)
+	}
+}
+
+func TestUnsubscriber_History(t *testing.T) {
+	u := New(nil, nil)
+	u.maxHistory = 3
+
+	for _, sender := range []string{"a", "b", "c", "d"} {
+		email := jmap.Email{ID: sender, From: []jmap.EmailAddress{{Email: sender + "@example.com"}}}
+		u.Unsubscribe(context.Background(), []jmap.Email{email}, false)
+	}
+
+	history := u.History(0)
+	var senders []string
+	for _, result := range history {
+		senders = append(senders, result.Sender)
+	}
+	if want := []string{"d@example.com", "c@example.com", "b@example.com"}; !reflect.DeepEqual(senders, want) {
+		t.Errorf("History(0) senders = %v, want %v", senders, want)
+	}
+
+	if got := u.History(1); len(got) != 1 || got[0].Sender != "d@example.com" {
+		t.Errorf("History(1) = %+v, want the newest result", got)
+	}
+}
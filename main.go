@@ -1,11 +1,13 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
 	"mailboxzero/internal/config"
 	"mailboxzero/internal/jmap"
 	"mailboxzero/internal/server"
+	"mailboxzero/internal/similarity"
 )
 
 func main() {
@@ -18,22 +20,38 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	journal, err := jmap.OpenJournal(cfg.Journal.Path, cfg.Journal.MaxEntries)
+	if err != nil {
+		log.Fatalf("Failed to open archive journal: %v", err)
+	}
+
 	var jmapClient jmap.JMAPClient
 
 	if cfg.MockMode {
 		log.Println("Starting in MOCK MODE - using sample data")
-		jmapClient = jmap.NewMockClient()
+		mockClient := jmap.NewMockClient()
+		mockClient.SetJournal(journal)
+		jmapClient = mockClient
 	} else {
 		log.Println("Connecting to Fastmail JMAP server...")
 		realClient := jmap.NewClient(cfg.JMAP.Endpoint, cfg.JMAP.APIToken)
+		realClient.SetJournal(journal)
+		realClient.SetRetryPolicy(jmap.RetryPolicy{
+			MaxAttempts: cfg.Retry.MaxAttempts,
+			BaseDelay:   cfg.Retry.BaseDelay,
+			MaxDelay:    cfg.Retry.MaxDelay,
+		})
 
 		log.Println("Authenticating with JMAP server...")
-		if err := realClient.Authenticate(); err != nil {
+		if err := realClient.Authenticate(context.Background()); err != nil {
 			log.Fatalf("Failed to authenticate: %v", err)
 		}
 		log.Println("Authentication successful!")
 
-		jmapClient = realClient
+		syncClient := jmap.NewSyncClient(realClient)
+		go syncClient.WatchPush(nil)
+
+		jmapClient = syncClient
 	}
 
 	srv, err := server.New(cfg, jmapClient)
@@ -41,6 +59,12 @@ func main() {
 		log.Fatalf("Failed to create server: %v", err)
 	}
 
+	feedback, err := similarity.OpenFeedback(cfg.Similarity.FeedbackPath)
+	if err != nil {
+		log.Fatalf("Failed to open similarity feedback: %v", err)
+	}
+	srv.SetFeedback(feedback)
+
 	log.Printf("Starting Mailbox Zero...")
 	if err := srv.Start(); err != nil {
 		log.Fatalf("Server failed: %v", err)
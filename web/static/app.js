@@ -2,6 +2,9 @@ class MailboxZero {
     constructor() {
         this.emails = [];
         this.similarEmails = [];
+        this.groups = []; // Ranked similarity clusters from /api/groups
+        this.mailboxNames = {}; // Mailbox names by ID, for the move target picker
+        this.currentGroupId = null;
         this.selectedEmailId = null;
         this.selectedSimilarEmails = new Set();
         this.inboxSortBy = 'date'; // Default sort by date (newest first)
@@ -17,16 +20,25 @@ class MailboxZero {
         this.attachEventListeners();
         this.initializeTitles();
         this.loadEmails();
+        this.loadHistory();
+        this.loadMailboxes();
+        this.loadWeights();
+        this.connectEvents();
     }
 
     initializeElements() {
         this.similaritySlider = document.getElementById('similarity-slider');
         this.similarityValue = document.getElementById('similarity-value');
+        this.groupModeSelect = document.getElementById('group-mode-select');
+        this.clusteringSelect = document.getElementById('clustering-select');
+        this.resetWeightsBtn = document.getElementById('reset-weights-btn');
         this.refreshBtn = document.getElementById('refresh-btn');
         this.findSimilarBtn = document.getElementById('find-similar-btn');
         this.clearResultsBtn = document.getElementById('clear-results-btn');
         this.selectAllCheckbox = document.getElementById('select-all-checkbox');
         this.archiveBtn = document.getElementById('archive-btn');
+        this.unsubscribeBtn = document.getElementById('unsubscribe-btn');
+        this.moveTargetSelect = document.getElementById('move-target-select');
         this.inboxList = document.getElementById('inbox-list');
         this.similarList = document.getElementById('similar-list');
         
@@ -38,12 +50,23 @@ class MailboxZero {
         this.inboxSortSelect = document.getElementById('inbox-sort');
         this.similarSortSelect = document.getElementById('similar-sort');
         
+        // Undo controls
+        this.undoSelect = document.getElementById('undo-select');
+        this.undoBtn = document.getElementById('undo-btn');
+        
+        // Group picker
+        this.groupControls = document.getElementById('group-controls');
+        this.groupSelect = document.getElementById('group-select');
+        
         // Modal elements
         this.archiveModal = document.getElementById('archive-modal');
         this.modalOverlay = document.getElementById('modal-overlay');
         this.confirmArchiveBtn = document.getElementById('confirm-archive-btn');
         this.cancelArchiveBtn = document.getElementById('cancel-archive-btn');
         this.archiveCount = document.getElementById('archive-count');
+        this.archiveModalTitle = document.getElementById('archive-modal-title');
+        this.archiveAction = document.getElementById('archive-action');
+        this.archiveTarget = document.getElementById('archive-target');
         
         // Preview popup elements
         this.previewPopup = document.getElementById('email-preview-popup');
@@ -84,6 +107,13 @@ class MailboxZero {
             this.similarityValue.textContent = e.target.value + '%';
         });
 
+        // The threshold and clustering only apply to similarity matching
+        this.groupModeSelect.addEventListener('change', (e) => {
+            this.similaritySlider.disabled = e.target.value !== 'fuzzy';
+            this.clusteringSelect.disabled = e.target.value !== 'fuzzy';
+        });
+
+        this.resetWeightsBtn.addEventListener('click', () => this.resetWeights());
         this.refreshBtn.addEventListener('click', () => this.loadEmails());
         this.findSimilarBtn.addEventListener('click', () => this.findSimilarEmails());
         this.clearResultsBtn.addEventListener('click', () => this.clearResults());
@@ -103,7 +133,16 @@ class MailboxZero {
             this.renderEmails(this.similarEmails, this.similarList, true);
         });
         
+        this.undoBtn.addEventListener('click', () => this.undoArchive());
+        
+        this.groupSelect.addEventListener('change', (e) => {
+            this.showGroup(e.target.value);
+        });
+        
+        this.moveTargetSelect.addEventListener('change', () => this.updateMoveTarget());
+        
         this.archiveBtn.addEventListener('click', () => this.showArchiveModal());
+        this.unsubscribeBtn.addEventListener('click', () => this.unsubscribe());
         this.confirmArchiveBtn.addEventListener('click', () => this.archiveEmails());
         this.cancelArchiveBtn.addEventListener('click', () => this.hideArchiveModal());
         this.modalOverlay.addEventListener('click', () => this.hideArchiveModal());
@@ -170,6 +209,33 @@ class MailboxZero {
         });
     }
 
+    connectEvents() {
+        if (!window.EventSource) {
+            return;
+        }
+        
+        this.eventSource = new EventSource('/api/events');
+        this.eventRefreshTimeout = null;
+        
+        this.eventSource.addEventListener('state', () => {
+            // Coalesce bursts of state changes into a single refresh
+            if (this.eventRefreshTimeout) {
+                clearTimeout(this.eventRefreshTimeout);
+            }
+            this.eventRefreshTimeout = setTimeout(() => {
+                this.eventRefreshTimeout = null;
+                this.loadEmails();
+            }, 500);
+        });
+        
+        this.eventSource.addEventListener('error', () => {
+            // The server does not support push (e.g. 501); stop retrying
+            if (this.eventSource.readyState === EventSource.CLOSED) {
+                this.eventSource = null;
+            }
+        });
+    }
+
     async loadEmails() {
         try {
             this.showLoading(this.inboxList, 'Loading emails...');
@@ -199,18 +265,23 @@ class MailboxZero {
     }
 
     async findSimilarEmails() {
+        // Without a selected email, scan the inbox for all clusters at once
+        if (!this.selectedEmailId) {
+            return this.findGroups();
+        }
+        
         try {
             this.showLoading(this.similarList, 'Finding similar emails...');
+            this.setGroups([]);
             
             const similarityThreshold = parseFloat(this.similaritySlider.value);
             const requestBody = {
-                similarityThreshold: similarityThreshold
+                similarityThreshold: similarityThreshold,
+                emailId: this.selectedEmailId,
+                mode: this.groupModeSelect.value,
+                clustering: this.clusteringSelect.value
             };
             
-            if (this.selectedEmailId) {
-                requestBody.emailId = this.selectedEmailId;
-            }
-            
             const response = await fetch('/api/similar', {
                 method: 'POST',
                 headers: {
@@ -241,42 +312,384 @@ class MailboxZero {
         }
     }
 
+    async findGroups() {
+        try {
+            this.showLoading(this.similarList, 'Finding similar email groups...');
+            
+            const response = await fetch('/api/groups', {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json',
+                },
+                body: JSON.stringify({
+                    similarityThreshold: parseFloat(this.similaritySlider.value),
+                    mode: this.groupModeSelect.value,
+                    clustering: this.clusteringSelect.value
+                })
+            });
+            
+            if (!response.ok) {
+                throw new Error(`HTTP error! status: ${response.status}`);
+            }
+            
+            const result = await response.json();
+            this.setGroups(result.groups);
+            
+            if (this.groups.length === 0) {
+                this.similarEmails = [];
+                this.selectedSimilarEmails.clear();
+                this.showEmpty(this.similarList, 'No similar emails found with the current similarity threshold.');
+                this.updateControls();
+            } else {
+                this.showGroup(this.groups[0].id);
+            }
+        } catch (error) {
+            console.error('Error finding similar email groups:', error);
+            this.showError(this.similarList, 'Failed to find similar emails.');
+        }
+    }
+
+    setGroups(groups) {
+        this.groups = groups || [];
+        this.currentGroupId = null;
+        
+        this.groupSelect.innerHTML = this.groups.map((group, index) => {
+            // Exact modes are labelled by what the group shares, similarity
+            // groups by their subject template, e.g. "Your order #<N> has shipped"
+            const label = group.key
+                ? `#${index + 1} · ${group.size} emails · ${group.key}`
+                : `#${index + 1} · ${group.size} emails · ${Math.round(group.similarity * 100)}% · ` +
+                  `${group.template || group.subject || '(No subject)'}${group.sender ? ' (' + group.sender + ')' : ''}`;
+            return `<option value="${this.escapeHtml(group.id)}">${this.escapeHtml(label)}</option>`;
+        }).join('');
+        
+        this.groupControls.style.display = this.groups.length > 0 ? 'flex' : 'none';
+    }
+
+    showGroup(groupId) {
+        const group = this.groups.find(g => g.id === groupId);
+        if (!group) {
+            return;
+        }
+        
+        this.currentGroupId = group.id;
+        this.groupSelect.value = group.id;
+        // Each member carries the breakdown of how it matched the group
+        const scores = group.scores || {};
+        this.similarEmails = group.emails.map(email => ({ ...email, breakdown: scores[email.id] }));
+        this.selectedSimilarEmails.clear();
+        this.similarEmails.forEach(email => this.selectedSimilarEmails.add(email.id));
+        this.renderEmails(this.similarEmails, this.similarList, true);
+        this.selectAllCheckbox.checked = true;
+        this.selectAllCheckbox.indeterminate = false;
+        this.updateControls();
+    }
+
+    // Drop archived emails from the current group and move on to the next
+    // cluster without re-scanning the inbox.
+    advanceGroups(archivedIds) {
+        const archived = new Set(archivedIds);
+        const index = this.groups.findIndex(g => g.id === this.currentGroupId);
+        
+        const remaining = this.groups
+            .map(group => {
+                const emails = group.emails.filter(email => !archived.has(email.id));
+                return { ...group, emails, size: emails.length };
+            })
+            .filter(group => group.size > 1);
+        
+        this.setGroups(remaining);
+        
+        if (this.groups.length === 0) {
+            this.clearResults();
+            return;
+        }
+        
+        const next = this.groups[Math.min(Math.max(index, 0), this.groups.length - 1)];
+        this.showGroup(next.id);
+    }
+
+    // Load the mailbox tree for the move target picker. Mailboxes the user
+    // cannot add emails to are listed but disabled.
+    async loadMailboxes() {
+        try {
+            const response = await fetch('/api/mailboxes');
+            if (!response.ok) {
+                throw new Error(`HTTP error! status: ${response.status}`);
+            }
+            
+            const tree = await response.json();
+            const options = ['<option value="">Archive</option>'];
+            this.mailboxNames = {};
+            
+            const addOptions = (nodes, depth) => {
+                nodes.forEach(node => {
+                    this.mailboxNames[node.id] = node.name;
+                    if (node.role !== 'inbox' && node.role !== 'archive') {
+                        const writable = node.myRights && node.myRights.mayAddItems;
+                        const label = '\u00a0\u00a0'.repeat(depth) + node.name + (writable ? '' : ' (read-only)');
+                        options.push(`<option value="${this.escapeHtml(node.id)}"${writable ? '' : ' disabled'}>${this.escapeHtml(label)}</option>`);
+                    }
+                    addOptions(node.children || [], depth + 1);
+                });
+            };
+            addOptions(tree, 0);
+            
+            const current = this.moveTargetSelect.value;
+            this.moveTargetSelect.innerHTML = options.join('');
+            this.moveTargetSelect.value = this.mailboxNames[current] ? current : '';
+            this.updateMoveTarget();
+        } catch (error) {
+            console.error('Error loading mailboxes:', error);
+        }
+    }
+
+    updateMoveTarget() {
+        this.archiveBtn.textContent = this.moveTargetSelect.value ? 'Move Selected' : 'Archive Selected';
+    }
+
     async archiveEmails() {
+        const mailboxId = this.moveTargetSelect.value;
+        const verb = mailboxId ? 'move' : 'archive';
+        
         try {
             const emailIds = Array.from(this.selectedSimilarEmails);
+            // Archiving a similarity group teaches the server which members
+            // belonged in it: the ones left selected did, the others did not
+            const learn = this.groupModeSelect.value === 'fuzzy';
+            const rejectedIds = this.similarEmails
+                .map(email => email.id)
+                .filter(id => !this.selectedSimilarEmails.has(id));
             
-            const response = await fetch('/api/archive', {
+            const response = await fetch(mailboxId ? '/api/move' : '/api/archive', {
                 method: 'POST',
                 headers: {
                     'Content-Type': 'application/json',
                 },
-                body: JSON.stringify({ emailIds })
+                body: JSON.stringify(mailboxId ? { emailIds, mailboxId } : { emailIds, rejectedIds, learn })
             });
             
             if (!response.ok) {
-                throw new Error(`HTTP error! status: ${response.status}`);
+                const message = (await response.text()).trim();
+                throw new Error(message || `HTTP error! status: ${response.status}`);
             }
             
             const result = await response.json();
             this.hideArchiveModal();
+            if (result.learning) {
+                // The server learns after answering; show the weights it
+                // learned once it has had the time to
+                setTimeout(() => this.loadWeights(), 1000);
+            }
             
             if (result.dryRun) {
-                alert(`Dry run completed: Would have archived ${emailIds.length} emails.`);
+                alert(`Dry run completed: Would have ${verb}d ${emailIds.length} emails.`);
+            } else if (result.failed && result.failed.length > 0) {
+                this.loadEmails(); // Refresh inbox
+                this.loadHistory();
+                this.showArchiveFailures(result);
             } else {
-                alert(`Successfully archived ${emailIds.length} emails.`);
+                alert(`Successfully ${verb}d ${emailIds.length} emails.`);
                 this.loadEmails(); // Refresh inbox
-                this.clearResults(); // Clear similar emails
+                this.loadHistory();
+                if (this.currentGroupId) {
+                    this.advanceGroups(emailIds); // Continue with the next group
+                } else {
+                    this.clearResults(); // Clear similar emails
+                }
             }
         } catch (error) {
-            console.error('Error archiving emails:', error);
-            alert('Failed to archive emails.');
+            console.error(`Error trying to ${verb} emails:`, error);
+            alert(`Failed to ${verb} emails: ${error.message}`);
             this.hideArchiveModal();
         }
     }
 
+    // Keep only the emails that failed to archive or move in the right pane,
+    // selected, so they can be retried with another click.
+    showArchiveFailures(result) {
+        const archived = new Set(result.archived || result.moved || []);
+        const failedIds = new Set(result.failed.map(f => f.id));
+        
+        this.similarEmails = this.similarEmails.filter(email => !archived.has(email.id));
+        this.groups.forEach(group => {
+            group.emails = group.emails.filter(email => !archived.has(email.id));
+            group.size = group.emails.length;
+        });
+        
+        this.selectedSimilarEmails.clear();
+        this.similarEmails
+            .filter(email => failedIds.has(email.id))
+            .forEach(email => this.selectedSimilarEmails.add(email.id));
+        
+        this.renderEmails(this.similarEmails, this.similarList, true);
+        this.updateSelectAllCheckbox();
+        this.updateControls();
+        
+        const details = result.failed.map(failure => {
+            const email = this.similarEmails.find(e => e.id === failure.id);
+            const subject = email ? (email.subject || '(No subject)') : failure.id;
+            return `- ${subject}: ${failure.type}${failure.description ? ' (' + failure.description + ')' : ''}`;
+        }).join('\n');
+        
+        alert(`${result.message}\n\nThe following emails were not moved and are still selected for retry:\n${details}`);
+    }
+
+    // Unsubscribe from the senders of the selected emails. The server reads
+    // the List-Unsubscribe headers itself and reports one result per sender.
+    async unsubscribe() {
+        const emailIds = Array.from(this.selectedSimilarEmails);
+        if (!confirm(`Unsubscribe from the senders of ${emailIds.length} selected emails?`)) {
+            return;
+        }
+        
+        try {
+            const response = await fetch('/api/unsubscribe', {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json',
+                },
+                body: JSON.stringify({ emailIds })
+            });
+            
+            if (!response.ok) {
+                const message = (await response.text()).trim();
+                throw new Error(message || `HTTP error! status: ${response.status}`);
+            }
+            
+            const result = await response.json();
+            const labels = {
+                unsubscribed: 'unsubscribed',
+                sent: 'unsubscribe email sent',
+                dryRun: 'would unsubscribe',
+                manual: 'open this link to unsubscribe',
+                unsupported: 'no unsubscribe option',
+                failed: 'failed'
+            };
+            const details = result.results.map(r => {
+                let line = `- ${r.sender}: ${labels[r.status] || r.status}`;
+                if (r.method) line += ` (${r.method})`;
+                if (r.status === 'manual') line += `\n  ${r.target}`;
+                if (r.error) line += `\n  ${r.error}`;
+                return line;
+            }).join('\n');
+            
+            const title = result.dryRun ? 'Dry run completed' : result.message;
+            alert(`${title}\n\n${details}`);
+        } catch (error) {
+            console.error('Error unsubscribing:', error);
+            alert(`Failed to unsubscribe: ${error.message}`);
+        }
+    }
+
+    // Show the reset button once weights have been learned from archives,
+    // with the weights in its tooltip
+    async loadWeights() {
+        try {
+            const response = await fetch('/api/weights');
+            if (!response.ok) {
+                throw new Error(`HTTP error! status: ${response.status}`);
+            }
+            
+            const result = await response.json();
+            this.showWeights(result.learned ? result : {});
+        } catch (error) {
+            console.error('Error loading weights:', error);
+        }
+    }
+
+    showWeights(feedback) {
+        const weights = feedback.weights;
+        this.resetWeightsBtn.style.display = weights ? '' : 'none';
+        if (weights) {
+            const percent = value => Math.round(value * 100) + '%';
+            this.resetWeightsBtn.title =
+                `Learned from ${feedback.accepted} archived and ${feedback.rejected} deselected emails: ` +
+                `subject ${percent(weights.subject)}, sender ${percent(weights.sender)}, body ${percent(weights.body)}`;
+        }
+    }
+
+    async resetWeights() {
+        if (!confirm('Forget what was learned from your archives and use the default weights?')) {
+            return;
+        }
+        
+        try {
+            const response = await fetch('/api/weights', { method: 'DELETE' });
+            if (!response.ok) {
+                throw new Error(`HTTP error! status: ${response.status}`);
+            }
+            this.showWeights({});
+        } catch (error) {
+            console.error('Error resetting weights:', error);
+            alert('Failed to reset weights.');
+        }
+    }
+
+    async loadHistory() {
+        try {
+            const response = await fetch('/api/history?limit=10');
+            if (!response.ok) {
+                throw new Error(`HTTP error! status: ${response.status}`);
+            }
+            
+            const entries = (await response.json()).filter(entry => !entry.undone);
+            
+            if (entries.length === 0) {
+                this.undoSelect.innerHTML = '<option value="">No archives to undo</option>';
+            } else {
+                this.undoSelect.innerHTML = entries.map(entry => {
+                    const time = new Date(entry.timestamp).toLocaleTimeString();
+                    const label = `${time} · ${entry.emailIds.length} emails`;
+                    return `<option value="${this.escapeHtml(entry.id)}">${this.escapeHtml(label)}</option>`;
+                }).join('');
+            }
+            
+            this.undoSelect.disabled = entries.length === 0;
+            this.undoBtn.disabled = entries.length === 0;
+        } catch (error) {
+            console.error('Error loading archive history:', error);
+        }
+    }
+
+    async undoArchive() {
+        const entryId = this.undoSelect.value;
+        if (!entryId) {
+            return;
+        }
+        
+        try {
+            const response = await fetch('/api/undo', {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json',
+                },
+                body: JSON.stringify({ entryId })
+            });
+            
+            if (!response.ok) {
+                throw new Error(`HTTP error! status: ${response.status}`);
+            }
+            
+            const result = await response.json();
+            
+            if (result.dryRun) {
+                alert(`Dry run completed: Would have restored ${result.restored.length} emails.`);
+            } else {
+                alert(result.message);
+                this.loadEmails(); // Refresh inbox
+                this.loadHistory();
+            }
+        } catch (error) {
+            console.error('Error undoing archive:', error);
+            alert('Failed to undo archive.');
+        }
+    }
+
     async clearResults() {
         try {
             await fetch('/api/clear', { method: 'POST' });
+            this.setGroups([]);
             this.similarEmails = [];
             this.selectedSimilarEmails.clear();
             this.showEmpty(this.similarList, 
@@ -361,6 +774,32 @@ class MailboxZero {
         return 'Unknown sender';
     }
 
+    // Spell out a similarity breakdown feature by feature, for the score
+    // badge's tooltip
+    describeBreakdown(breakdown) {
+        const percent = value => `${Math.round(value * 100)}%`;
+        const lines = breakdown.features.map(feature => {
+            const name = feature.name.charAt(0).toUpperCase() + feature.name.slice(1);
+            let line = `${name}: ${percent(feature.score)}`;
+            if (feature.bonus > 0) {
+                line += ` (incl. +${percent(feature.bonus)} common words)`;
+            }
+            line += ` × weight ${feature.weight.toFixed(2)}`;
+            if (feature.note) {
+                line += ` – ${feature.note}`;
+            }
+            return line;
+        });
+        lines.push(`Total: ${percent(breakdown.score)}`);
+        // Members of connected and average clusters are scored against the
+        // member they are most similar to
+        const against = breakdown.against && this.similarEmails.find(email => email.id === breakdown.against);
+        if (against) {
+            lines.unshift(`Compared with: ${against.subject || '(No subject)'}`);
+        }
+        return lines.join('\n');
+    }
+
     renderEmails(emails, container, withCheckboxes) {
         // Determine which sort to use based on which container we're rendering to
         const sortBy = container === this.inboxList ? this.inboxSortBy : this.similarSortBy;
@@ -386,7 +825,9 @@ class MailboxZero {
                     ` : ''}
                     <div class="email-content">
                         <div class="email-subject">${this.escapeHtml(email.subject || '(No subject)')}</div>
-                        <div class="email-from">${this.escapeHtml(fromName)}</div>
+                        <div class="email-from">${this.escapeHtml(fromName)}${email.listId ? `
+                            <span class="list-badge" title="${this.escapeHtml(email.listId)}">List</span>` : ''}${email.breakdown ? `
+                            <span class="score-badge" title="${this.escapeHtml(this.describeBreakdown(email.breakdown))}">${Math.round(email.breakdown.score * 100)}%</span>` : ''}</div>
                         <div class="email-preview">${this.escapeHtml(email.preview || '')}</div>
                     </div>
                     <div class="email-date">${date}</div>
@@ -518,6 +959,7 @@ class MailboxZero {
         
         this.clearResultsBtn.disabled = !hasResults;
         this.archiveBtn.disabled = !hasSelected;
+        this.unsubscribeBtn.disabled = !hasSelected;
         
         this.updateTitles();
     }
@@ -548,7 +990,12 @@ class MailboxZero {
 
     showArchiveModal() {
         const count = this.selectedSimilarEmails.size;
+        const mailboxId = this.moveTargetSelect.value;
         this.archiveCount.textContent = count;
+        this.archiveAction.textContent = mailboxId ? 'move' : 'archive';
+        this.archiveTarget.textContent = mailboxId ? ` to ${this.mailboxNames[mailboxId]}` : '';
+        this.archiveModalTitle.textContent = mailboxId ? 'Confirm Move' : 'Confirm Archive';
+        this.confirmArchiveBtn.textContent = mailboxId ? 'Move' : 'Archive';
         this.archiveModal.style.display = 'block';
         this.modalOverlay.style.display = 'block';
     }
@@ -641,60 +1088,9 @@ class MailboxZero {
     }
 
     loadPreviewBody(email) {
-        let bodyContent = '';
-        
-        // First try to find text body content using textBody structure
-        if (email.bodyValues && email.textBody && email.textBody.length > 0) {
-            // Look for text parts first (preferred for preview)
-            for (const part of email.textBody) {
-                if (part.partId && email.bodyValues[part.partId]) {
-                    const bodyValue = email.bodyValues[part.partId];
-                    if (bodyValue.value && bodyValue.value.trim()) {
-                        bodyContent = bodyValue.value;
-                        break;
-                    }
-                }
-            }
-        }
-        
-        // If no text body, try HTML body but strip HTML tags
-        if (!bodyContent && email.bodyValues && email.htmlBody && email.htmlBody.length > 0) {
-            for (const part of email.htmlBody) {
-                if (part.partId && email.bodyValues[part.partId]) {
-                    const bodyValue = email.bodyValues[part.partId];
-                    if (bodyValue.value && bodyValue.value.trim()) {
-                        // Strip HTML tags for preview
-                        const tempDiv = document.createElement('div');
-                        tempDiv.innerHTML = bodyValue.value;
-                        bodyContent = tempDiv.textContent || tempDiv.innerText || '';
-                        break;
-                    }
-                }
-            }
-        }
-        
-        // Fallback: try any bodyValues content
-        if (!bodyContent && email.bodyValues) {
-            for (const partId in email.bodyValues) {
-                const bodyValue = email.bodyValues[partId];
-                if (bodyValue.value && bodyValue.value.trim()) {
-                    // If it looks like HTML, strip tags
-                    if (bodyValue.value.includes('<') && bodyValue.value.includes('>')) {
-                        const tempDiv = document.createElement('div');
-                        tempDiv.innerHTML = bodyValue.value;
-                        bodyContent = tempDiv.textContent || tempDiv.innerText || '';
-                    } else {
-                        bodyContent = bodyValue.value;
-                    }
-                    break;
-                }
-            }
-        }
-        
-        // Final fallback to preview text
-        if (!bodyContent && email.preview) {
-            bodyContent = email.preview;
-        }
+        // The server converts the body to plain text, preferring text parts
+        // and stripping HTML, so no markup from the email is ever rendered
+        const bodyContent = email.bodyText || email.preview || '';
         
         if (bodyContent && bodyContent.trim()) {
             this.displayPreviewBody(bodyContent);